@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zhubert/milo/internal/audit"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show permission decisions",
+	Long: `Show the permission decisions recorded in .milo/audit.jsonl: what each tool
+call was, what the rules decided and why, and how you answered when asked.`,
+	Example: `  milo audit --session 3f2a
+  milo audit --tool bash --decision deny
+  milo audit --decision ask --since 24h --json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAudit,
+}
+
+var (
+	auditSession  string
+	auditTool     string
+	auditDecision string
+	auditSince    time.Duration
+	auditJSON     bool
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditSession, "session", "", "only decisions from sessions whose ID starts with this")
+	auditCmd.Flags().StringVar(&auditTool, "tool", "", "only decisions for this tool")
+	auditCmd.Flags().StringVar(&auditDecision, "decision", "", "only calls that were allowed (allow), blocked (deny), or prompted for (ask)")
+	auditCmd.Flags().DurationVar(&auditSince, "since", 0, "only decisions from this long ago onwards, e.g. 24h")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "print matching entries as JSONL")
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+
+	filter := audit.Filter{
+		SessionID: auditSession,
+		Tool:      strings.ToLower(auditTool),
+		Decision:  strings.ToLower(auditDecision),
+	}
+	switch filter.Decision {
+	case "", "allow", "deny", "ask":
+	default:
+		return fmt.Errorf("invalid --decision %q, must be allow, deny or ask", auditDecision)
+	}
+	if auditSince > 0 {
+		filter.Since = time.Now().Add(-auditSince)
+	}
+
+	entries, err := audit.Read(audit.FileForWorkDir(workDir), filter)
+	if err != nil {
+		return err
+	}
+
+	if auditJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return fmt.Errorf("encoding entry: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No matching permission decisions.")
+		return nil
+	}
+
+	fmt.Printf("%-19s  %-8s  %-10s  %-14s  %s\n", "TIME", "SESSION", "TOOL", "DECISION", "INPUT")
+	fmt.Println("─────────────────────────────────────────────────────────────────────")
+	for _, e := range entries {
+		session := e.SessionID
+		if len(session) > 8 {
+			session = session[:8]
+		}
+		// An edited call ran with the user's input, not the model's.
+		ran := e.Input
+		if e.Response == audit.ResponseEdit && e.Edited != "" {
+			ran = e.Edited
+		}
+		input := strings.Join(strings.Fields(ran), " ")
+		if len(input) > 60 {
+			input = input[:57] + "..."
+		}
+		fmt.Printf("%-19s  %-8s  %-10s  %-14s  %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"),
+			session,
+			e.Tool,
+			describeOutcome(e),
+			input,
+		)
+		if e.Reason != "" {
+			fmt.Printf("%21s↳ %s\n", "", e.Reason)
+		}
+		if ran != e.Input {
+			fmt.Printf("%21s↳ edited from: %s\n", "", strings.Join(strings.Fields(e.Input), " "))
+		}
+	}
+	return nil
+}
+
+// describeOutcome summarizes what happened to a tool call: the rule's
+// decision, or the user's answer when they were asked. An edited call that
+// a rule then denied never ran.
+func describeOutcome(e audit.Entry) string {
+	if !e.Prompted {
+		return e.Action
+	}
+	switch e.Response {
+	case audit.ResponseAlways:
+		return "ask → always"
+	case audit.ResponseAllow:
+		return "ask → allow"
+	case audit.ResponseEdit:
+		if !e.Allowed {
+			return "edited → deny"
+		}
+		return "ask → edited"
+	case audit.ResponseCancelled:
+		return "ask → cancel"
+	default:
+		return "ask → deny"
+	}
+}
@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zhubert/milo/internal/config"
+	"github.com/zhubert/milo/internal/permission"
+	"github.com/zhubert/milo/internal/todo"
+	"github.com/zhubert/milo/internal/tool"
+)
+
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "Manage and inspect permission rules",
+	Long: `Manage the permission rules in ~/.milo/permissions.yaml (--global) and
+.milo/permissions.yaml (--project), and inspect how they apply. Rules in the
+managed policy (/etc/milo/policy.yaml, or $MILO_POLICY_FILE) are locked: they
+are listed and enforced but can't be changed from here.`,
+}
+
+var permissionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List permission rules",
+	Long:  `List the rules in the global and project permissions files, or only the one selected.`,
+	Args:  cobra.NoArgs,
+	RunE:  runPermissionsList,
+}
+
+var permissionsAddCmd = &cobra.Command{
+	Use:   "add <rule>",
+	Short: "Add a permission rule",
+	Long: `Add a rule such as 'Bash(npm:*)' or 'Read(*.pem):deny' to the project
+permissions file, or the global one with --global. A rule with the same tool
+and pattern is replaced.`,
+	Example: `  milo permissions add 'Bash(go test:*)'
+  milo permissions add --global 'Bash(rm:*):ask'`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runPermissionsAdd,
+}
+
+var permissionsRemoveCmd = &cobra.Command{
+	Use:     "remove <rule|number>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a permission rule",
+	Long: `Remove a rule from the project permissions file, or the global one with
+--global, by its text or its number from 'milo permissions list'.`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runPermissionsRemove,
+}
+
+var permissionsLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check permission rules for mistakes",
+	Long: `Report rules that don't parse, duplicate another rule, are shadowed by a
+more specific rule with a different action, or can never match their tool's
+input. Exits with an error when problems are found.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runPermissionsLint,
+}
+
+var permissionsTestCmd = &cobra.Command{
+	Use:   "test <tool> <input>",
+	Short: "Show how a tool call would be decided",
+	Long: `Evaluate a tool call against the built-in, global and project permission
+rules and print every rule considered, the rule that won and why.
+
+The input is what rules match against: the command for bash, the path for
+file tools, or the operation and arguments for git. A JSON object is used
+as the raw tool input.
+
+With --expect, exit with an error when the decision differs, for use in CI.`,
+	Example: `  milo permissions test bash 'go test ./... | tee out.log'
+  milo permissions test read .env --expect ask`,
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	RunE:         runPermissionsTest,
+}
+
+var (
+	permissionsExpect  string
+	permissionsSandbox bool
+	permissionsGlobal  bool
+	permissionsProject bool
+)
+
+func init() {
+	permissionsCmd.PersistentFlags().BoolVar(&permissionsGlobal, "global", false, "use ~/.milo/permissions.yaml")
+	permissionsCmd.PersistentFlags().BoolVar(&permissionsProject, "project", false, "use .milo/permissions.yaml in the current directory")
+	permissionsCmd.MarkFlagsMutuallyExclusive("global", "project")
+
+	permissionsTestCmd.Flags().StringVar(&permissionsExpect, "expect", "", "fail unless the decision is allow, ask or deny")
+	permissionsTestCmd.Flags().BoolVar(&permissionsSandbox, "sandbox", false, "evaluate as if bash runs in the sandbox (default from config)")
+
+	permissionsCmd.AddCommand(permissionsListCmd, permissionsAddCmd, permissionsRemoveCmd, permissionsLintCmd, permissionsTestCmd)
+	rootCmd.AddCommand(permissionsCmd)
+}
+
+// permissionFile is a permissions file and how to refer to it.
+type permissionFile struct {
+	label string
+	path  string
+}
+
+// permissionFiles returns the files selected by --global or --project, or
+// both (global first, the order they load in) when neither is set.
+func permissionFiles() ([]permissionFile, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("getting working directory: %w", err)
+	}
+	global, err := permission.GlobalFile()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []permissionFile{
+		{label: "Global", path: global},
+		{label: "Project", path: permission.ProjectFile(workDir)},
+	}
+	switch {
+	case permissionsGlobal:
+		return files[:1], nil
+	case permissionsProject:
+		return files[1:], nil
+	default:
+		return files, nil
+	}
+}
+
+// permissionTarget returns the single file add and remove act on: the
+// project file unless --global is set.
+func permissionTarget() (permissionFile, error) {
+	files, err := permissionFiles()
+	if err != nil {
+		return permissionFile{}, err
+	}
+	return files[len(files)-1], nil
+}
+
+func runPermissionsList(cmd *cobra.Command, args []string) error {
+	files, err := permissionFiles()
+	if err != nil {
+		return err
+	}
+
+	// The managed policy is listed too, but add and remove never touch it.
+	if !permissionsGlobal && !permissionsProject {
+		policy, err := permission.LoadPolicy(permission.PolicyFile())
+		if err != nil {
+			return err
+		}
+		if policy != nil {
+			fmt.Printf("Managed (%s, locked):\n", permission.PolicyFile())
+			if len(policy.Rules) == 0 {
+				fmt.Println("  (no rules)")
+			}
+			for _, rule := range policy.Rules {
+				fmt.Printf("  🔒  %s\n", rule)
+			}
+			if policy.DisableBypass {
+				fmt.Println("  disable_bypass: the sandbox doesn't auto-allow bash, and whole tools can't be allowed")
+			}
+			if policy.DisablePersistentGrants {
+				fmt.Println("  disable_persistent_grants: always-allow answers last for the session only")
+			}
+			fmt.Println()
+		}
+	}
+
+	for i, f := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		rules, err := permission.ReadRules(f.path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s):\n", f.label, f.path)
+		if len(rules) == 0 {
+			fmt.Println("  (no rules)")
+		}
+		for n, rule := range rules {
+			fmt.Printf("  [%d] %s\n", n+1, rule)
+		}
+	}
+	return nil
+}
+
+func runPermissionsAdd(cmd *cobra.Command, args []string) error {
+	target, err := permissionTarget()
+	if err != nil {
+		return err
+	}
+
+	rule, err := permission.ParseRule(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	replaced, err := permission.AddToFile(target.path, rule)
+	if err != nil {
+		return err
+	}
+
+	verb := "Added"
+	if replaced {
+		verb = "Replaced"
+	}
+	fmt.Printf("%s %s in %s\n", verb, rule.String(), target.path)
+	return nil
+}
+
+func runPermissionsRemove(cmd *cobra.Command, args []string) error {
+	target, err := permissionTarget()
+	if err != nil {
+		return err
+	}
+
+	removed, err := permission.RemoveFromFile(target.path, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from %s\n", removed, target.path)
+	return nil
+}
+
+func runPermissionsLint(cmd *cobra.Command, args []string) error {
+	files, err := permissionFiles()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+
+	issues, err := permission.Lint(paths...)
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		fmt.Println("No problems found.")
+		return nil
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	return fmt.Errorf("found %d problem(s) in permission rules", len(issues))
+}
+
+func runPermissionsTest(cmd *cobra.Command, args []string) error {
+	expect := strings.ToLower(permissionsExpect)
+	switch expect {
+	case "", "allow", "ask", "deny":
+	default:
+		return fmt.Errorf("invalid --expect %q, must be allow, ask or deny", permissionsExpect)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+
+	cfg, err := config.Load(workDir)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if cmd.Flags().Changed("sandbox") {
+		cfg.Sandbox.Enabled = permissionsSandbox
+	}
+
+	perms, err := permission.NewCheckerWithConfig(workDir)
+	if err != nil {
+		return fmt.Errorf("loading permissions: %w", err)
+	}
+	for _, warning := range perms.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s\n", warning)
+	}
+	perms.SetSubjects(subjectTools(workDir).PermissionSubjects)
+	perms.SetSandboxed(cfg.Sandbox.Enabled && cfg.Sandbox.Confined())
+	perms.SetEnvScrubbed(cfg.Bash.Env.ScrubsSecrets())
+	if err := perms.SetWorkspace(cfg.Workspace); err != nil {
+		return fmt.Errorf("setting up workspace: %w", err)
+	}
+
+	toolName := strings.ToLower(args[0])
+	input := strings.Join(args[1:], " ")
+	decision := perms.Decide(toolName, permission.ToolInput(toolName, input))
+
+	fmt.Printf("%s: %s\n\n", toolName, input)
+	for _, ev := range decision.Trace {
+		fmt.Printf("  %s %q\n", ev.Tool, ev.Input)
+		if ev.Note != "" {
+			fmt.Printf("      (%s)\n", ev.Note)
+		}
+		for i, m := range ev.Matches {
+			marker := " "
+			if i == 0 {
+				marker = "✓"
+			}
+			source := m.Rule.Source
+			if m.Rule.Locked {
+				source += " (locked)"
+			}
+			fmt.Printf("    %s %-30s score %-4d %s\n", marker, formatRule(m.Rule), m.Score, source)
+		}
+		if len(ev.Matches) == 0 && ev.Note == "" {
+			fmt.Println("      (no matching rules)")
+		}
+		fmt.Printf("      → %s\n", ev.Action)
+	}
+
+	fmt.Printf("\nDecision: %s\n", decision.Action)
+	fmt.Printf("Reason:   %s\n", decision.Reason)
+
+	if expect != "" && expect != decision.Action.String() {
+		return fmt.Errorf("expected %s, got %s", expect, decision.Action)
+	}
+	return nil
+}
+
+// subjectTools returns a registry of the built-in tools, set up just enough
+// to report their permission subjects.
+func subjectTools(workDir string) *tool.Registry {
+	registry := tool.NewRegistry()
+	tools := builtinTools(workDir, &tool.BashTool{WorkDir: workDir}, &tool.WebFetchTool{},
+		&tool.LSPTool{WorkDir: workDir}, tool.NewJobManager(), todo.NewStore())
+	for _, t := range tools {
+		_ = registry.Register(t)
+	}
+	return registry
+}
+
+// formatRule prints a rule in compact form with its action spelled out.
+func formatRule(r permission.Rule) string {
+	s := r.String()
+	if r.Action == permission.Allow {
+		s += ":allow"
+	}
+	return s
+}
@@ -4,16 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/spf13/cobra"
 
 	"github.com/zhubert/milo/internal/agent"
+	"github.com/zhubert/milo/internal/audit"
+	"github.com/zhubert/milo/internal/checkpoint"
+	"github.com/zhubert/milo/internal/config"
 	"github.com/zhubert/milo/internal/logging"
 	"github.com/zhubert/milo/internal/lsp"
 	"github.com/zhubert/milo/internal/permission"
+	"github.com/zhubert/milo/internal/redact"
 	"github.com/zhubert/milo/internal/runner"
+	"github.com/zhubert/milo/internal/sandbox"
 	"github.com/zhubert/milo/internal/session"
 	"github.com/zhubert/milo/internal/todo"
 	"github.com/zhubert/milo/internal/tool"
@@ -21,9 +28,13 @@ import (
 )
 
 var (
-	resumeFlag string
-	newSession bool
-	modelFlag  string
+	resumeFlag      string
+	forkFlag        string
+	newSession      bool
+	modelFlag       string
+	persistentShell bool
+	sandboxFlag     bool
+	addDirs         []string
 )
 
 var rootCmd = &cobra.Command{
@@ -34,9 +45,13 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&resumeFlag, "resume", "", "resume a previous session by ID (or 'last' for most recent)")
+	rootCmd.Flags().StringVar(&resumeFlag, "resume", "", "resume a previous session by ID, the start of its title, or 'last' for the most recent")
+	rootCmd.Flags().StringVar(&forkFlag, "fork", "", "start a new session copied from a previous one by ID, the start of its title, or 'last' for the most recent")
 	rootCmd.Flags().BoolVar(&newSession, "new", false, "start a new session (ignore any existing session)")
 	rootCmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Claude model to use (e.g., claude-sonnet-4-20250514, claude-opus-4-5-20251101)")
+	rootCmd.Flags().BoolVar(&sandboxFlag, "sandbox", false, "run bash commands in a sandbox (Linux only): writes limited to the project, network off unless allowed in config")
+	rootCmd.Flags().StringArrayVar(&addDirs, "add-dir", nil, "add a directory to the workspace file tools may write to without extra prompts (repeatable)")
+	rootCmd.Flags().BoolVar(&persistentShell, "persistent-shell", false, "keep one bash process for the session so env vars and cd persist between commands")
 }
 
 // Execute runs the root command.
@@ -64,6 +79,40 @@ func runTUI(cmd *cobra.Command, args []string) error {
 
 	logger.Info("starting milo", "work_dir", workDir)
 
+	cfg, err := config.Load(workDir)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	for _, warning := range cfg.Warnings {
+		logger.Warn("ignoring project config", "reason", warning)
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	// Mask secrets before they reach the model, saved sessions or the log
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		return fmt.Errorf("setting up redaction: %w", err)
+	}
+	logger = logging.WithRedaction(logger, redactor)
+
+	// Directories added on the command line join the workspace, and the
+	// sandbox lets bash write to them too
+	cfg.Workspace.Dirs = append(cfg.Workspace.Dirs, addDirs...)
+	cfg.Sandbox.Writable = append(cfg.Sandbox.Writable, addDirs...)
+
+	// The --sandbox flag overrides the config file either way
+	if cmd.Flags().Changed("sandbox") {
+		cfg.Sandbox.Enabled = sandboxFlag
+	}
+	var sb *sandbox.Sandbox
+	if cfg.Sandbox.Enabled {
+		sb, err = sandbox.New(workDir, cfg.Sandbox)
+		if err != nil {
+			return fmt.Errorf("setting up sandbox: %w", err)
+		}
+		logger.Info("bash sandbox enabled", "restrictions", sb.Describe())
+	}
+
 	// Set up LSP registry and start background detection
 	lspRegistry := lsp.NewRegistry()
 	go lspRegistry.DetectAvailable(context.Background())
@@ -81,27 +130,41 @@ func runTUI(cmd *cobra.Command, args []string) error {
 	// Create todo store for task tracking
 	todoStore := todo.NewStore()
 
-	registry := tool.NewRegistry()
-	tools := []tool.Tool{
-		&tool.ReadTool{},
-		&tool.MultiReadTool{},
-		&tool.WriteTool{},
-		&tool.EditTool{},
-		&tool.MoveTool{},
-		&tool.DiffTool{},
-		&tool.UndoTool{},
-		&tool.BashTool{WorkDir: workDir},
-		&tool.GitTool{WorkDir: workDir},
-		&tool.GlobTool{WorkDir: workDir},
-		&tool.GrepTool{WorkDir: workDir},
-		&tool.ListDirTool{WorkDir: workDir},
-		&tool.TreeTool{WorkDir: workDir},
-		&tool.TodoTool{Store: todoStore},
-		&tool.WebFetchTool{},
-		&tool.WebSearchTool{},
-		lspTool,
+	// Bash commands get milo's environment minus anything that looks like a secret
+	bashEnv, stripped := cfg.Bash.Env.Apply(os.Environ())
+	if len(stripped) > 0 {
+		logger.Info("stripped variables from bash environment", "names", stripped)
+	}
+
+	// Background jobs started by the bash tool are killed on exit
+	jobs := tool.NewJobManager()
+	jobs.Sandbox = sb
+	jobs.Limits = cfg.Bash.Limits
+	jobs.Env = bashEnv
+	defer func() {
+		if err := jobs.Close(); err != nil {
+			logger.Warn("killing background jobs", "error", err)
+		}
+	}()
+
+	// Optionally keep one shell alive so exports and cd carry over between commands
+	var shell *tool.Shell
+	if persistentShell {
+		shell = tool.NewShell(workDir)
+		shell.Sandbox = sb
+		shell.Limits = cfg.Bash.Limits
+		shell.Env = bashEnv
+		defer func() {
+			if err := shell.Close(); err != nil {
+				logger.Warn("closing shell", "error", err)
+			}
+		}()
 	}
-	for _, t := range tools {
+
+	bash := &tool.BashTool{WorkDir: workDir, Jobs: jobs, Shell: shell, Sandbox: sb, Limits: cfg.Bash.Limits, Env: bashEnv}
+	webFetch := &tool.WebFetchTool{Config: cfg.WebFetch}
+	registry := tool.NewRegistry()
+	for _, t := range builtinTools(workDir, bash, webFetch, lspTool, jobs, todoStore) {
 		if err := registry.Register(t); err != nil {
 			return fmt.Errorf("registering tool %s: %w", t.Name(), err)
 		}
@@ -111,6 +174,18 @@ func runTUI(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("setting up permissions: %w", err)
 	}
+	for _, warning := range perms.Warnings() {
+		logger.Warn("skipped permission rules", "error", warning)
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s\n", warning)
+	}
+	perms.SetSubjects(registry.PermissionSubjects)
+	perms.SetBashDir(bash.CurrentDir)
+	webFetch.CheckRedirect = redirectChecker(perms)
+	perms.SetSandboxed(sb != nil && cfg.Sandbox.Confined())
+	perms.SetEnvScrubbed(cfg.Bash.Env.ScrubsSecrets())
+	if err := perms.SetWorkspace(cfg.Workspace); err != nil {
+		return fmt.Errorf("setting up workspace: %w", err)
+	}
 
 	if os.Getenv("ANTHROPIC_API_KEY") == "" {
 		return errors.New("ANTHROPIC_API_KEY environment variable is not set, " +
@@ -123,23 +198,33 @@ func runTUI(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("setting up session store: %w", err)
 	}
+	store.SetRedactor(redactor)
 
 	// Determine which session to use.
+	if forkFlag != "" && (resumeFlag != "" || newSession) {
+		return errors.New("--fork can't be combined with --resume or --new")
+	}
 	var sess *session.Session
-	if !newSession {
-		if resumeFlag != "" {
-			// Resume a specific session.
-			if resumeFlag == "last" {
-				sess, err = store.MostRecent()
-				if err != nil {
-					return fmt.Errorf("loading most recent session: %w", err)
-				}
-			} else {
-				sess, err = store.Load(resumeFlag)
-				if err != nil {
-					return fmt.Errorf("loading session %q: %w", resumeFlag, err)
-				}
-			}
+	switch {
+	case forkFlag != "":
+		parent, err := findSession(store, forkFlag)
+		if err != nil {
+			return err
+		}
+		if parent == nil {
+			return errors.New("no saved sessions to fork")
+		}
+		sess, err = parent.Fork()
+		if err != nil {
+			return fmt.Errorf("forking session %q: %w", parent.ID, err)
+		}
+		if err := store.Save(sess); err != nil {
+			return fmt.Errorf("saving forked session: %w", err)
+		}
+		logger.Info("forked session", "id", sess.ID, "parent", parent.ID, "messages", sess.MessageCount())
+	case !newSession && resumeFlag != "":
+		if sess, err = findSession(store, resumeFlag); err != nil {
+			return err
 		}
 	}
 
@@ -150,25 +235,155 @@ func runTUI(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("creating new session: %w", err)
 		}
 		logger.Info("created new session", "id", sess.ID)
-	} else {
+	} else if forkFlag == "" {
 		logger.Info("resumed session", "id", sess.ID, "messages", sess.MessageCount())
 	}
+	if sess.Skipped > 0 {
+		logger.Warn("skipped malformed transcript lines", "id", sess.ID, "lines", sess.Skipped)
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d malformed lines in the transcript of session %s\n", sess.Skipped, sess.ID)
+	}
+	if sess.GitStart == nil {
+		sess.SetGit(session.CurrentGit(workDir))
+	}
+	pruneSessions(store, workDir, cfg.Sessions.Retention, sess.ID, logger)
+
+	// Snapshot the working tree before each turn in a shadow repository.
+	var checkpoints *checkpoint.Repo
+	if !cfg.Checkpoints.Disabled {
+		if checkpoints, err = checkpoint.Open(context.Background(), workDir); err != nil {
+			logger.Warn("checkpoints disabled", "error", err)
+			fmt.Fprintf(os.Stderr, "Warning: %v; workspace checkpoints are off\n", err)
+		}
+	}
 
 	client := anthropic.NewClient()
 
 	model := agent.DefaultModel
-	if modelFlag != "" {
+	switch {
+	case modelFlag != "":
 		model = anthropic.Model(modelFlag)
+	case sess.Model != "":
+		// A resumed session carries on with the model it last used.
+		model = anthropic.Model(sess.Model)
 	}
 
 	ag := agent.New(client, registry, perms, workDir, logger, model, todoStore)
+	ag.SetRedactor(redactor)
 
-	// Restore session messages if resuming.
+	// Every permission decision goes to an append-only audit log
+	auditLog, err := audit.Open(audit.FileForWorkDir(workDir))
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	defer func() {
+		if err := auditLog.Close(); err != nil {
+			logger.Warn("closing audit log", "error", err)
+		}
+	}()
+	ag.SetAudit(auditLog, sess.ID)
+
+	// Restore the task list and undo history, and the messages if resuming.
+	runner.RestoreState(sess, todoStore, tool.DefaultFileHistory)
 	if sess != nil && len(sess.Messages) > 0 {
 		ag.SetMessages(sess.Messages)
-		fmt.Printf("Session restored (%s) with %d messages\n\n", sess.ID, len(sess.Messages))
+		if forkFlag != "" {
+			fmt.Printf("Session %s forked from %s with %d messages\n\n", sess.ID, sess.ParentID, len(sess.Messages))
+		} else {
+			fmt.Printf("Session restored (%s) with %d messages\n\n", sess.ID, len(sess.Messages))
+		}
 	}
 
-	r := runner.New(ag, workDir, store, sess)
+	r := runner.New(ag, workDir, store, sess, jobs, shell)
+	r.SetCheckpoints(checkpoints)
 	return r.Run()
 }
+
+// builtinTools returns every built-in tool. milo and 'milo permissions test'
+// both register these, so the test sees the same tools, and the same
+// permission subjects, as a session.
+func builtinTools(workDir string, bash *tool.BashTool, webFetch *tool.WebFetchTool, lspTool *tool.LSPTool, jobs *tool.JobManager, todos *todo.Store) []tool.Tool {
+	return []tool.Tool{
+		&tool.ReadTool{},
+		&tool.MultiReadTool{},
+		&tool.WriteTool{},
+		&tool.EditTool{},
+		&tool.MoveTool{},
+		&tool.DiffTool{},
+		&tool.UndoTool{},
+		bash,
+		&tool.JobTool{Jobs: jobs},
+		&tool.GitTool{WorkDir: workDir},
+		&tool.GlobTool{WorkDir: workDir},
+		&tool.GrepTool{WorkDir: workDir},
+		&tool.ListDirTool{WorkDir: workDir},
+		&tool.TreeTool{WorkDir: workDir},
+		&tool.TodoTool{Store: todos},
+		webFetch,
+		&tool.WebSearchTool{},
+		lspTool,
+	}
+}
+
+// redirectChecker only lets web_fetch follow a redirect to another host
+// when the permission rules allow fetching it without asking, since the
+// redirect can't stop for a prompt.
+func redirectChecker(perms *permission.Checker) func(url string) error {
+	return func(url string) error {
+		switch perms.Check("web_fetch", permission.ToolInput("web_fetch", url)) {
+		case permission.Allow:
+			return nil
+		case permission.Deny:
+			return fmt.Errorf("redirect to %s is denied by a permission rule", url)
+		default:
+			return fmt.Errorf("redirected to %s, which needs permission; fetch it directly to ask", url)
+		}
+	}
+}
+
+// pruneSessions applies the configured retention policy, never pruning the
+// session about to be used, and drops the pruned sessions' checkpoints.
+// Failing to prune doesn't stop milo starting.
+func pruneSessions(store *session.Store, workDir string, retention session.Retention, current string, logger *slog.Logger) {
+	if !retention.Enabled() {
+		return
+	}
+	policy, err := retention.Policy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	policy.Exclude = []string{current}
+	pruned, archive, err := store.Prune(policy, time.Now())
+	if err != nil {
+		logger.Warn("pruning sessions", "error", err)
+		fmt.Fprintf(os.Stderr, "Warning: pruning sessions: %v\n", err)
+		return
+	}
+	if len(pruned) > 0 {
+		logger.Info("pruned sessions", "count", len(pruned), "archive", archive)
+		if err := forgetCheckpoints(workDir, summaryIDs(pruned)); err != nil {
+			logger.Warn("removing checkpoints of pruned sessions", "error", err)
+		}
+	}
+}
+
+// findSession loads a session by ID or unique title prefix, or the most
+// recent one for "last", which is nil when there are no sessions.
+func findSession(store *session.Store, ref string) (*session.Session, error) {
+	if ref != "last" {
+		id, err := store.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := store.Load(id)
+		if err != nil {
+			return nil, fmt.Errorf("loading session %q: %w", id, err)
+		}
+		return sess, nil
+	}
+	sess, err := store.MostRecent()
+	if err != nil {
+		return nil, fmt.Errorf("loading most recent session: %w", err)
+	}
+	return sess, nil
+}
@@ -1,49 +1,187 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/zhubert/milo/internal/checkpoint"
+	"github.com/zhubert/milo/internal/config"
+	"github.com/zhubert/milo/internal/redact"
+	"github.com/zhubert/milo/internal/runner"
 	"github.com/zhubert/milo/internal/session"
 )
 
 var sessionsCmd = &cobra.Command{
 	Use:   "sessions",
 	Short: "List saved sessions",
-	Long:  `List all saved conversation sessions for the current project.`,
-	RunE:  runSessions,
+	Long: `List all saved conversation sessions for the current project, with the models
+they used, the git branch and commit they started and ended on, the files
+they wrote or edited, their token usage and cost, and how their last turn ended.`,
+	Example: `  milo sessions --branch fix-lsp
+  milo sessions --touched internal/lsp`,
+	Args: cobra.NoArgs,
+	RunE: runSessions,
 }
 
+var sessionsSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search saved sessions",
+	Long: `Search the titles and messages of saved sessions for text, ignoring case.
+Matching sessions are listed newest first with excerpts of the matching messages.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSessionsSearch,
+}
+
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <id>",
+	Short: "Export a session as Markdown, HTML or JSON",
+	Long: `Export a saved session's transcript: your messages and the assistant's replies,
+tool calls with their inputs, tool outputs (collapsible in Markdown and HTML),
+context compactions, and token usage and cost.
+
+With --redact, secrets are masked and the project and home directories are
+replaced by <project> and ~, so the export can be shared.`,
+	Example: `  milo sessions export 3f2a1b4c > session.md
+  milo sessions export 3f2a1b4c --format html --redact -o review.html
+  milo sessions export last --format json`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runSessionsExport,
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:          "show <id>",
+	Short:        "Show a session's transcript",
+	Long:         `Render a saved session's transcript in the terminal.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runSessionsShow,
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:          "delete <id>...",
+	Short:        "Delete saved sessions",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runSessionsDelete,
+}
+
+var sessionsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete or archive old sessions",
+	Long: `Delete sessions not updated within --older-than, except the --keep most
+recently updated ones. With only --keep, every older session is pruned.
+Without either flag, the retention policy in the config file is applied:
+
+  sessions:
+    retention:
+      max_age: 30d
+      keep: 50
+      archive: true
+
+With --archive, pruned sessions are bundled into a .tar.gz file under
+.milo/sessions/archive instead of being lost. Extracting it into
+.milo/sessions brings them back.`,
+	Example: `  milo sessions prune --older-than 30d --keep 50
+  milo sessions prune --keep 20 --archive
+  milo sessions prune --older-than 2w --dry-run`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runSessionsPrune,
+}
+
+// searchSnippets is how many matching messages are shown per session.
+const searchSnippets = 3
+
+var (
+	sessionsBranch  string
+	sessionsTouched string
+
+	exportFormat string
+	exportOutput string
+	exportRedact bool
+
+	pruneOlderThan string
+	pruneKeep      int
+	pruneArchive   bool
+	pruneDryRun    bool
+)
+
 func init() {
+	sessionsCmd.Flags().StringVar(&sessionsBranch, "branch", "", "only sessions that started or ended on this git branch")
+	sessionsCmd.Flags().StringVar(&sessionsTouched, "touched", "", "only sessions that wrote or edited this file, or a file under this directory")
+	sessionsExportCmd.Flags().StringVarP(&exportFormat, "format", "f", "md", "output format: md, html or json")
+	sessionsExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "write to this file instead of stdout")
+	sessionsExportCmd.Flags().BoolVar(&exportRedact, "redact", false, "mask secrets and replace the project and home directories")
+	sessionsShowCmd.Flags().BoolVar(&exportRedact, "redact", false, "mask secrets and replace the project and home directories")
+	sessionsPruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "prune sessions not updated for this long, such as 30d, 2w or 36h")
+	sessionsPruneCmd.Flags().IntVar(&pruneKeep, "keep", 0, "never prune this many of the most recent sessions")
+	sessionsPruneCmd.Flags().BoolVar(&pruneArchive, "archive", false, "bundle pruned sessions into a compressed archive instead of deleting them")
+	sessionsPruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "list the sessions that would be pruned without pruning them")
+
+	sessionsCmd.AddCommand(sessionsSearchCmd)
+	sessionsCmd.AddCommand(sessionsExportCmd)
+	sessionsCmd.AddCommand(sessionsShowCmd)
+	sessionsCmd.AddCommand(sessionsDeleteCmd)
+	sessionsCmd.AddCommand(sessionsPruneCmd)
 	rootCmd.AddCommand(sessionsCmd)
 }
 
-func runSessions(cmd *cobra.Command, args []string) error {
+// openSessionStore opens the session store for the current directory.
+func openSessionStore() (*session.Store, string, error) {
 	workDir, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("getting working directory: %w", err)
+		return nil, "", fmt.Errorf("getting working directory: %w", err)
 	}
 
 	store, err := session.StoreForWorkDir(workDir)
 	if err != nil {
-		return fmt.Errorf("opening session store: %w", err)
+		return nil, "", fmt.Errorf("opening session store: %w", err)
 	}
+	return store, workDir, nil
+}
 
-	summaries, err := store.List()
+func runSessions(cmd *cobra.Command, args []string) error {
+	store, workDir, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	all, err := store.List()
 	if err != nil {
 		return fmt.Errorf("listing sessions: %w", err)
 	}
 
+	filter := session.Filter{Branch: sessionsBranch, Touched: sessionsTouched}
+	if filepath.IsAbs(filter.Touched) {
+		if rel, err := filepath.Rel(workDir, filter.Touched); err == nil {
+			filter.Touched = rel
+		}
+	}
+	var summaries []session.Summary
+	for _, s := range all {
+		if filter.Matches(s) {
+			summaries = append(summaries, s)
+		}
+	}
+
 	if len(summaries) == 0 {
-		fmt.Println("No saved sessions.")
+		if len(all) > 0 {
+			fmt.Println("No sessions match.")
+		} else {
+			fmt.Println("No saved sessions.")
+		}
 		return nil
 	}
 
-	fmt.Printf("%-10s  %-20s  %-8s  %s\n", "ID", "UPDATED", "MESSAGES", "TITLE")
-	fmt.Println("─────────────────────────────────────────────────────────────────────")
+	fmt.Printf("%-10s  %-20s  %-8s  %-20s  %-8s  %s\n", "ID", "UPDATED", "MESSAGES", "BRANCH", "COST", "TITLE")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────────────────────")
 
 	for _, s := range summaries {
 		title := s.Title
@@ -53,21 +191,297 @@ func runSessions(cmd *cobra.Command, args []string) error {
 		if len(title) > 40 {
 			title = title[:37] + "..."
 		}
-		fmt.Printf("%-10s  %-20s  %-8d  %s\n",
+		branch := ""
+		if git := s.GitEnd; git != nil {
+			branch = git.Branch
+		}
+		if len(branch) > 20 {
+			branch = branch[:17] + "..."
+		}
+		cost := ""
+		if s.Cost > 0 {
+			cost = fmt.Sprintf("$%.2f", s.Cost)
+		}
+		fmt.Printf("%-10s  %-20s  %-8d  %-20s  %-8s  %s\n",
 			s.ID,
 			formatTime(s.UpdatedAt),
 			s.MessageCount,
+			branch,
+			cost,
 			title,
 		)
+		if details := sessionDetails(s); details != "" {
+			fmt.Printf("%-10s  %s\n", "", details)
+		}
+		if s.ParentID != "" {
+			fmt.Printf("%-10s  ↳ forked from %s at message %d\n", "", s.ParentID, s.BranchPoint)
+		}
 	}
 
 	fmt.Println()
-	fmt.Println("Resume a session with: milo --resume <id>")
+	fmt.Println("Resume a session with: milo --resume <id or title>")
 	fmt.Println("Resume the most recent: milo --resume last")
+	fmt.Println("Start a copy of a session: milo --fork <id>")
+
+	return nil
+}
+
+// sessionDetails describes a session's models, git state, files, usage and
+// how its last turn ended, on one line.
+func sessionDetails(s session.Summary) string {
+	var parts []string
+	if len(s.Models) > 0 {
+		parts = append(parts, strings.Join(s.Models, ", "))
+	}
+	if start, end := s.GitStart.String(), s.GitEnd.String(); start != "" {
+		if end != "" && end != start {
+			start += " → " + end
+		}
+		parts = append(parts, start)
+	}
+	switch n := len(s.FilesTouched); n {
+	case 0:
+	case 1:
+		parts = append(parts, s.FilesTouched[0])
+	default:
+		parts = append(parts, fmt.Sprintf("%d files", n))
+	}
+	if s.InputTokens > 0 || s.OutputTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d in / %d out tokens", s.InputTokens, s.OutputTokens))
+	}
+	if s.LastStatus != "" && s.LastStatus != session.StatusCompleted {
+		parts = append(parts, "last turn "+string(s.LastStatus))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func runSessionsSearch(cmd *cobra.Command, args []string) error {
+	store, _, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	query := strings.Join(args, " ")
+	matches, err := store.Search(query, searchSnippets)
+	if err != nil {
+		return fmt.Errorf("searching sessions: %w", err)
+	}
+
+	if len(matches) == 0 {
+		fmt.Printf("No sessions match %q.\n", query)
+		return nil
+	}
+
+	for _, m := range matches {
+		title := m.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Printf("%-10s  %-20s  %s\n", m.ID, formatTime(m.UpdatedAt), title)
+		for _, snippet := range m.Snippets {
+			fmt.Printf("%-10s  %s\n", "", snippet)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Resume a session with: milo --resume <id>")
+
+	return nil
+}
+
+func runSessionsExport(cmd *cobra.Command, args []string) error {
+	format, err := session.ParseExportFormat(exportFormat)
+	if err != nil {
+		return err
+	}
+	exp, err := buildExport(args[0])
+	if err != nil {
+		return err
+	}
 
+	if exportOutput == "" {
+		return exp.Write(os.Stdout, format)
+	}
+	f, err := os.Create(exportOutput)
+	if err != nil {
+		return fmt.Errorf("creating export file: %w", err)
+	}
+	if err := exp.Write(f, format); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing export: %w", err)
+	}
+	return f.Close()
+}
+
+func runSessionsShow(cmd *cobra.Command, args []string) error {
+	exp, err := buildExport(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(runner.RenderMarkdown(exp.Markdown(false)))
+	return nil
+}
+
+func runSessionsDelete(cmd *cobra.Command, args []string) error {
+	store, workDir, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		return fmt.Errorf("listing sessions: %w", err)
+	}
+	known := make(map[string]bool, len(summaries))
+	for _, s := range summaries {
+		known[s.ID] = true
+	}
+	// Check every ID before deleting any, so a typo deletes nothing.
+	for _, id := range args {
+		if !known[id] {
+			return fmt.Errorf("session %q not found", id)
+		}
+	}
+
+	for _, id := range args {
+		if err := store.Delete(id); err != nil {
+			return fmt.Errorf("deleting session %q: %w", id, err)
+		}
+		fmt.Printf("Deleted session %s\n", id)
+	}
+	if err := forgetCheckpoints(workDir, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: removing checkpoints: %v\n", err)
+	}
+	return nil
+}
+
+func runSessionsPrune(cmd *cobra.Command, args []string) error {
+	store, workDir, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+
+	retention := session.Retention{MaxAge: pruneOlderThan, Keep: pruneKeep, Archive: pruneArchive}
+	if !retention.Enabled() {
+		cfg, err := config.Load(workDir)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		retention = cfg.Sessions.Retention
+		retention.Archive = retention.Archive || pruneArchive
+		if !retention.Enabled() {
+			return fmt.Errorf("give --older-than or --keep, or set sessions.retention in the config file")
+		}
+	}
+	policy, err := retention.Policy()
+	if err != nil {
+		return err
+	}
+
+	if pruneDryRun {
+		summaries, err := store.List()
+		if err != nil {
+			return fmt.Errorf("listing sessions: %w", err)
+		}
+		pruned := policy.Select(summaries, time.Now())
+		if len(pruned) == 0 {
+			fmt.Println("No sessions to prune.")
+			return nil
+		}
+		for _, s := range pruned {
+			fmt.Printf("%-10s  %-20s  %s\n", s.ID, formatTime(s.UpdatedAt), s.Title)
+		}
+		fmt.Printf("\n%d sessions would be pruned.\n", len(pruned))
+		return nil
+	}
+
+	pruned, archive, err := store.Prune(policy, time.Now())
+	if err != nil {
+		return fmt.Errorf("pruning sessions: %w", err)
+	}
+	if err := forgetCheckpoints(workDir, summaryIDs(pruned)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: removing checkpoints: %v\n", err)
+	}
+	switch {
+	case len(pruned) == 0:
+		fmt.Println("No sessions to prune.")
+	case archive != "":
+		fmt.Printf("Archived %d sessions to %s\n", len(pruned), archive)
+	default:
+		fmt.Printf("Deleted %d sessions.\n", len(pruned))
+	}
 	return nil
 }
 
+// forgetCheckpoints drops the workspace checkpoints of deleted sessions,
+// if the project has any.
+func forgetCheckpoints(workDir string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(checkpoint.ForWorkDir(workDir)); err != nil {
+		return nil
+	}
+	ctx := context.Background()
+	repo, err := checkpoint.Open(ctx, workDir)
+	if err != nil {
+		return err
+	}
+	return repo.Forget(ctx, ids...)
+}
+
+// summaryIDs returns the IDs of the sessions summarized.
+func summaryIDs(summaries []session.Summary) []string {
+	ids := make([]string, len(summaries))
+	for i, s := range summaries {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// buildExport loads a session by ID, title prefix or "last", and builds
+// its export, redacted if --redact was given.
+func buildExport(ref string) (session.Export, error) {
+	store, workDir, err := openSessionStore()
+	if err != nil {
+		return session.Export{}, err
+	}
+
+	var id string
+	if ref == "last" {
+		summaries, err := store.List()
+		if err != nil {
+			return session.Export{}, fmt.Errorf("listing sessions: %w", err)
+		}
+		if len(summaries) == 0 {
+			return session.Export{}, fmt.Errorf("no saved sessions")
+		}
+		id = summaries[0].ID
+	} else if id, err = store.Resolve(ref); err != nil {
+		return session.Export{}, err
+	}
+	summary, events, err := store.Transcript(id)
+	if err != nil {
+		return session.Export{}, err
+	}
+
+	var opts session.ExportOptions
+	if exportRedact {
+		cfg, err := config.Load(workDir)
+		if err != nil {
+			return session.Export{}, fmt.Errorf("loading config: %w", err)
+		}
+		if opts.Redactor, err = redact.New(cfg.Redact); err != nil {
+			return session.Export{}, fmt.Errorf("setting up redaction: %w", err)
+		}
+		opts.Paths = map[string]string{workDir: "<project>"}
+		if home, err := os.UserHomeDir(); err == nil {
+			opts.Paths[home] = "~"
+		}
+	}
+	return session.NewExport(summary, events, opts), nil
+}
+
 func formatTime(t time.Time) string {
 	now := time.Now()
 	diff := now.Sub(t)
@@ -3,13 +3,17 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/zhubert/milo/internal/audit"
 	ctxmgr "github.com/zhubert/milo/internal/context"
 	"github.com/zhubert/milo/internal/loopdetector"
 	"github.com/zhubert/milo/internal/permission"
+	"github.com/zhubert/milo/internal/redact"
 	"github.com/zhubert/milo/internal/todo"
 	"github.com/zhubert/milo/internal/tool"
 )
@@ -31,6 +35,7 @@ const (
 	ChunkParallelProgress
 	ChunkContextCompacted
 	ChunkTodoUpdate
+	ChunkSnapshot
 	ChunkDone
 	ChunkError
 )
@@ -55,17 +60,33 @@ type StreamChunk struct {
 	Usage            *Usage                   // For ChunkDone - token usage for this turn
 	CompactionInfo   *ctxmgr.CompactionResult // For ChunkContextCompacted
 	Todos            []todo.Todo              // For ChunkTodoUpdate
+	Dir              string                   // For ChunkPermissionRequest - directory the tool runs in, if it can change
+	Redacted         []string                 // For ChunkToolResult - kinds of secrets masked in the output
+	Reason           string                   // For ChunkPermissionRequest - why the permission system is asking
+	Suggestion       *permission.Rule         // For ChunkPermissionRequest - a broader rule the user could allow instead
+	Approvals        int                      // For ChunkPermissionRequest - past approvals of calls Suggestion covers
+	Messages         []anthropic.MessageParam // For ChunkSnapshot - a copy of the conversation to save
 }
 
-// PermissionResponse is the user's answer to a permission request.
-type PermissionResponse int
+// PermissionAnswer is the user's choice at a permission prompt.
+type PermissionAnswer int
 
 const (
-	PermissionGranted       PermissionResponse = iota // Allow this once
-	PermissionDenied                                  // Deny this once
-	PermissionGrantedAlways                           // Allow always for this session
+	PermissionGranted       PermissionAnswer = iota // Allow this once
+	PermissionDenied                                // Deny this once
+	PermissionGrantedAlways                         // Allow from now on, within Scope
+	PermissionEdited                                // Allow once with the input the user edited
 )
 
+// PermissionResponse is the user's answer to a permission request.
+type PermissionResponse struct {
+	Answer   PermissionAnswer
+	Feedback string           // For PermissionDenied - why, passed to the model as the tool result
+	Input    json.RawMessage  // For PermissionEdited - the tool input to run instead
+	Scope    permission.Scope // For PermissionGrantedAlways - how long the grant lasts
+	Rule     *permission.Rule // For PermissionGrantedAlways - a rule to allow instead of this exact call
+}
+
 // Agent is the core agentic loop that sends messages to Claude,
 // streams the response, executes tools, and loops until done.
 type Agent struct {
@@ -77,6 +98,11 @@ type Agent struct {
 	executor  *tool.ToolExecutor
 	ctxMgr    *ctxmgr.Manager
 	todoStore *todo.Store
+	redactor  *redact.Redactor
+	audit     *audit.Log
+	sessionID string
+	historyMu sync.Mutex
+	history   []permission.Answer // Past prompt answers in this project
 	workDir   string
 	logger    *slog.Logger
 	model     anthropic.Model
@@ -139,6 +165,62 @@ func modelDisplayName(model anthropic.Model) string {
 	}
 }
 
+// SetRedactor sets the redactor applied to tool results before they are
+// sent to the model. A nil redactor leaves results unchanged.
+func (a *Agent) SetRedactor(r *redact.Redactor) {
+	a.redactor = r
+}
+
+// SetAudit sets the log every permission decision is recorded in, tagged
+// with sessionID. A nil log records nothing. Past prompt answers in the
+// log are loaded to learn rule suggestions from.
+func (a *Agent) SetAudit(log *audit.Log, sessionID string) {
+	a.audit = log
+	a.sessionID = sessionID
+	if log == nil {
+		return
+	}
+
+	entries, err := audit.Read(log.Path(), audit.Filter{Decision: "ask"})
+	if err != nil {
+		a.logger.Warn("reading permission history", "error", err)
+		return
+	}
+	a.historyMu.Lock()
+	defer a.historyMu.Unlock()
+	for _, e := range entries {
+		if e.Response != audit.ResponseCancelled {
+			a.history = append(a.history, permission.Answer{Tool: e.Tool, Input: e.Input, Approved: e.Allowed})
+		}
+	}
+}
+
+// RuleSuggestions returns broader rules the user has approved calls for
+// repeatedly in this project, and never denied.
+func (a *Agent) RuleSuggestions() []permission.Suggestion {
+	a.historyMu.Lock()
+	history := append([]permission.Answer(nil), a.history...)
+	a.historyMu.Unlock()
+	return a.perms.Suggestions(history, permission.MinApprovals)
+}
+
+// approvalsFor returns how many past prompts for calls that rule covers
+// were approved, or 0 if any was denied.
+func (a *Agent) approvalsFor(rule *permission.Rule) int {
+	if rule == nil {
+		return 0
+	}
+	a.historyMu.Lock()
+	history := append([]permission.Answer(nil), a.history...)
+	a.historyMu.Unlock()
+	for _, s := range a.perms.Suggestions(history, 1) {
+		if s.Rule.Key() == rule.Key() {
+			return s.Approved
+		}
+	}
+	return 0
+}
+
 // Permissions returns the permission checker for this agent.
 func (a *Agent) Permissions() *permission.Checker {
 	return a.perms
@@ -201,8 +283,13 @@ func (a *Agent) SendMessage(ctx context.Context, userMsg string) <-chan StreamCh
 	a.conv.AddUserMessage(userMsg)
 	a.detector.Reset() // Reset doom loop detector for new request
 
+	// Snapshot before the loop starts, so the user's message is saved
+	// even if the turn never completes.
+	snapshot := StreamChunk{Type: ChunkSnapshot, Messages: a.conv.Messages()}
+
 	go func() {
 		defer close(ch)
+		ch <- snapshot
 		a.loop(ctx, ch)
 	}()
 
@@ -380,41 +467,146 @@ func (a *Agent) loop(ctx context.Context, ch chan<- StreamChunk) {
 		}
 
 		a.conv.AddToolResult(resultBlocks...)
+		ch <- StreamChunk{Type: ChunkSnapshot, Messages: a.conv.Messages()}
 		// Loop continues — Claude will see the tool results.
 	}
 }
 
+// permissionOutcome is the result of a permission check.
+type permissionOutcome struct {
+	allowed bool
+	// input is what the tool runs with, which the user may have edited.
+	input  json.RawMessage
+	edited bool
+	// denial is the tool result sent to the model when not allowed.
+	denial string
+}
+
+// fileContentTools return file contents the model may quote back as an
+// edit's old_string. Their output skips the high-entropy detector, since
+// a masked hash or fixture would no longer match the file.
+var fileContentTools = map[string]bool{"read": true, "multi_read": true, "grep": true}
+
 // checkPermission evaluates the permission for a tool and, if needed,
 // sends a permission request and blocks until the user responds.
-// Returns true if the tool is allowed to execute.
-func (a *Agent) checkPermission(ctx context.Context, ch chan<- StreamChunk, toolName string, toolInput json.RawMessage) bool {
-	action := a.perms.Check(toolName, toolInput)
-	switch action {
+func (a *Agent) checkPermission(ctx context.Context, ch chan<- StreamChunk, toolName string, toolInput json.RawMessage, dir string) permissionOutcome {
+	allow := permissionOutcome{allowed: true, input: toolInput}
+
+	decision := a.perms.Decide(toolName, toolInput)
+	switch decision.Action {
 	case permission.Allow:
-		return true
+		a.recordDecision(toolName, decision, audit.Entry{Allowed: true})
+		return allow
 	case permission.Deny:
-		return false
-	case permission.Ask:
-		ch <- StreamChunk{Type: ChunkPermissionRequest, ToolName: toolName, ToolInput: string(toolInput)}
-
-		select {
-		case resp := <-a.PermResp:
-			switch resp {
-			case PermissionGranted:
-				return true
-			case PermissionGrantedAlways:
-				if err := a.perms.AllowAlways(toolName, toolInput); err != nil {
-					a.logger.Warn("failed to persist permission", "error", err)
-				}
-				return true
-			default:
-				return false
-			}
-		case <-ctx.Done():
-			return false
+		a.logger.Info("permission denied by rule", "tool", toolName, "reason", decision.Reason)
+		a.recordDecision(toolName, decision, audit.Entry{})
+		return permissionOutcome{denial: "permission denied: " + decision.Reason}
+	}
+
+	suggestion := a.perms.SuggestRule(toolName, toolInput)
+	ch <- StreamChunk{
+		Type:       ChunkPermissionRequest,
+		ToolName:   toolName,
+		ToolInput:  string(toolInput),
+		Dir:        dir,
+		Reason:     decision.Reason,
+		Suggestion: suggestion,
+		Approvals:  a.approvalsFor(suggestion),
+	}
+
+	var resp PermissionResponse
+	select {
+	case resp = <-a.PermResp:
+	case <-ctx.Done():
+		a.recordDecision(toolName, decision, audit.Entry{Response: audit.ResponseCancelled})
+		return permissionOutcome{denial: "permission request cancelled"}
+	}
+
+	switch resp.Answer {
+	case PermissionGranted:
+		a.recordDecision(toolName, decision, audit.Entry{Response: audit.ResponseAllow, Allowed: true})
+		return allow
+
+	case PermissionGrantedAlways:
+		scope := resp.Scope
+		granted, err := a.perms.Grant(toolName, toolInput, resp.Rule, scope)
+		if errors.Is(err, permission.ErrManagedPolicy) {
+			scope = permission.ScopeSession
+		}
+		if err != nil {
+			a.logger.Warn("failed to grant permission", "error", err)
+		}
+		entry := audit.Entry{Response: audit.ResponseAlways, Allowed: true}
+		if granted.Tool != "" { // A refused grant still allows this call.
+			entry.Grant = fmt.Sprintf("%s (%s)", granted.String(), scope)
+		}
+		a.recordDecision(toolName, decision, entry)
+		return allow
+
+	case PermissionEdited:
+		// The edited call is a new call: it is normalized and checked
+		// against the rules again, so deny rules and the workspace boundary
+		// still apply and anything that asks is asked about again.
+		edited := a.normalizeInput(toolName, resp.Input)
+		outcome := a.checkPermission(ctx, ch, toolName, edited, dir)
+		if outcome.allowed {
+			edited = outcome.input // The user may have edited it again.
 		}
+		entry := audit.Entry{Response: audit.ResponseEdit, Allowed: outcome.allowed}
+		entry.Edited, _ = a.redactor.Redact(string(edited))
+		a.recordDecision(toolName, decision, entry)
+		if !outcome.allowed {
+			outcome.denial = "the user edited this call, but the edited version was not allowed: " + outcome.denial
+			return outcome
+		}
+		outcome.edited = true
+		return outcome
+
+	default:
+		a.recordDecision(toolName, decision, audit.Entry{Response: audit.ResponseDeny, Feedback: resp.Feedback})
+		if resp.Feedback != "" {
+			return permissionOutcome{denial: "The user denied this tool call and said: " + resp.Feedback}
+		}
+		return permissionOutcome{denial: "permission denied by user"}
+	}
+}
+
+// normalizeInput applies the tool's input normalization, if it has one,
+// so an edited call is checked the same way as one from the model.
+func (a *Agent) normalizeInput(toolName string, input json.RawMessage) json.RawMessage {
+	if normalizer, ok := a.registry.Lookup(toolName).(tool.InputNormalizer); ok {
+		return normalizer.NormalizeInput(input)
+	}
+	return input
+}
+
+// recordDecision appends a permission decision to the audit log. entry
+// carries what happened after the rules decided: the user's response, if
+// they were asked, and whether the tool ran.
+func (a *Agent) recordDecision(toolName string, d permission.Decision, entry audit.Entry) {
+	if entry.Response != "" && entry.Response != audit.ResponseCancelled {
+		a.historyMu.Lock()
+		a.history = append(a.history, permission.Answer{Tool: toolName, Input: d.Input, Approved: entry.Allowed})
+		a.historyMu.Unlock()
+	}
+	if a.audit == nil {
+		return
+	}
+
+	entry.SessionID = a.sessionID
+	entry.Tool = toolName
+	entry.Input, _ = a.redactor.Redact(d.Input)
+	entry.Action = d.Action.String()
+	entry.Reason = d.Reason
+	entry.Prompted = entry.Response != ""
+	entry.Feedback, _ = a.redactor.Redact(entry.Feedback)
+	if d.Rule != nil {
+		entry.Rule = d.Rule.String()
+		entry.Source = d.Rule.Source
+	}
+	if err := a.audit.Record(entry); err != nil {
+		a.logger.Warn("writing audit log", "error", err)
 	}
-	return false
 }
 
 type toolUseInfo struct {
@@ -435,6 +627,7 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 		t               tool.Tool
 		normalizedInput string // Input after normalization (e.g., cd prefix stripped)
 		allowed         bool
+		edited          bool // The user edited the input before approving it
 	}
 	statuses := make([]toolStatus, len(toolUseBlocks))
 
@@ -474,13 +667,20 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 			ToolInput: normalizedInput,
 		}
 
+		// Tools like a persistent bash shell may run somewhere other than workDir.
+		var dir string
+		if reporter, ok := t.(tool.DirReporter); ok {
+			dir = reporter.CurrentDir()
+		}
+
 		// Check permission using normalized input.
-		if !a.checkPermission(ctx, ch, tu.name, json.RawMessage(normalizedInput)) {
+		outcome := a.checkPermission(ctx, ch, tu.name, json.RawMessage(normalizedInput), dir)
+		if !outcome.allowed {
 			if ctx.Err() != nil {
 				return resultBlocks, true // Cancelled
 			}
-			a.logger.Warn("permission denied", "tool", tu.name)
-			result := tool.Result{Output: "permission denied by user", IsError: true}
+			a.logger.Warn("permission denied", "tool", tu.name, "dir", dir)
+			result := tool.Result{Output: outcome.denial, IsError: true}
 			resultBlocks = append(resultBlocks,
 				anthropic.NewToolResultBlock(tu.id, result.Output, result.IsError),
 			)
@@ -490,7 +690,7 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 			continue
 		}
 
-		statuses[i] = toolStatus{tu: tu, t: t, normalizedInput: normalizedInput, allowed: true}
+		statuses[i] = toolStatus{tu: tu, t: t, normalizedInput: string(outcome.input), allowed: true, edited: outcome.edited}
 	}
 
 	// Phase 2: Execute allowed tools in parallel.
@@ -514,7 +714,9 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 
 	// Set up progress channel.
 	progressCh := make(chan tool.ProgressUpdate, len(allowedCalls)*2)
+	forwarded := make(chan struct{})
 	go func() {
+		defer close(forwarded)
 		for update := range progressCh {
 			ch <- StreamChunk{
 				Type:             ChunkParallelProgress,
@@ -526,6 +728,7 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 	// Execute tools in parallel.
 	results, err := a.executor.ExecuteTools(ctx, allowedCalls, progressCh)
 	close(progressCh)
+	<-forwarded // No sends on ch after we return
 
 	if err != nil {
 		a.logger.Error("parallel execution error", "error", err)
@@ -542,6 +745,23 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 			result = tool.Result{Output: fmt.Sprintf("tool execution error: %s", taskResult.Err), IsError: true}
 		}
 
+		// Tell the model what actually ran when the user changed it.
+		if statuses[originalIdx].edited {
+			result.Output = fmt.Sprintf("Note: the user edited the tool input before approving it. It ran with: %s\n\n%s",
+				statuses[originalIdx].normalizedInput, result.Output)
+		}
+
+		// Secrets in tool output must not reach the model, the session or the log.
+		var redacted []string
+		if fileContentTools[tu.name] {
+			result.Output, redacted = a.redactor.RedactKnown(result.Output)
+		} else {
+			result.Output, redacted = a.redactor.Redact(result.Output)
+		}
+		if len(redacted) > 0 {
+			a.logger.Info("masked secrets in tool output", "tool", tu.name, "kinds", redacted)
+		}
+
 		if result.IsError {
 			a.logger.Warn("tool returned error result", "tool", tu.name, "output", result.Output)
 		}
@@ -550,7 +770,7 @@ func (a *Agent) executeTools(ctx context.Context, ch chan<- StreamChunk, toolUse
 			anthropic.NewToolResultBlock(tu.id, result.Output, result.IsError),
 		)
 		a.detector.RecordToolCall(tu.name, tu.input, result.Output, result.IsError)
-		ch <- StreamChunk{Type: ChunkToolResult, ToolName: tu.name, ToolID: tu.id, Result: &result}
+		ch <- StreamChunk{Type: ChunkToolResult, ToolName: tu.name, ToolID: tu.id, Result: &result, Redacted: redacted}
 
 		// Emit todo update if this was a todo tool call
 		if tu.name == "todo" && !result.IsError && a.todoStore != nil {
@@ -0,0 +1,32 @@
+package agent
+
+import "strings"
+
+// modelPrices lists the price of each model family in US dollars per
+// million input and output tokens. More specific prefixes come first.
+var modelPrices = []struct {
+	prefix        string
+	input, output float64
+}{
+	{"claude-opus-4-5", 5, 25},
+	{"claude-opus-4", 15, 75},
+	{"claude-4-opus", 15, 75},
+	{"claude-3-opus", 15, 75},
+	{"claude-sonnet-4", 3, 15},
+	{"claude-4-sonnet", 3, 15},
+	{"claude-3-7-sonnet", 3, 15},
+	{"claude-haiku-4-5", 1, 5},
+	{"claude-3-5-haiku", 0.8, 4},
+	{"claude-3-haiku", 0.25, 1.25},
+}
+
+// Cost returns the list price of the usage in US dollars, or 0 for a
+// model without a known price.
+func (u Usage) Cost() float64 {
+	for _, p := range modelPrices {
+		if strings.HasPrefix(u.Model, p.prefix) {
+			return (float64(u.InputTokens)*p.input + float64(u.OutputTokens)*p.output) / 1e6
+		}
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsageCost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"claude-sonnet-4-5-20250929", 3 + 15},
+		{"claude-opus-4-5", 5 + 25},
+		{"claude-opus-4-1-20250805", 15 + 75},
+		{"claude-haiku-4-5", 1 + 5},
+		{"some-other-model", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			t.Parallel()
+
+			u := Usage{Model: tt.model, InputTokens: 1_000_000, OutputTokens: 1_000_000}
+			if got := u.Cost(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
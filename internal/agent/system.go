@@ -89,6 +89,13 @@ func BuildSystemPrompt(workDir string, registry *tool.Registry) string {
 
 	b.WriteString("## Environment\n\n")
 	fmt.Fprintf(&b, "- Working directory: %s\n", workDir)
+	for _, t := range registry.List() {
+		if reporter, ok := t.(tool.DirReporter); ok {
+			if dir := reporter.CurrentDir(); dir != "" && dir != workDir {
+				fmt.Fprintf(&b, "- Current %s directory: %s (cd persists between calls)\n", t.Name(), dir)
+			}
+		}
+	}
 	fmt.Fprintf(&b, "- Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	fmt.Fprintf(&b, "- Date: %s\n", time.Now().Format("2006-01-02"))
 	b.WriteString("\n")
@@ -102,6 +109,7 @@ func BuildSystemPrompt(workDir string, registry *tool.Registry) string {
 	b.WriteString("- Always read files before editing them.\n")
 	b.WriteString("- Use absolute file paths.\n")
 	b.WriteString("- Bash commands run in the working directory. Avoid cd; use absolute paths.\n")
+	b.WriteString("- Start long-running processes (dev servers, watchers) with bash background=true, then poll them with the job tool.\n")
 	b.WriteString("- Use tree to see codebase structure instead of multiple list_dir calls.\n")
 	b.WriteString("- Use multi_read to read multiple files at once instead of multiple read calls.\n")
 	b.WriteString("- You can call multiple tools in a single response. Make independent tool calls in parallel for efficiency.\n")
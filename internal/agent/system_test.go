@@ -186,3 +186,22 @@ func TestReadAgentConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildSystemPromptShowsShellDir(t *testing.T) {
+	t.Parallel()
+
+	registry := tool.NewRegistry()
+	if err := registry.Register(&tool.BashTool{WorkDir: "/home/user/project/sub"}); err != nil {
+		t.Fatalf("registering bash tool: %v", err)
+	}
+
+	prompt := BuildSystemPrompt("/home/user/project", registry)
+	if !strings.Contains(prompt, "Current bash directory: /home/user/project/sub") {
+		t.Error("system prompt should show the bash directory when it differs from the working directory")
+	}
+
+	prompt = BuildSystemPrompt("/home/user/project/sub", registry)
+	if strings.Contains(prompt, "Current bash directory") {
+		t.Error("system prompt should not repeat the bash directory when it matches the working directory")
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	ctxmgr "github.com/zhubert/milo/internal/context"
+	"github.com/zhubert/milo/internal/textutil"
+)
+
+const (
+	// TitleModel is the small model used to title sessions.
+	TitleModel = ctxmgr.HaikuModel
+
+	// maxTitleLength caps a generated title, in characters.
+	maxTitleLength = 60
+	// titleExcerptLength caps each message shown to the title model.
+	titleExcerptLength = 400
+	// titleTranscriptLength caps the conversation shown to the title
+	// model; the most recent messages are kept.
+	titleTranscriptLength = 6000
+
+	// keepTitle is the reply that leaves the current title as it is.
+	keepTitle = "SAME"
+
+	titlePrompt = `You write titles for conversations between a user and an AI coding assistant.
+A title is 3 to 7 words naming the task, such as "Fix LSP client deadlock" or
+"Add retention policy for sessions". Don't quote the user, and don't use
+quotation marks or a trailing period.
+
+Reply with only the title.`
+
+	retitlePrompt = `You write titles for conversations between a user and an AI coding assistant.
+A title is 3 to 7 words naming the task, such as "Fix LSP client deadlock" or
+"Add retention policy for sessions". Don't quote the user, and don't use
+quotation marks or a trailing period.
+
+The conversation is currently titled: %s
+
+If that title still describes what the conversation is mostly about, reply
+with only the word ` + keepTitle + `. Only if the conversation has clearly moved on to
+a different task, reply with only a new title for it.`
+)
+
+// Title asks the small model for a short title for a conversation. With a
+// current title, the model keeps it unless the topic has clearly changed;
+// the title returned is empty when it should stay as it is.
+func (a *Agent) Title(ctx context.Context, messages []anthropic.MessageParam, current string) (string, error) {
+	transcript := titleTranscript(messages)
+	if transcript == "" {
+		return "", nil
+	}
+
+	system := titlePrompt
+	if current != "" {
+		system = fmt.Sprintf(retitlePrompt, current)
+	}
+	resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     TitleModel,
+		MaxTokens: 64,
+		System:    []anthropic.TextBlockParam{{Text: system}},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(transcript)),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("calling %s for a title: %w", TitleModel, err)
+	}
+
+	var reply strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			reply.WriteString(block.Text)
+		}
+	}
+	return cleanTitle(reply.String(), current), nil
+}
+
+// titleTranscript returns the text of the user's and assistant's messages,
+// without tool calls and results, ending with the most recent.
+func titleTranscript(messages []anthropic.MessageParam) string {
+	var parts []string
+	for _, msg := range messages {
+		if ctxmgr.IsSummary(msg) {
+			continue
+		}
+		var text []string
+		for _, block := range msg.Content {
+			if block.OfText != nil && strings.TrimSpace(block.OfText.Text) != "" {
+				text = append(text, strings.TrimSpace(block.OfText.Text))
+			}
+		}
+		if len(text) == 0 {
+			continue
+		}
+		body := textutil.Truncate(strings.Join(text, "\n"), titleExcerptLength)
+		parts = append(parts, fmt.Sprintf("[%s]\n%s", strings.ToUpper(string(msg.Role)), body))
+	}
+
+	// Drop the oldest messages until the rest fit.
+	size := 0
+	start := len(parts)
+	for start > 0 && size+len(parts[start-1]) <= titleTranscriptLength {
+		start--
+		size += len(parts[start]) + 2
+	}
+	return strings.Join(parts[start:], "\n\n")
+}
+
+// cleanTitle tidies the model's reply into a title, returning "" if it
+// keeps the current title or says nothing.
+func cleanTitle(reply, current string) string {
+	title := strings.TrimSpace(reply)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*.")
+	title = strings.Join(strings.Fields(title), " ")
+
+	if title == "" || strings.EqualFold(title, keepTitle) || title == current {
+		return ""
+	}
+	return textutil.Truncate(title, maxTitleLength)
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestCleanTitle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		reply   string
+		current string
+		want    string
+	}{
+		{"plain", "Fix LSP client deadlock", "", "Fix LSP client deadlock"},
+		{"quoted with period", "\"Fix LSP client deadlock.\"", "", "Fix LSP client deadlock"},
+		{"prefixed", "Title: Add session retention", "", "Add session retention"},
+		{"first line only", "Add session retention\n\nThe user wants...", "", "Add session retention"},
+		{"keep", "SAME", "Fix LSP client deadlock", ""},
+		{"keep lower case", "same.", "Fix LSP client deadlock", ""},
+		{"unchanged", "Fix LSP client deadlock", "Fix LSP client deadlock", ""},
+		{"empty", "  ", "", ""},
+		{"long", strings.Repeat("word ", 20), "", strings.Repeat("word ", 11) + "wo..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := cleanTitle(tt.reply, tt.current); got != tt.want {
+				t.Errorf("cleanTitle(%q) = %q, want %q", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleTranscript(t *testing.T) {
+	t.Parallel()
+
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("[CONVERSATION SUMMARY - Earlier messages have been condensed]\n\nold work")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("why does gopls hang?")),
+		anthropic.NewAssistantMessage(
+			anthropic.NewTextBlock("Let me look."),
+			anthropic.NewToolUseBlock("t1", json.RawMessage(`{"pattern":"*.go"}`), "glob"),
+		),
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("t1", "client.go", false)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("The client deadlocks.")),
+	}
+	got := titleTranscript(messages)
+	want := "[USER]\nwhy does gopls hang?\n\n[ASSISTANT]\nLet me look.\n\n[ASSISTANT]\nThe client deadlocks."
+	if got != want {
+		t.Errorf("titleTranscript() = %q, want %q", got, want)
+	}
+
+	// A long conversation keeps its most recent messages.
+	var long []anthropic.MessageParam
+	for i := range 100 {
+		text := strings.Repeat("a", 300)
+		if i == 99 {
+			text = "latest"
+		}
+		long = append(long, anthropic.NewUserMessage(anthropic.NewTextBlock(text)))
+	}
+	got = titleTranscript(long)
+	if len(got) > titleTranscriptLength || !strings.HasSuffix(got, "latest") {
+		t.Errorf("titleTranscript() of a long conversation is %d bytes, ending %q", len(got), got[len(got)-10:])
+	}
+}
@@ -0,0 +1,184 @@
+// Package audit keeps an append-only record of permission decisions in a
+// JSONL file, one decision per line.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User responses to a permission prompt.
+const (
+	ResponseAllow     = "allow"
+	ResponseAlways    = "always"
+	ResponseEdit      = "edit"
+	ResponseDeny      = "deny"
+	ResponseCancelled = "cancelled"
+)
+
+// Entry is one permission decision.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+	Tool      string    `json:"tool"`
+	// Input is the normalized input rules were matched against: the
+	// command for bash, the resolved path for file tools.
+	Input string `json:"input,omitempty"`
+	// Action is what the rules decided: allow, ask or deny.
+	Action string `json:"action"`
+	// Rule is the deciding rule, if one decided.
+	Rule   string `json:"rule,omitempty"`
+	Source string `json:"source,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Prompted is set when the user was asked, and Response holds the answer.
+	Prompted bool   `json:"prompted,omitempty"`
+	Response string `json:"response,omitempty"`
+	// Feedback is the reason the user gave for denying the call.
+	Feedback string `json:"feedback,omitempty"`
+	// Edited is the input the user changed the call to before approving it.
+	Edited string `json:"edited,omitempty"`
+	// Grant is the rule the user always-allowed, with its scope.
+	Grant string `json:"grant,omitempty"`
+	// Allowed is whether the tool ended up running.
+	Allowed bool `json:"allowed"`
+}
+
+// Decision is the final outcome of the entry: allow or deny.
+func (e *Entry) Decision() string {
+	if e.Allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+// Log appends entries to an audit file. It is safe for concurrent use.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+}
+
+// FileForWorkDir returns the audit file for the project in workDir.
+func FileForWorkDir(workDir string) string {
+	return filepath.Join(workDir, ".milo", "audit.jsonl")
+}
+
+// Open opens the audit file at path for appending, creating it and its
+// directory if needed. The file is only ever appended to.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating audit directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return &Log{file: f, path: path}, nil
+}
+
+// Path returns the file the log appends to.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends e to the log, stamping it with the current time if it has
+// none. Each entry is written with a single write so concurrent milo
+// processes don't interleave lines. A nil log records nothing.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshaling audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Filter selects audit entries. Empty fields match everything.
+type Filter struct {
+	// SessionID matches entries whose session ID starts with it.
+	SessionID string
+	Tool      string
+	// Decision is "allow" or "deny" for the final outcome, or "ask" for
+	// decisions the user was prompted for.
+	Decision string
+	// Since drops entries older than it.
+	Since time.Time
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e *Entry) bool {
+	switch {
+	case f.SessionID != "" && !strings.HasPrefix(e.SessionID, f.SessionID):
+		return false
+	case f.Tool != "" && e.Tool != f.Tool:
+		return false
+	case f.Decision == "ask" && !e.Prompted:
+		return false
+	case f.Decision != "" && f.Decision != "ask" && e.Decision() != f.Decision:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	}
+	return true
+}
+
+// Read returns the entries in the audit file at path that pass the filter,
+// oldest first. A missing file has no entries. Lines that don't parse,
+// such as one cut short by a crash, are skipped.
+func Read(path string, f Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if f.Match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	return entries, nil
+}
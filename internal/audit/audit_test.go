@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".milo", "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	entries := []Entry{
+		{Time: old, SessionID: "aaa111", Tool: "read", Input: "/p/main.go", Action: "allow", Allowed: true},
+		{SessionID: "aaa111", Tool: "bash", Input: "rm -rf /", Action: "deny", Rule: "Bash(rm -rf /:*):deny"},
+		{SessionID: "bbb222", Tool: "bash", Input: "make", Action: "ask", Prompted: true, Response: ResponseAllow, Allowed: true},
+		{SessionID: "bbb222", Tool: "write", Input: "/etc/hosts", Action: "ask", Prompted: true, Response: ResponseDeny},
+	}
+	for _, e := range entries {
+		if err := log.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string // inputs, in order
+	}{
+		{"all", Filter{}, []string{"/p/main.go", "rm -rf /", "make", "/etc/hosts"}},
+		{"session prefix", Filter{SessionID: "bbb"}, []string{"make", "/etc/hosts"}},
+		{"tool", Filter{Tool: "bash"}, []string{"rm -rf /", "make"}},
+		{"denied by rule or user", Filter{Decision: "deny"}, []string{"rm -rf /", "/etc/hosts"}},
+		{"allowed", Filter{Decision: "allow"}, []string{"/p/main.go", "make"}},
+		{"prompted", Filter{Decision: "ask"}, []string{"make", "/etc/hosts"}},
+		{"since", Filter{Since: time.Now().Add(-time.Hour)}, []string{"rm -rf /", "make", "/etc/hosts"}},
+		{"combined", Filter{SessionID: "aaa", Tool: "bash", Decision: "deny"}, []string{"rm -rf /"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Read(path, tt.filter)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Read() returned %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if e.Input != tt.want[i] {
+					t.Errorf("entry %d input = %q, want %q", i, e.Input, tt.want[i])
+				}
+				if e.Time.IsZero() {
+					t.Errorf("entry %d has no time", i)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, tool := range []string{"read", "write"} {
+		log, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Record(Entry{Tool: tool, Action: "allow"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Tool != "read" || got[1].Tool != "write" {
+		t.Errorf("Read() = %+v, want read then write", got)
+	}
+}
+
+func TestReadSkipsTruncatedLines(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	data := `{"tool":"read","action":"allow","allowed":true}` + "\n" + `{"tool":"bash","act`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Tool != "read" {
+		t.Errorf("Read() = %+v, want just the complete entry", got)
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	t.Parallel()
+
+	got, err := Read(filepath.Join(t.TempDir(), "none.jsonl"), Filter{})
+	if err != nil || got != nil {
+		t.Errorf("Read() = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestRecordConcurrent(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = log.Record(Entry{Tool: "bash", Input: "go test ./...", Action: "allow", Allowed: true})
+		}()
+	}
+	wg.Wait()
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 50 {
+		t.Errorf("Read() returned %d entries, want 50", len(got))
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	t.Parallel()
+
+	var log *Log
+	if err := log.Record(Entry{Tool: "read"}); err != nil {
+		t.Errorf("Record() on nil log = %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("Close() on nil log = %v", err)
+	}
+}
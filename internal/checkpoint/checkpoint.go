@@ -0,0 +1,272 @@
+// Package checkpoint snapshots the working tree before each agent turn in a
+// shadow git repository under .milo/checkpoints, so changes made by any
+// tool, bash included, can be rolled back. The shadow repository has its
+// own object store, index and refs; the user's repository, if any, is never
+// read or written.
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhubert/milo/internal/textutil"
+)
+
+const (
+	// refPrefix is where each session's chain of checkpoints is kept.
+	refPrefix = "refs/milo/sessions/"
+	// messagesTrailer records how long the conversation was at a checkpoint.
+	messagesTrailer = "Milo-Messages: "
+	// maxPromptLength caps the prompt excerpt a checkpoint is labelled with.
+	maxPromptLength = 72
+)
+
+// Config holds settings for workspace checkpoints.
+type Config struct {
+	// Disabled turns off checkpoints before each turn.
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// Checkpoint is a snapshot of the working tree taken before a turn.
+type Checkpoint struct {
+	Hash string
+	Time time.Time
+	// Prompt is the start of the message the turn began with.
+	Prompt string
+	// Messages is how many messages the conversation had before the turn.
+	Messages int
+}
+
+// Short returns the checkpoint's abbreviated hash.
+func (c Checkpoint) Short() string {
+	if len(c.Hash) > 8 {
+		return c.Hash[:8]
+	}
+	return c.Hash
+}
+
+// Repo is a shadow repository whose work tree is the project.
+type Repo struct {
+	gitDir  string
+	workDir string
+}
+
+// ForWorkDir returns the path of the shadow repository for a project.
+func ForWorkDir(workDir string) string {
+	return filepath.Join(workDir, ".milo", "checkpoints")
+}
+
+// Open opens the shadow repository for workDir, creating it if needed.
+func Open(ctx context.Context, workDir string) (*Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("checkpoints need git, which is not installed")
+	}
+	r := &Repo{gitDir: ForWorkDir(workDir), workDir: workDir}
+
+	if _, err := os.Stat(filepath.Join(r.gitDir, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(r.gitDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating checkpoint repository: %w", err)
+		}
+		if _, err := r.run(ctx, nil, "init", "--quiet", "--bare", r.gitDir); err != nil {
+			return nil, fmt.Errorf("creating checkpoint repository: %w", err)
+		}
+		if _, err := r.git(ctx, "config", "core.bare", "false"); err != nil {
+			return nil, fmt.Errorf("configuring checkpoint repository: %w", err)
+		}
+	}
+
+	// milo's own files, the shadow repository among them, are never
+	// snapshotted. The project's .gitignore files apply as usual.
+	exclude := filepath.Join(r.gitDir, "info", "exclude")
+	if err := os.MkdirAll(filepath.Dir(exclude), 0755); err != nil {
+		return nil, fmt.Errorf("configuring checkpoint repository: %w", err)
+	}
+	if err := os.WriteFile(exclude, []byte("/.milo/\n"), 0644); err != nil {
+		return nil, fmt.Errorf("configuring checkpoint repository: %w", err)
+	}
+	return r, nil
+}
+
+// Create snapshots the working tree as the next checkpoint of a session,
+// labelled with the prompt of the turn about to start and the number of
+// messages before it.
+func (r *Repo) Create(ctx context.Context, sessionID, prompt string, messages int) (Checkpoint, error) {
+	tree, err := r.snapshot(ctx)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	label := Excerpt(prompt)
+	msg := label + "\n\n" + messagesTrailer + strconv.Itoa(messages) + "\n"
+	args := []string{"commit-tree", "--no-gpg-sign", "-m", msg, tree}
+	ref := refPrefix + sessionID
+	if parent, err := r.git(ctx, "rev-parse", "--verify", "--quiet", ref); err == nil && parent != "" {
+		args = append(args, "-p", parent)
+	}
+	hash, err := r.git(ctx, args...)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("recording checkpoint: %w", err)
+	}
+	if _, err := r.git(ctx, "update-ref", ref, hash); err != nil {
+		return Checkpoint{}, fmt.Errorf("recording checkpoint: %w", err)
+	}
+	return Checkpoint{Hash: hash, Time: time.Now(), Prompt: label, Messages: messages}, nil
+}
+
+// List returns a session's checkpoints, newest first.
+func (r *Repo) List(ctx context.Context, sessionID string) ([]Checkpoint, error) {
+	ref := refPrefix + sessionID
+	if _, err := r.git(ctx, "rev-parse", "--verify", "--quiet", ref); err != nil {
+		return nil, nil
+	}
+	out, err := r.git(ctx, "log", "--format=%H%x00%ct%x00%B%x1e", ref)
+	if err != nil {
+		return nil, fmt.Errorf("listing checkpoints: %w", err)
+	}
+
+	var checkpoints []Checkpoint
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		secs, _ := strconv.ParseInt(fields[1], 10, 64)
+		cp := Checkpoint{Hash: fields[0], Time: time.Unix(secs, 0)}
+		for i, line := range strings.Split(fields[2], "\n") {
+			if i == 0 {
+				cp.Prompt = line
+			}
+			if n, ok := strings.CutPrefix(line, messagesTrailer); ok {
+				cp.Messages, _ = strconv.Atoi(n)
+			}
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+// Changed returns the files that differ between a checkpoint and the
+// working tree now.
+func (r *Repo) Changed(ctx context.Context, cp Checkpoint) ([]string, error) {
+	if _, err := r.snapshot(ctx); err != nil {
+		return nil, err
+	}
+	out, err := r.git(ctx, "diff", "--cached", "--name-only", "--no-renames", cp.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("comparing with checkpoint: %w", err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// Restore puts the working tree back as it was at a checkpoint: changed
+// files get their old content back and files created since are removed.
+// Ignored files are left alone. It returns the files it changed.
+func (r *Repo) Restore(ctx context.Context, cp Checkpoint) ([]string, error) {
+	changed, err := r.Changed(ctx, cp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.git(ctx, "read-tree", "--reset", "-u", cp.Hash); err != nil {
+		return nil, fmt.Errorf("restoring checkpoint: %w", err)
+	}
+	return changed, nil
+}
+
+// Forget drops the checkpoints of deleted sessions. Snapshots nothing else
+// refers to are removed when git collects garbage, which it does once
+// enough have piled up.
+func (r *Repo) Forget(ctx context.Context, sessionIDs ...string) error {
+	for _, id := range sessionIDs {
+		if _, err := r.git(ctx, "rev-parse", "--verify", "--quiet", refPrefix+id); err != nil {
+			continue
+		}
+		if _, err := r.git(ctx, "update-ref", "-d", refPrefix+id); err != nil {
+			return fmt.Errorf("removing checkpoints of session %q: %w", id, err)
+		}
+	}
+	if _, err := r.git(ctx, "gc", "--auto", "--quiet"); err != nil {
+		return fmt.Errorf("cleaning up checkpoints: %w", err)
+	}
+	return nil
+}
+
+// snapshot stages the whole working tree in the shadow index and returns
+// the tree it makes.
+func (r *Repo) snapshot(ctx context.Context) (string, error) {
+	if _, err := r.git(ctx, "add", "--all", "--", "."); err != nil {
+		return "", fmt.Errorf("snapshotting working tree: %w", err)
+	}
+	tree, err := r.git(ctx, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("snapshotting working tree: %w", err)
+	}
+	return tree, nil
+}
+
+// git runs a git command against the shadow repository and returns its
+// trimmed output.
+func (r *Repo) git(ctx context.Context, args ...string) (string, error) {
+	return r.run(ctx, []string{
+		"--git-dir=" + r.gitDir,
+		"--work-tree=" + r.workDir,
+		"-c", "core.autocrlf=false",
+		"-c", "core.fsmonitor=false",
+		"-c", "core.hooksPath=" + os.DevNull,
+		"-c", "advice.addEmbeddedRepo=false",
+	}, args...)
+}
+
+// run runs a git command, after the global options, in the project and
+// returns its trimmed output. The user's git environment is kept out.
+func (r *Repo) run(ctx context.Context, global []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append(global, args...)...)
+	cmd.Dir = r.workDir
+	cmd.Env = gitEnv(os.Environ())
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitEnv returns env without variables that would point git at the user's
+// repository, with a fixed identity for checkpoint commits.
+func gitEnv(env []string) []string {
+	var result []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, "GIT_") {
+			result = append(result, kv)
+		}
+	}
+	return append(result,
+		"GIT_AUTHOR_NAME=milo", "GIT_AUTHOR_EMAIL=milo@localhost",
+		"GIT_COMMITTER_NAME=milo", "GIT_COMMITTER_EMAIL=milo@localhost",
+	)
+}
+
+// Excerpt returns the label a checkpoint gets for a prompt: its first
+// line, shortened.
+func Excerpt(prompt string) string {
+	line := strings.TrimSpace(prompt)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+	return textutil.Truncate(line, maxPromptLength)
+}
@@ -0,0 +1,178 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	t.Parallel()
+	requireGit(t)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "main.go", "package main\n")
+	writeFile(t, dir, ".gitignore", "build/\n")
+	writeFile(t, dir, "build/out", "binary")
+	writeFile(t, dir, ".milo/sessions/abc.jsonl", "{}\n")
+
+	repo, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	first, err := repo.Create(ctx, "abc", "refactor main\nand run the tests", 0)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	// The turn edits a file, creates one and rebuilds.
+	writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, "gen/types.go", "package gen\n")
+	writeFile(t, dir, "build/out", "new binary")
+	if _, err := repo.Create(ctx, "abc", "now add docs", 4); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	checkpoints, err := repo.List(ctx, "abc")
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(checkpoints) != 2 {
+		t.Fatalf("List() = %d checkpoints, want 2", len(checkpoints))
+	}
+	if got := checkpoints[1]; got.Hash != first.Hash || got.Prompt != "refactor main" || got.Messages != 0 {
+		t.Errorf("oldest checkpoint = %+v", got)
+	}
+	if got := checkpoints[0]; got.Prompt != "now add docs" || got.Messages != 4 {
+		t.Errorf("newest checkpoint = %+v", got)
+	}
+	if other, _ := repo.List(ctx, "other"); len(other) != 0 {
+		t.Errorf("List() of another session = %+v", other)
+	}
+
+	changed, err := repo.Restore(ctx, first)
+	if err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	slices.Sort(changed)
+	if want := []string{"gen/types.go", "main.go"}; !slices.Equal(changed, want) {
+		t.Errorf("Restore() changed %v, want %v", changed, want)
+	}
+	if got := readFile(t, dir, "main.go"); got != "package main\n" {
+		t.Errorf("main.go = %q after restore", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen", "types.go")); !os.IsNotExist(err) {
+		t.Error("file created after the checkpoint survived the restore")
+	}
+	// Ignored files and milo's own files are left alone.
+	if got := readFile(t, dir, "build/out"); got != "new binary" {
+		t.Errorf("ignored file = %q after restore", got)
+	}
+	if got := readFile(t, dir, ".milo/sessions/abc.jsonl"); got != "{}\n" {
+		t.Errorf("session file = %q after restore", got)
+	}
+
+	if err := repo.Forget(ctx, "abc", "missing"); err != nil {
+		t.Fatalf("Forget() error: %v", err)
+	}
+	if left, _ := repo.List(ctx, "abc"); len(left) != 0 {
+		t.Errorf("List() after Forget() = %+v", left)
+	}
+}
+
+func TestUserRepositoryUntouched(t *testing.T) {
+	t.Parallel()
+	requireGit(t)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	writeFile(t, dir, "a.txt", "one")
+	git("add", "a.txt")
+	git("-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "first")
+	writeFile(t, dir, "b.txt", "untracked")
+	head := git("rev-parse", "HEAD")
+	status := git("status", "--porcelain")
+
+	repo, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	cp, err := repo.Create(ctx, "abc", "change things", 0)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	writeFile(t, dir, "a.txt", "two")
+	if _, err := repo.Restore(ctx, cp); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+
+	if got := git("rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved from %s to %s", head, got)
+	}
+	// .milo shows up as untracked, since this test has no .gitignore for it.
+	if got := git("status", "--porcelain", "--", ".", ":!.milo"); got != status {
+		t.Errorf("git status changed from %q to %q", status, got)
+	}
+	if got := readFile(t, dir, "a.txt"); got != "one" {
+		t.Errorf("a.txt = %q after restore", got)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"fix the bug":               "fix the bug",
+		"  first line\nsecond line": "first line",
+		strings.Repeat("x", 100):    strings.Repeat("x", 69) + "...",
+		"":                          "",
+	}
+	for in, want := range tests {
+		if got := Excerpt(in); got != want {
+			t.Errorf("Excerpt(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package config loads milo's settings from ~/.milo/config.yaml and
+// .milo/config.yaml in the project.
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zhubert/milo/internal/checkpoint"
+	"github.com/zhubert/milo/internal/permission"
+	"github.com/zhubert/milo/internal/redact"
+	"github.com/zhubert/milo/internal/sandbox"
+	"github.com/zhubert/milo/internal/session"
+	"github.com/zhubert/milo/internal/tool"
+)
+
+// Config holds user-configurable settings.
+type Config struct {
+	Sandbox     sandbox.Config       `yaml:"sandbox"`
+	Bash        BashConfig           `yaml:"bash"`
+	Redact      redact.Config        `yaml:"redact"`
+	Workspace   permission.Workspace `yaml:"workspace"`
+	WebFetch    tool.WebFetchConfig  `yaml:"web_fetch"`
+	Sessions    SessionsConfig       `yaml:"sessions"`
+	Checkpoints checkpoint.Config    `yaml:"checkpoints"`
+
+	// Warnings lists settings in the project file that were ignored.
+	Warnings []string `yaml:"-"`
+}
+
+// BashConfig holds settings for the bash tool.
+type BashConfig struct {
+	Limits tool.BashLimits `yaml:"limits"`
+	Env    tool.EnvPolicy  `yaml:"env"`
+}
+
+// SessionsConfig holds settings for saved sessions.
+type SessionsConfig struct {
+	Retention session.Retention `yaml:"retention"`
+}
+
+// Load reads the global config and then the project config in workDir.
+// Settings present in the project file override the global ones, except
+// that it can't loosen the sandbox, the bash environment, the workspace
+// boundary, secret redaction or web_fetch's address checks, and its
+// redaction patterns add to the global ones; see restrictProject. Missing
+// files are not an error.
+func Load(workDir string) (*Config, error) {
+	cfg := &Config{}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := loadInto(cfg, filepath.Join(home, ".milo", "config.yaml")); err != nil {
+			return nil, err
+		}
+	}
+
+	global := *cfg
+	global.Bash.Env.Set = maps.Clone(cfg.Bash.Env.Set) // decoding merges into maps
+	cfg.Redact.Patterns = nil                          // so the project's are told apart
+	if err := loadInto(cfg, filepath.Join(workDir, ".milo", "config.yaml")); err != nil {
+		return nil, err
+	}
+	cfg.Warnings = restrictProject(cfg, global)
+
+	return cfg, nil
+}
+
+// restrictProject undoes project settings that would let commands do more
+// without a prompt than the global config allows. The project file comes
+// with the repository, so a cloned repository could otherwise turn them on
+// for itself. Narrowing them is fine. It returns a warning for each setting
+// it undid.
+func restrictProject(cfg *Config, global Config) []string {
+	var warnings []string
+	ignore := func(key string) {
+		warnings = append(warnings, fmt.Sprintf("ignoring %s from the project config; only ~/.milo/config.yaml can set it", key))
+	}
+
+	if cfg.Sandbox.Network && !global.Sandbox.Network {
+		cfg.Sandbox.Network = false
+		ignore("sandbox.network")
+	}
+	if !subset(cfg.Sandbox.Writable, global.Sandbox.Writable) {
+		cfg.Sandbox.Writable = global.Sandbox.Writable
+		ignore("sandbox.writable")
+	}
+
+	// Passing secrets, or variables that change what every command runs,
+	// is only the user's call. A project may set its own variables.
+	env := &cfg.Bash.Env
+	if env.KeepSecrets && !global.Bash.Env.KeepSecrets {
+		env.KeepSecrets = false
+		ignore("bash.env.keep_secrets")
+	}
+	if !slices.Equal(env.Allow, global.Bash.Env.Allow) {
+		env.Allow = global.Bash.Env.Allow
+		ignore("bash.env.allow")
+	}
+	set := maps.Clone(global.Bash.Env.Set)
+	for _, name := range slices.Sorted(maps.Keys(env.Set)) {
+		value, ok := global.Bash.Env.Set[name]
+		if ok && value == env.Set[name] {
+			continue
+		}
+		if matchesAny(protectedEnv, name) || env.LeaksStripped(env.Set[name]) {
+			ignore("bash.env.set." + name)
+			continue
+		}
+		if set == nil {
+			set = make(map[string]string)
+		}
+		set[name] = env.Set[name]
+	}
+	env.Set = set
+
+	// Turning redaction down would send secrets to the model and write
+	// them to sessions and logs. Extra patterns only mask more.
+	if cfg.Redact.Disabled && !global.Redact.Disabled {
+		cfg.Redact.Disabled = false
+		ignore("redact.disabled")
+	}
+	if cfg.Redact.DisableEntropy && !global.Redact.DisableEntropy {
+		cfg.Redact.DisableEntropy = false
+		ignore("redact.disable_entropy")
+	}
+	patterns := slices.Clip(global.Redact.Patterns)
+	for _, p := range cfg.Redact.Patterns {
+		if !slices.Contains(patterns, p) {
+			patterns = append(patterns, p)
+		}
+	}
+	cfg.Redact.Patterns = patterns
+
+	// Widening the workspace would let writes outside the working
+	// directory skip the prompt.
+	ws := &cfg.Workspace
+	if !subset(ws.Dirs, global.Workspace.Dirs) {
+		ws.Dirs = global.Workspace.Dirs
+		ignore("workspace.dirs")
+	}
+	if looser(ws.OutsideReads, global.Workspace.OutsideReads, "allow") {
+		ws.OutsideReads = global.Workspace.OutsideReads
+		ignore("workspace.outside_reads")
+	}
+	if looser(ws.OutsideWrites, global.Workspace.OutsideWrites, "ask") {
+		ws.OutsideWrites = global.Workspace.OutsideWrites
+		ignore("workspace.outside_writes")
+	}
+
+	if !subset(cfg.WebFetch.AllowPrivate, global.WebFetch.AllowPrivate) {
+		cfg.WebFetch.AllowPrivate = global.WebFetch.AllowPrivate
+		ignore("web_fetch.allow_private")
+	}
+	return warnings
+}
+
+// protectedEnv are the variables a project can't set, since they change
+// which programs every command runs or how the shell reads it.
+var protectedEnv = []string{"PATH", "LD_*", "DYLD_*", "BASH_ENV", "ENV", "PROMPT_COMMAND", "IFS"}
+
+// matchesAny reports whether name matches any of the globs.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// subset reports whether every item is also in allowed.
+func subset(items, allowed []string) bool {
+	for _, item := range items {
+		if !slices.Contains(allowed, item) {
+			return false
+		}
+	}
+	return true
+}
+
+// strictness orders the actions allow, ask and deny. Anything else is left
+// for the permission checker to reject.
+var strictness = map[string]int{"allow": 0, "ask": 1, "deny": 2}
+
+// looser reports whether action is less strict than global, where an
+// empty action means def.
+func looser(action, global, def string) bool {
+	if action == "" {
+		action = def
+	}
+	if global == "" {
+		global = def
+	}
+	a, ok := strictness[action]
+	g, gok := strictness[global]
+	return ok && gok && a < g
+}
+
+// loadInto decodes the file at path on top of cfg, so only keys present in
+// the file change cfg. A missing file is skipped.
+func loadInto(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
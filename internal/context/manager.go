@@ -225,10 +225,23 @@ func (m *Manager) simpleTruncate(messages []anthropic.MessageParam) []anthropic.
 	return messages
 }
 
+// summaryHeader starts every compaction summary message.
+const summaryHeader = "[CONVERSATION SUMMARY - Earlier messages have been condensed]"
+
+// IsSummary reports whether msg is a summary added by compaction.
+func IsSummary(msg anthropic.MessageParam) bool {
+	for _, block := range msg.Content {
+		if block.OfText != nil && strings.HasPrefix(block.OfText.Text, summaryHeader) {
+			return true
+		}
+	}
+	return false
+}
+
 // formatSummary wraps the summary text in a clear format.
 func formatSummary(summary string) string {
 	var sb strings.Builder
-	sb.WriteString("[CONVERSATION SUMMARY - Earlier messages have been condensed]\n\n")
+	sb.WriteString(summaryHeader + "\n\n")
 	sb.WriteString(summary)
 	sb.WriteString("\n\n[END SUMMARY - Recent conversation continues below]")
 	return sb.String()
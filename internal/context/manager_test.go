@@ -247,4 +247,10 @@ func TestFormatSummary(t *testing.T) {
 	if !strings.Contains(result, "END SUMMARY") {
 		t.Error("expected summary footer")
 	}
+	if !IsSummary(anthropic.NewUserMessage(anthropic.NewTextBlock(result))) {
+		t.Error("IsSummary() = false for a summary message")
+	}
+	if IsSummary(anthropic.NewUserMessage(anthropic.NewTextBlock(summary))) {
+		t.Error("IsSummary() = true for a plain message")
+	}
 }
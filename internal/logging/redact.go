@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/zhubert/milo/internal/redact"
+)
+
+// WithRedaction returns a logger that masks secrets in messages and
+// attribute values before they reach logger's handler.
+func WithRedaction(logger *slog.Logger, r *redact.Redactor) *slog.Logger {
+	return slog.New(&redactingHandler{inner: logger.Handler(), r: r})
+}
+
+type redactingHandler struct {
+	inner slog.Handler
+	r     *redact.Redactor
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, rec slog.Record) error {
+	msg, _ := h.r.Redact(rec.Message)
+	out := slog.NewRecord(rec.Time, rec.Level, msg, rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactAttr(a)
+	}
+	return &redactingHandler{inner: h.inner.WithAttrs(redacted), r: h.r}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{inner: h.inner.WithGroup(name), r: h.r}
+}
+
+// redactAttr masks string-like values. Other kinds can't carry free text
+// and are passed through.
+func (h *redactingHandler) redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		s, _ := h.r.Redact(v.String())
+		return slog.String(a.Key, s)
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, g := range group {
+			redacted[i] = h.redactAttr(g)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case json.RawMessage:
+			if data, _, err := h.r.RedactJSON(x); err == nil {
+				return slog.Any(a.Key, json.RawMessage(data))
+			}
+			s, _ := h.r.Redact(string(x))
+			return slog.String(a.Key, s)
+		case []byte:
+			s, _ := h.r.Redact(string(x))
+			return slog.String(a.Key, s)
+		case error:
+			s, _ := h.r.Redact(x.Error())
+			return slog.String(a.Key, s)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
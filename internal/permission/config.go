@@ -1,6 +1,7 @@
 package permission
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,10 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// ErrInvalidRules is wrapped by errors for permissions files with rules
+// that don't parse. The file's valid rules are still loaded.
+var ErrInvalidRules = errors.New("invalid permission rules")
+
 // Config represents the structure of a permissions config file.
 type Config struct {
 	Rules []string `yaml:"rules"`
@@ -50,83 +55,101 @@ func (c *Checker) LoadFromFile(path string) (int, error) {
 		return 0, err
 	}
 
-	return c.loadFromConfig(cfg)
+	return c.loadFromConfig(cfg, path)
 }
 
-func (c *Checker) loadFromConfig(cfg *Config) (int, error) {
+func (c *Checker) loadFromConfig(cfg *Config, source string) (int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// Load every valid rule and report all bad ones, not just the first.
 	loaded := 0
+	var errs []error
 	for i, ruleStr := range cfg.Rules {
 		rule, err := ParseRule(ruleStr)
 		if err != nil {
-			return loaded, fmt.Errorf("rule %d: %w", i, err)
+			errs = append(errs, fmt.Errorf("rule %d: %w", i+1, err))
+			continue
 		}
+		rule.Source = source
 		c.customRules[rule.Key()] = rule
 		loaded++
 	}
 
+	if len(errs) > 0 {
+		return loaded, fmt.Errorf("%w in %s (run 'milo permissions lint' for details): %w", ErrInvalidRules, source, errors.Join(errs...))
+	}
 	return loaded, nil
 }
 
 // LoadFromDirectory loads permissions from .milo/permissions.yaml in the given directory.
 // If the file doesn't exist, it returns (0, nil) - no error.
 func (c *Checker) LoadFromDirectory(dir string) (int, error) {
-	path := filepath.Join(dir, ".milo", "permissions.yaml")
+	path := ProjectFile(dir)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return 0, nil
 	}
 	return c.LoadFromFile(path)
 }
 
+// ProjectFile returns the path of the permissions file for the project in dir.
+func ProjectFile(dir string) string {
+	return filepath.Join(dir, ".milo", "permissions.yaml")
+}
+
+// GlobalFile returns the path of the user's global permissions file.
+func GlobalFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting home directory: %w", err)
+	}
+	return filepath.Join(home, ".milo", "permissions.yaml"), nil
+}
+
 // LoadGlobal loads permissions from ~/.milo/permissions.yaml.
 // If the file doesn't exist, it returns (0, nil) - no error.
 func (c *Checker) LoadGlobal() (int, error) {
-	home, err := os.UserHomeDir()
+	path, err := GlobalFile()
 	if err != nil {
 		return 0, nil // Can't find home dir, skip global config
 	}
 
-	path := filepath.Join(home, ".milo", "permissions.yaml")
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return 0, nil
 	}
 	return c.LoadFromFile(path)
 }
 
-// SaveToDirectory saves custom rules to .milo/permissions.yaml in the given directory.
+// SaveToDirectory saves custom rules to .milo/permissions.yaml in the given
+// directory. Rules loaded from the global file stay there.
 func (c *Checker) SaveToDirectory(dir string) error {
-	c.mu.RLock()
-	rules := make([]string, 0, len(c.customRules))
-	for _, rule := range c.customRules {
+	global, _ := GlobalFile()
+
+	var rules []string
+	for _, rule := range c.CustomRules() {
+		if global != "" && rule.Source == global {
+			continue
+		}
 		rules = append(rules, rule.String())
 	}
-	c.mu.RUnlock()
 
-	// Build config
-	cfg := Config{
-		Rules: rules,
-	}
+	return SaveConfig(ProjectFile(dir), &Config{Rules: rules})
+}
 
-	// Create directory if needed
-	miloDir := filepath.Join(dir, ".milo")
-	if err := os.MkdirAll(miloDir, 0755); err != nil {
+// SaveConfig writes cfg to path, creating its directory if needed.
+func SaveConfig(path string, cfg *Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return fmt.Errorf("creating .milo directory: %w", err)
 	}
 
-	// Marshal to YAML
-	data, err := yaml.Marshal(&cfg)
+	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
 
-	// Write file
-	path := filepath.Join(miloDir, "permissions.yaml")
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("writing config file: %w", err)
 	}
-
 	return nil
 }
 
@@ -140,20 +163,40 @@ func (c *Checker) Save() error {
 }
 
 // NewCheckerWithConfig creates a new Checker and loads rules from config files.
-// It loads in order: global config, then repo config (repo rules take precedence).
+// It loads in order: the managed policy, global config, then repo config
+// (repo rules take precedence, but can't loosen the policy's locked rules).
+// A rule that doesn't parse in the global or repo config is skipped and
+// reported by Warnings; a bad managed policy is still an error.
 func NewCheckerWithConfig(workDir string) (*Checker, error) {
 	c := NewChecker()
 	c.workDir = workDir
 
+	if _, err := c.LoadManaged(); err != nil {
+		return nil, fmt.Errorf("loading managed policy: %w", err)
+	}
+
 	// Load global config first (lower precedence)
 	if _, err := c.LoadGlobal(); err != nil {
-		return nil, fmt.Errorf("loading global config: %w", err)
+		if !errors.Is(err, ErrInvalidRules) {
+			return nil, fmt.Errorf("loading global config: %w", err)
+		}
+		c.warnings = append(c.warnings, err.Error())
 	}
 
 	// Load repo config (higher precedence due to specificity)
 	if _, err := c.LoadFromDirectory(workDir); err != nil {
-		return nil, fmt.Errorf("loading repo config: %w", err)
+		if !errors.Is(err, ErrInvalidRules) {
+			return nil, fmt.Errorf("loading repo config: %w", err)
+		}
+		c.warnings = append(c.warnings, err.Error())
 	}
 
 	return c, nil
 }
+
+// Warnings describes the rules NewCheckerWithConfig skipped.
+func (c *Checker) Warnings() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.warnings...)
+}
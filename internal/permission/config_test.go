@@ -3,6 +3,7 @@ package permission
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -278,6 +279,30 @@ func TestNewCheckerWithConfig(t *testing.T) {
 	}
 }
 
+func TestNewCheckerWithConfigSkipsBadRules(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	miloDir := filepath.Join(tmpDir, ".milo")
+	if err := os.MkdirAll(miloDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeRules(t, miloDir, "Bash(docker:*)", "Bash(rm:*", "Bash(make):maybe")
+
+	c, err := NewCheckerWithConfig(tmpDir)
+	if err != nil {
+		t.Fatalf("NewCheckerWithConfig() error = %v", err)
+	}
+	input := makeInput(map[string]interface{}{"command": "docker build ."})
+	if got := c.Check("bash", input); got != Allow {
+		t.Errorf("valid rule next to bad ones: docker build = %v, want allow", got)
+	}
+	warnings := c.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "rule 2") || !strings.Contains(warnings[0], "rule 3") {
+		t.Errorf("Warnings() = %v, want one naming both bad rules", warnings)
+	}
+}
+
 func TestNewCheckerWithConfigNoConfigFile(t *testing.T) {
 	t.Parallel()
 
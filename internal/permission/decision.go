@@ -0,0 +1,266 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Match is a rule that matched an input, with its specificity score.
+type Match struct {
+	Rule  Rule
+	Score int
+}
+
+// Evaluation records how one input was checked against the rules. A bash
+// command produces one per simple command and per file it writes.
+type Evaluation struct {
+	Tool  string
+	Input string
+	// Matches holds every matching rule, most specific first.
+	Matches []Match
+	// Action is the outcome of this step.
+	Action Action
+	// Note explains steps that don't follow the usual rule lookup.
+	Note string
+}
+
+// Winner returns the rule that decided this step, or nil when no rule
+// matched and the default action applied.
+func (e *Evaluation) Winner() *Match {
+	if len(e.Matches) == 0 {
+		return nil
+	}
+	return &e.Matches[0]
+}
+
+// Decision is the outcome of a permission check and how it was reached.
+type Decision struct {
+	Action Action
+	// Input is the normalized input rules were matched against.
+	Input string
+	// Rule is the rule that decided, or nil when the default action, a
+	// session grant or an unanalysable command decided.
+	Rule *Rule
+	// Score is the specificity of Rule.
+	Score int
+	// Reason explains the decision in one line.
+	Reason string
+	// Trace lists every evaluation step in order.
+	Trace []Evaluation
+}
+
+// Decide returns the permission decision for the given tool and input,
+// with a trace of every rule considered.
+func (c *Checker) Decide(toolName string, toolInput json.RawMessage) Decision {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Extract the relevant input string based on tool type, unless the
+	// tool reports what its call acts on itself
+	input := c.normalizeInput(toolName, extractInputString(toolName, toolInput))
+	subjects, reported := c.reportedSubjects(toolName, toolInput)
+
+	var d Decision
+	var bashWrites []Subject
+	switch {
+	case reported:
+		input = subjectsInput(subjects)
+		d = c.decideSubjects(toolName, subjects)
+	case toolName == "bash":
+		d, bashWrites = c.decideBash(input)
+	default:
+		d = decisionFrom([]Evaluation{c.evaluate(toolName, input)}, 0, false)
+	}
+
+	// A session grant overrides the rules, except the managed policy's.
+	if (c.sessionAlways[toolName+":"+input] || c.sessionAlways[toolName]) && !d.locked() {
+		d = Decision{
+			Action: Allow,
+			Reason: "allowed for this session",
+			Trace:  []Evaluation{{Tool: toolName, Input: input, Action: Allow, Note: "always-allowed earlier in this session"}},
+		}
+	}
+
+	d.Input = input
+
+	// Session grants and rules can't wave a file tool, or a redirect, past
+	// the workspace boundary.
+	switch {
+	case toolName == "bash" && !reported:
+		subjects = bashWrites
+	case !reported:
+		subjects = accessedPaths(toolName, toolInput)
+	}
+	return c.checkBoundary(toolName, subjects, d)
+}
+
+// locked reports whether a locked rule restricts any part of d.
+func (d *Decision) locked() bool {
+	for i := range d.Trace {
+		if w := d.Trace[i].Winner(); w != nil && w.Rule.Locked && d.Trace[i].Action != Allow {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate finds every rule matching input and takes the action of the
+// most specific one. Ties go to a configured rule over a built-in one, and
+// otherwise to the rule listed first. A stricter locked rule from the
+// managed policy wins regardless of specificity.
+// Must be called with at least a read lock held.
+func (c *Checker) evaluate(toolName, input string) Evaluation {
+	return c.evaluateAs(toolName, input, kindOf(toolName))
+}
+
+// evaluateAs is evaluate for an input of the given kind.
+// Must be called with at least a read lock held.
+func (c *Checker) evaluateAs(toolName, input string, kind SubjectKind) Evaluation {
+	ev := Evaluation{Tool: toolName, Input: input, Action: c.defaultAction}
+	for _, rule := range c.allRules() {
+		match := rule
+		if kind == SubjectPath {
+			match.Pattern = c.expandPattern(rule.Pattern)
+		}
+		if match.matchesAs(toolName, input, kind) {
+			ev.Matches = append(ev.Matches, Match{Rule: rule, Score: rule.Specificity()})
+		}
+	}
+	sort.SliceStable(ev.Matches, func(i, j int) bool {
+		a, b := ev.Matches[i], ev.Matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Rule.Source != SourceDefault && b.Rule.Source == SourceDefault
+	})
+	if w := ev.Winner(); w != nil {
+		ev.Action = w.Rule.Action
+	}
+	enforceLocked(&ev)
+	return ev
+}
+
+// decideBash parses a bash command and checks every simple command in it,
+// including pipeline stages and command substitutions, plus every file it
+// writes through a redirection. The most restrictive result wins. It also
+// returns the files written, resolved like write paths, for the workspace
+// boundary.
+// Must be called with at least a read lock held.
+func (c *Checker) decideBash(command string) (Decision, []Subject) {
+	// Deny rules still see the raw command line, so patterns that span
+	// several commands (like a fork bomb) keep working.
+	whole := c.evaluate("bash", command)
+	if whole.Action == Deny {
+		return decisionFrom([]Evaluation{whole}, 0, false), nil
+	}
+
+	analysis := analyzeCommand(command)
+	if len(analysis.Commands) == 0 && len(analysis.Writes) == 0 && !analysis.Opaque {
+		return decisionFrom([]Evaluation{whole}, 0, false), nil
+	}
+
+	whole.Action = Allow
+	whole.Note = "whole command line, checked for deny rules only"
+	trace := []Evaluation{whole}
+	if analysis.Opaque {
+		trace = append(trace, Evaluation{
+			Tool:   "bash",
+			Input:  command,
+			Action: Ask,
+			Note:   "part of the command can't be checked statically (computed command or redirect target, dynamic script, or a parse error)",
+		})
+	}
+	for _, cmd := range analysis.Commands {
+		trace = append(trace, c.evaluate("bash", cmd))
+	}
+	base := c.workDir
+	if c.bashDir != nil {
+		if dir := c.bashDir(); dir != "" {
+			base = dir
+		}
+	}
+	var writes []Subject
+	for _, target := range analysis.Writes {
+		path := resolvePath(base, target)
+		writes = append(writes, Subject{Kind: SubjectPath, Value: path, Write: true})
+		ev := c.evaluate("write", path)
+		// Inside the sandbox writes are already confined, so only an
+		// explicit deny matters.
+		if c.sandboxed && !c.disableBypass && ev.Action != Deny {
+			ev.Action = Allow
+			ev.Note = "redirect inside the sandbox; only deny rules apply"
+		}
+		trace = append(trace, ev)
+	}
+
+	// The first part with the strictest action decides; trace[0] only
+	// ever contributes a deny, handled above.
+	deciding := 1
+	for i := 2; i < len(trace); i++ {
+		if rank(trace[i].Action) > rank(trace[deciding].Action) {
+			deciding = i
+		}
+	}
+	return decisionFrom(trace, deciding, len(trace) > 2), writes
+}
+
+// decisionFrom builds a decision whose outcome is that of trace[deciding].
+// When the trace has several parts the reason names the deciding one.
+func decisionFrom(trace []Evaluation, deciding int, multi bool) Decision {
+	ev := &trace[deciding]
+	d := Decision{Action: ev.Action, Trace: trace}
+
+	var subject string
+	if multi {
+		subject = fmt.Sprintf("%s %q: ", ev.Tool, ev.Input)
+	}
+	switch w := ev.Winner(); {
+	case ev.Note != "":
+		d.Reason = subject + ev.Note
+	case w != nil:
+		rule := w.Rule
+		d.Rule = &rule
+		d.Score = w.Score
+		d.Reason = fmt.Sprintf("%smatched %s from %s (score %d)", subject, describeRule(rule), describeRuleSource(rule), w.Score)
+	default:
+		d.Reason = fmt.Sprintf("%sno rule matched, so the default (%s) applies", subject, ev.Action)
+	}
+	return d
+}
+
+// describeRule formats a rule with its action always spelled out.
+func describeRule(r Rule) string {
+	return fmt.Sprintf("%s(%s):%s", titleCase(r.Tool), r.Pattern, r.Action)
+}
+
+// describeRuleSource says where a rule came from, marking locked ones.
+func describeRuleSource(r Rule) string {
+	if r.Locked {
+		return "the managed policy " + r.Source
+	}
+	return describeSource(r.Source)
+}
+
+func describeSource(source string) string {
+	switch source {
+	case SourceDefault:
+		return "the built-in defaults"
+	case SourceSession:
+		return "this session"
+	default:
+		return source
+	}
+}
+
+// rank orders actions by restrictiveness: deny, then ask, then allow.
+func rank(a Action) int {
+	switch a {
+	case Deny:
+		return 2
+	case Ask:
+		return 1
+	default:
+		return 0
+	}
+}
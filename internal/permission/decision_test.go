@@ -0,0 +1,123 @@
+package permission
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+	c.AddRule(Rule{Tool: "bash", Pattern: "go:*", Action: Allow})
+
+	tests := []struct {
+		name       string
+		tool       string
+		input      string
+		action     Action
+		rule       string
+		source     string
+		reasonPart string
+	}{
+		{
+			name: "default rule", tool: "read", input: "main.go",
+			action: Allow, rule: "Read(*)", source: SourceDefault, reasonPart: "matched Read(*):allow from the built-in defaults (score 100)",
+		},
+		{
+			name: "project rule", tool: "bash", input: "go test ./...",
+			action: Allow, rule: "Bash(go:*)", source: filepath.Join(dir, ".milo", "permissions.yaml"), reasonPart: "permissions.yaml (score 154)",
+		},
+		{
+			name: "deciding part of a pipeline", tool: "bash", input: "go test | tee out",
+			action: Ask, rule: "Bash(*):ask", source: SourceDefault, reasonPart: `bash "tee out": matched Bash(*):ask`,
+		},
+		{
+			name: "unanalysable command", tool: "bash", input: "$CMD",
+			action: Ask, reasonPart: "can't be checked statically",
+		},
+		{
+			name: "no rule", tool: "mystery", input: "x",
+			action: Ask, reasonPart: "no rule matched, so the default (ask) applies",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := c.Decide(tt.tool, ToolInput(tt.tool, tt.input))
+			if d.Action != tt.action {
+				t.Errorf("Action = %v, want %v", d.Action, tt.action)
+			}
+			if tt.rule == "" {
+				if d.Rule != nil {
+					t.Errorf("Rule = %v, want nil", d.Rule)
+				}
+			} else if d.Rule == nil || d.Rule.String() != tt.rule || d.Rule.Source != tt.source {
+				t.Errorf("Rule = %+v, want %s from %s", d.Rule, tt.rule, tt.source)
+			}
+			if !strings.Contains(d.Reason, tt.reasonPart) {
+				t.Errorf("Reason = %q, want it to contain %q", d.Reason, tt.reasonPart)
+			}
+			if len(d.Trace) == 0 {
+				t.Error("expected a trace")
+			}
+		})
+	}
+}
+
+func TestDecideSessionGrant(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	c.AllowToolAlways("write")
+	d := c.Decide("write", ToolInput("write", "/tmp/x"))
+	if d.Action != Allow || d.Reason != "allowed for this session" {
+		t.Errorf("Decide() = %v, %q", d.Action, d.Reason)
+	}
+}
+
+func TestDecideTraceOrdersMatches(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	d := c.Decide("read", ToolInput("read", "/app/.env"))
+	if d.Action != Ask {
+		t.Fatalf("Action = %v, want ask", d.Action)
+	}
+	matches := d.Trace[0].Matches
+	for i := 1; i < len(matches); i++ {
+		if matches[i].Score > matches[i-1].Score {
+			t.Errorf("matches not sorted by score: %+v", matches)
+		}
+	}
+}
+
+func TestToolInput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		tool  string
+		value string
+		want  string
+	}{
+		{"bash", "ls -la", `{"command":"ls -la"}`},
+		{"read", "main.go", `{"file_path":"main.go"}`},
+		{"git", "push --force origin", `{"args":["--force","origin"],"operation":"push"}`},
+		{"bash", `{"command":"pwd"}`, `{"command":"pwd"}`},
+	}
+	for _, tt := range tests {
+		got := ToolInput(tt.tool, tt.value)
+		if string(got) != tt.want {
+			t.Errorf("ToolInput(%q, %q) = %s, want %s", tt.tool, tt.value, got, tt.want)
+		}
+		// The value must round-trip through extractInputString.
+		if !json.Valid(got) {
+			t.Errorf("ToolInput(%q, %q) is not valid JSON", tt.tool, tt.value)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrRuleNotFound is returned when removing a rule that isn't in the file.
+var ErrRuleNotFound = errors.New("rule not found")
+
+// ReadRules returns the rule strings in a permissions file, in file order.
+// A missing file has no rules.
+func ReadRules(path string) ([]string, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return cfg.Rules, nil
+}
+
+// AddToFile adds rule to the permissions file at path, replacing any rule
+// with the same tool and pattern. It reports whether a rule was replaced.
+func AddToFile(path string, rule Rule) (bool, error) {
+	rules, err := ReadRules(path)
+	if err != nil {
+		return false, err
+	}
+
+	replaced := false
+	for i, s := range rules {
+		if existing, err := ParseRule(s); err == nil && existing.Key() == rule.Key() {
+			rules[i] = rule.String()
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		rules = append(rules, rule.String())
+	}
+
+	return replaced, SaveConfig(path, &Config{Rules: rules})
+}
+
+// RemoveFromFile removes a rule from the permissions file at path. target
+// is a 1-based position as shown by ReadRules, a rule like "Bash(npm:*)",
+// or a key like "bash:npm:*". It returns the rule string that was removed.
+func RemoveFromFile(path, target string) (string, error) {
+	rules, err := ReadRules(path)
+	if err != nil {
+		return "", err
+	}
+
+	idx := -1
+	if n, err := strconv.Atoi(target); err == nil {
+		if n < 1 || n > len(rules) {
+			return "", fmt.Errorf("%w: no rule number %d in %s (it has %d)", ErrRuleNotFound, n, path, len(rules))
+		}
+		idx = n - 1
+	} else {
+		key := target
+		if rule, err := ParseRule(target); err == nil {
+			key = rule.Key()
+		}
+		for i, s := range rules {
+			// Bad rules can only be removed by their exact text.
+			if s == target {
+				idx = i
+				break
+			}
+			if rule, err := ParseRule(s); err == nil && rule.Key() == key {
+				idx = i
+				break
+			}
+		}
+	}
+	if idx < 0 {
+		return "", fmt.Errorf("%w: %s in %s", ErrRuleNotFound, target, path)
+	}
+
+	removed := rules[idx]
+	rules = append(rules[:idx], rules[idx+1:]...)
+	return removed, SaveConfig(path, &Config{Rules: rules})
+}
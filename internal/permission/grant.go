@@ -0,0 +1,235 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Scope is where an always-allow grant is kept.
+type Scope int
+
+const (
+	// ScopeSession keeps the grant until milo exits.
+	ScopeSession Scope = iota
+	// ScopeProject saves the grant to .milo/permissions.yaml.
+	ScopeProject
+	// ScopeGlobal saves the grant to ~/.milo/permissions.yaml.
+	ScopeGlobal
+)
+
+// String returns a human-readable representation of the scope.
+func (s Scope) String() string {
+	switch s {
+	case ScopeSession:
+		return "session"
+	case ScopeProject:
+		return "project"
+	case ScopeGlobal:
+		return "global"
+	default:
+		return "unknown"
+	}
+}
+
+// Grant always allows a tool call within scope. With a nil rule only this
+// exact input is allowed; otherwise rule, usually one from SuggestRule, is
+// added as an allow rule. It returns the rule that was added. A call with
+// several subjects, like a move, gets an allow rule for each and the first
+// is returned.
+//
+// When the managed policy disables persistent grants, a project or global
+// grant is kept for the session instead and the error wraps
+// ErrManagedPolicy. When it disables bypass modes, a grant that would allow
+// every call of a tool is refused, with an error that also wraps
+// ErrManagedPolicy.
+func (c *Checker) Grant(toolName string, toolInput json.RawMessage, rule *Rule, scope Scope) (Rule, error) {
+	c.mu.Lock()
+	input := c.normalizeInput(toolName, extractInputString(toolName, toolInput))
+	subjects, reported := c.reportedSubjects(toolName, toolInput)
+	if reported {
+		input = subjectsInput(subjects)
+	}
+
+	wholeTool := input == ""
+	if rule != nil {
+		wholeTool = rule.Tool == "*" || rule.Pattern == "*"
+	}
+	if wholeTool && c.disableBypass {
+		c.mu.Unlock()
+		return Rule{}, fmt.Errorf("allowing every %s call: %w", toolName, ErrManagedPolicy)
+	}
+
+	var downgraded error
+	if scope != ScopeSession && c.disablePersistent {
+		downgraded = fmt.Errorf("saving a %s grant: %w; kept for this session", scope, ErrManagedPolicy)
+		scope = ScopeSession
+	}
+
+	var rules []Rule
+	if rule != nil {
+		r := *rule
+		r.Action = Allow
+		rules = append(rules, r)
+	} else {
+		// The exact call is allowed for the session straight away: a bash
+		// rule for the whole command line doesn't match its parsed parts.
+		if input == "" {
+			c.sessionAlways[toolName] = true
+		} else {
+			c.sessionAlways[toolName+":"+input] = true
+		}
+		switch {
+		case reported && len(subjects) > 0:
+			for _, s := range subjects {
+				rules = append(rules, Rule{Tool: toolName, Pattern: s.Value, Action: Allow})
+			}
+		case input != "":
+			rules = append(rules, Rule{Tool: toolName, Pattern: input, Action: Allow})
+		default:
+			rules = append(rules, Rule{Tool: toolName, Pattern: "*", Action: Allow})
+		}
+	}
+
+	var source string
+	switch scope {
+	case ScopeSession:
+		source = SourceSession
+	case ScopeProject:
+		if c.workDir == "" {
+			c.mu.Unlock()
+			return rules[0], fmt.Errorf("no working directory set")
+		}
+		source = ProjectFile(c.workDir)
+	case ScopeGlobal:
+		global, err := GlobalFile()
+		if err != nil {
+			c.mu.Unlock()
+			return rules[0], err
+		}
+		source = global
+	}
+	for i := range rules {
+		rules[i].Source = source
+		if scope == ScopeSession {
+			c.sessionRules[rules[i].Key()] = rules[i]
+		} else {
+			c.customRules[rules[i].Key()] = rules[i]
+		}
+	}
+	workDir := c.workDir
+	c.mu.Unlock()
+
+	switch scope {
+	case ScopeProject:
+		return rules[0], c.SaveToDirectory(workDir)
+	case ScopeGlobal:
+		for _, r := range rules {
+			if _, err := AddToFile(source, r); err != nil {
+				return rules[0], err
+			}
+		}
+	}
+	return rules[0], downgraded
+}
+
+// subcommand matches a word that names a subcommand, like "test" in
+// "go test" or "run" in "npm run", rather than a flag or a path.
+var subcommand = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// SuggestRule returns an allow rule that generalizes a tool call, such as
+// Bash(go test:*) for "go test ./...", Edit(./internal/tool/*.go) for a
+// file in that directory or Web_fetch(go.dev) for a page on that host, or
+// nil if there is no safe generalization. A
+// suggestion never covers a built-in ask or deny rule.
+func (c *Checker) SuggestRule(toolName string, toolInput json.RawMessage) *Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	input := c.normalizeInput(toolName, extractInputString(toolName, toolInput))
+	if input == "" {
+		return nil
+	}
+
+	var candidates []Rule
+	switch toolName {
+	case "bash":
+		analysis := analyzeCommand(input)
+		if analysis.Opaque || len(analysis.Commands) != 1 || len(analysis.Writes) > 0 {
+			return nil
+		}
+		words := strings.Fields(analysis.Commands[0])
+		if len(words) == 0 {
+			return nil
+		}
+		// Prefer the command with its subcommand, then the bare command.
+		if len(words) > 1 && subcommand.MatchString(words[1]) {
+			candidates = append(candidates, Rule{Tool: "bash", Pattern: words[0] + " " + words[1] + ":*"})
+		}
+		candidates = append(candidates, Rule{Tool: "bash", Pattern: words[0] + ":*"})
+	case "read", "write", "edit":
+		if c.workDir == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(resolvePath("", c.workDir), filepath.Dir(input))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil
+		}
+		dir := "./"
+		if rel != "." {
+			dir += rel + "/"
+		}
+		if ext := filepath.Ext(input); ext != "" {
+			candidates = append(candidates, Rule{Tool: toolName, Pattern: dir + "*" + ext})
+		}
+	case "web_fetch":
+		if host := urlHost(input); host != "" {
+			candidates = append(candidates, Rule{Tool: toolName, Pattern: host})
+		}
+	}
+
+	for _, r := range candidates {
+		r.Action = Allow
+		if r.Pattern != input && c.matches(r, toolName, input) && !c.coversDefault(r, filepath.Dir(input)) {
+			return &r
+		}
+	}
+	return nil
+}
+
+// matches reports whether r matches input, expanding "./" and "~/" path
+// patterns the way evaluate does.
+// Must be called with at least a read lock held.
+func (c *Checker) matches(r Rule, toolName, input string) bool {
+	if isFilePathTool(toolName) {
+		r.Pattern = c.expandPattern(r.Pattern)
+	}
+	return r.Matches(toolName, input)
+}
+
+// coversDefault reports whether r would match an input that a built-in ask
+// or deny rule exists to catch, such as "rm -rf /" or a .env file in dir.
+// Must be called with at least a read lock held.
+func (c *Checker) coversDefault(r Rule, dir string) bool {
+	for _, d := range c.defaultRules {
+		if d.Action == Allow || d.Pattern == "*" || (d.Tool != r.Tool && d.Tool != "*") {
+			continue
+		}
+		if c.matches(r, r.Tool, exampleInput(d, dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// exampleInput returns the shortest input that pattern rule d matches: its
+// pattern with the wildcards left empty, placed in dir for path rules.
+func exampleInput(d Rule, dir string) string {
+	example := strings.TrimSuffix(d.Pattern, ":*")
+	if isFilePathTool(d.Tool) && !strings.HasPrefix(example, "/") {
+		example = filepath.Join(dir, strings.TrimPrefix(example, "*/"))
+	}
+	return strings.ReplaceAll(example, "*", "")
+}
@@ -0,0 +1,121 @@
+package permission
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGrantScopes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+
+	// The exact call for the session: allowed now, not saved, and the
+	// rest of the tool still asks.
+	if _, err := c.Grant("bash", ToolInput("bash", "make build && make test"), nil, ScopeSession); err != nil {
+		t.Fatalf("Grant(session) error = %v", err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make build && make test")); got != Allow {
+		t.Errorf("granted command = %s, want allow", got)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make deploy")); got != Ask {
+		t.Errorf("other command = %s, want ask (a grant must not allow the whole tool)", got)
+	}
+	if _, err := os.Stat(ProjectFile(dir)); !os.IsNotExist(err) {
+		t.Errorf("session grant wrote %s", ProjectFile(dir))
+	}
+
+	// A suggested rule for the project is saved there.
+	rule := &Rule{Tool: "bash", Pattern: "go test:*"}
+	added, err := c.Grant("bash", ToolInput("bash", "go test ./..."), rule, ScopeProject)
+	if err != nil {
+		t.Fatalf("Grant(project) error = %v", err)
+	}
+	if added.Source != ProjectFile(dir) || added.Action != Allow {
+		t.Errorf("added rule = %+v", added)
+	}
+	if got := c.Check("bash", ToolInput("bash", "go test -run TestX ./internal/...")); got != Allow {
+		t.Errorf("go test variant = %s, want allow", got)
+	}
+	rules, err := ReadRules(ProjectFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, ",") != "Bash(go test:*)" {
+		t.Errorf("project rules = %v, want only Bash(go test:*)", rules)
+	}
+}
+
+func TestGrantGlobal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	c := NewChecker()
+	c.SetWorkDir(t.TempDir())
+	if _, err := c.Grant("web_fetch", nil, nil, ScopeGlobal); err != nil {
+		t.Fatalf("Grant(global) error = %v", err)
+	}
+
+	rules, err := ReadRules(filepath.Join(home, ".milo", "permissions.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, ",") != "Web_fetch(*)" {
+		t.Errorf("global rules = %v", rules)
+	}
+	// Saving the project must not copy the global rule into it.
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := ReadRules(ProjectFile(c.WorkDir())); len(rules) != 0 {
+		t.Errorf("project rules = %v, want none", rules)
+	}
+}
+
+func TestSuggestRule(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+
+	tests := []struct {
+		tool  string
+		input string
+		want  string // "" for no suggestion
+	}{
+		{"bash", "go test ./internal/...", "Bash(go test:*)"},
+		{"bash", "npm run build", "Bash(npm run:*)"},
+		{"bash", "make", "Bash(make:*)"},
+		{"bash", "pytest -x tests/", "Bash(pytest:*)"},
+		{"bash", "timeout 60 cargo build", ""}, // the timeout wrapper is checked too
+		{"bash", "rm -rf build", ""},           // rm:* would cover rm -rf /
+		{"bash", "chmod -R 777 web", ""},       // covers a built-in deny
+		{"bash", "go test ./... | tee x", ""},  // more than one command
+		{"bash", "go build > out.txt", ""},     // writes a file
+		{"bash", "printenv HOME", ""},          // covers the built-in ask for printenv
+		{"edit", filepath.Join(dir, "internal", "tool", "bash.go"), "Edit(./internal/tool/*.go)"},
+		{"write", filepath.Join(dir, "main.go"), "Write(./*.go)"},
+		{"write", filepath.Join(dir, "config", "prod.env"), ""}, // sensitive
+		{"write", filepath.Join(dir, "Makefile"), ""},           // no extension
+		{"write", "/etc/cron.d/job.sh", ""},                     // outside the project
+		{"todo", `{}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool+" "+tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got := c.SuggestRule(tt.tool, ToolInput(tt.tool, tt.input))
+			switch {
+			case got == nil && tt.want != "":
+				t.Errorf("SuggestRule() = nil, want %s", tt.want)
+			case got != nil && got.String() != tt.want:
+				t.Errorf("SuggestRule() = %s, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package permission
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IssueKind classifies a problem found by Lint.
+type IssueKind string
+
+const (
+	// IssueInvalid is a rule that doesn't parse.
+	IssueInvalid IssueKind = "invalid"
+	// IssueDuplicate is a rule with the same tool and pattern as an earlier one.
+	IssueDuplicate IssueKind = "duplicate"
+	// IssueShadowed is a rule that can never win because a more specific
+	// rule with a different action matches everything it matches.
+	IssueShadowed IssueKind = "shadowed"
+	// IssueUnmatchable is a rule whose pattern can never match its tool's input.
+	IssueUnmatchable IssueKind = "unmatchable"
+)
+
+// Issue is a problem with one rule in a permissions file.
+type Issue struct {
+	Source  string // File the rule is in
+	Index   int    // 1-based position of the rule in the file
+	Rule    string // Rule text as written
+	Kind    IssueKind
+	Message string
+}
+
+// String formats the issue as "file:index: rule: kind: message".
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s: %s", i.Source, i.Index, i.Rule, i.Kind, i.Message)
+}
+
+// patternTools maps the tools whose rules match against an extracted or
+// reported input to a description of that input. Other known tools only
+// support "*".
+var patternTools = map[string]string{
+	"bash":       "command",
+	"read":       "path",
+	"write":      "path",
+	"edit":       "path",
+	"glob":       "path",
+	"grep":       "path",
+	"multi_read": "path",
+	"move":       "path",
+	"diff":       "path",
+	"undo":       "path",
+	"lsp":        "path",
+	"list_dir":   "path",
+	"tree":       "path",
+	"git":        "operation",
+	"web_fetch":  "host or URL",
+	"web_search": "query",
+}
+
+// knownTools lists tools whose rules can only use the "*" pattern.
+var knownTools = map[string]bool{
+	"todo": true, "job": true,
+}
+
+// lintedRule is a parsed rule with where it was found.
+type lintedRule struct {
+	rule  Rule
+	text  string
+	index int
+}
+
+// Lint checks the permissions files at paths, in load order, and reports
+// unparsable, duplicate, shadowed and unmatchable rules. Missing files and
+// repeated paths (the project file is the global one when run from $HOME)
+// are skipped.
+func Lint(paths ...string) ([]Issue, error) {
+	var issues []Issue
+	var parsed []lintedRule
+	seen := make(map[string]lintedRule)
+	linted := make(map[string]bool)
+
+	for _, path := range paths {
+		if linted[path] {
+			continue
+		}
+		linted[path] = true
+		rules, err := ReadRules(path)
+		if err != nil {
+			return nil, err
+		}
+		for i, text := range rules {
+			issue := Issue{Source: path, Index: i + 1, Rule: text}
+			rule, err := ParseRule(text)
+			if err != nil {
+				issue.Kind, issue.Message = IssueInvalid, err.Error()
+				issues = append(issues, issue)
+				continue
+			}
+			rule.Source = path
+
+			if prev, ok := seen[rule.Key()]; ok {
+				issue.Kind = IssueDuplicate
+				issue.Message = fmt.Sprintf("same tool and pattern as rule %d in %s; this one wins", prev.index, prev.rule.Source)
+				issues = append(issues, issue)
+			}
+			lr := lintedRule{rule: rule, text: text, index: i + 1}
+			seen[rule.Key()] = lr
+			parsed = append(parsed, lr)
+
+			if msg := unmatchable(rule); msg != "" {
+				issue.Kind, issue.Message = IssueUnmatchable, msg
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	// Only the rules that survive duplicate resolution take part, alongside
+	// the built-in defaults.
+	var active []lintedRule
+	for _, lr := range parsed {
+		if seen[lr.rule.Key()] == lr {
+			active = append(active, lr)
+		}
+	}
+	candidates := NewChecker().defaultRules
+	for _, lr := range active {
+		candidates = append(candidates, lr.rule)
+	}
+	for _, lr := range active {
+		if by := shadowedBy(lr.rule, candidates); by != nil {
+			issues = append(issues, Issue{
+				Source: lr.rule.Source,
+				Index:  lr.index,
+				Rule:   lr.text,
+				Kind:   IssueShadowed,
+				Message: fmt.Sprintf("%s from %s is more specific (score %d > %d) and matches everything this rule does",
+					describeRule(*by), describeSource(by.Source), by.Specificity(), lr.rule.Specificity()),
+			})
+		}
+	}
+
+	// Report in file order.
+	order := make(map[string]int, len(paths))
+	for i, p := range paths {
+		order[p] = i
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Source != issues[j].Source {
+			return order[issues[i].Source] < order[issues[j].Source]
+		}
+		return issues[i].Index < issues[j].Index
+	})
+	return issues, nil
+}
+
+// shadowedBy returns a rule that always beats r with a different action,
+// or nil. A rule covers r when it matches r's pattern read as an input.
+func shadowedBy(r Rule, candidates []Rule) *Rule {
+	for i := range candidates {
+		s := &candidates[i]
+		if s.Key() == r.Key() || s.Action == r.Action || s.Specificity() <= r.Specificity() {
+			continue
+		}
+		if s.Tool != "*" && s.Tool != r.Tool {
+			continue
+		}
+		if s.Pattern == "*" || s.Matches(r.Tool, r.Pattern) {
+			return s
+		}
+	}
+	return nil
+}
+
+// unmatchable explains why r's pattern can never match its tool's input,
+// or returns "".
+func unmatchable(r Rule) string {
+	if r.Tool == "*" {
+		return ""
+	}
+
+	input, hasInput := patternTools[r.Tool]
+	switch {
+	case !hasInput && !knownTools[r.Tool]:
+		return fmt.Sprintf("there is no tool named %q", r.Tool)
+	case r.Pattern == "*":
+		return ""
+	case !hasInput:
+		return fmt.Sprintf("%s rules have no input to match; only %s(*) works", r.Tool, titleCase(r.Tool))
+	}
+
+	if _, err := filepath.Match(r.Pattern, ""); err != nil {
+		return fmt.Sprintf("invalid glob: %v", err)
+	}
+
+	pathLike := strings.Contains(r.Pattern, "**") || strings.HasPrefix(r.Pattern, "*.") || strings.HasPrefix(r.Pattern, "./")
+	switch input {
+	case "command", "operation":
+		if pathLike {
+			return fmt.Sprintf("looks like a file path pattern, but %s rules match the %s", r.Tool, input)
+		}
+	case "path":
+		if strings.HasSuffix(r.Pattern, ":*") {
+			return fmt.Sprintf("the :* suffix only works for bash; %s rules match a path", r.Tool)
+		}
+		if relativePathPattern(r.Pattern) {
+			return fmt.Sprintf("%s rules match absolute paths; use ./%s for a path in the project", r.Tool, r.Pattern)
+		}
+	case "host or URL":
+		if strings.Contains(r.Pattern, "/") && !strings.Contains(r.Pattern, "://") {
+			return fmt.Sprintf("%s rules match a host like *.go.dev, or a whole URL starting with https://", r.Tool)
+		}
+	}
+	return ""
+}
+
+// relativePathPattern reports whether a path pattern names a directory
+// without anchoring it, like "src/*.go". Such patterns never match the
+// absolute paths file tools are checked with.
+func relativePathPattern(pattern string) bool {
+	if !strings.Contains(pattern, "/") {
+		return false
+	}
+	for _, prefix := range []string{"/", "./", "~/", "*"} {
+		if strings.HasPrefix(pattern, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package permission
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRules(t *testing.T, dir string, rules ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, "permissions.yaml")
+	content := "rules:\n"
+	for _, r := range rules {
+		content += "  - '" + r + "'\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	global := writeRules(t, t.TempDir(),
+		"Bash(npm:*)",
+		"Read(*.env)",
+	)
+	project := writeRules(t, t.TempDir(),
+		"Bash(npm:*):deny",             // duplicate of the global rule
+		"Bash(*.go)",                   // path pattern on bash
+		"Bash(go test*",                // unparsable
+		"Todo(list)",                   // tool without input
+		"Bsh(ls)",                      // typo
+		"Write(*.log:*)",               // command syntax on a path
+		"Read(*.env.local)",            // fine
+		"Read(/srv/*.env):allow",       // fine: more specific than Read(*.env)
+		"Bash(make test)",              // shadowed by the next rule
+		"Bash(make test*):deny",        // covers it and scores higher
+		"Bash(make:*)", "Bash(make:*)", // duplicate within a file
+		"Write(src/*.go)",        // relative path never matches
+		"Write(./src/*.go)",      // fine
+		"WebFetch(go.dev/doc/*)", // path without a scheme
+		"WebFetch(*.go.dev)",     // fine
+	)
+
+	// project is listed twice, as when milo runs from $HOME.
+	issues, err := Lint(global, project, project, filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+
+	want := []struct {
+		source string
+		index  int
+		kind   IssueKind
+		msg    string
+	}{
+		{project, 1, IssueDuplicate, "rule 1 in " + global},
+		{project, 2, IssueUnmatchable, "file path pattern"},
+		{project, 3, IssueInvalid, "missing ')'"},
+		{project, 4, IssueUnmatchable, "only Todo(*) works"},
+		{project, 5, IssueUnmatchable, `no tool named "bsh"`},
+		{project, 6, IssueUnmatchable, ":* suffix only works for bash"},
+		{project, 9, IssueShadowed, "Bash(make test*):deny from " + project + " is more specific (score 160 > 159)"},
+		{project, 12, IssueDuplicate, "rule 11 in " + project},
+		{project, 13, IssueUnmatchable, "use ./src/*.go"},
+		{project, 15, IssueUnmatchable, "whole URL starting with https://"},
+	}
+	if len(issues) != len(want) {
+		for _, i := range issues {
+			t.Log(i)
+		}
+		t.Fatalf("got %d issues, want %d", len(issues), len(want))
+	}
+	for i, w := range want {
+		got := issues[i]
+		if got.Source != w.source || got.Index != w.index || got.Kind != w.kind || !strings.Contains(got.Message, w.msg) {
+			t.Errorf("issue %d = %s, want %s:%d %s containing %q", i, got, w.source, w.index, w.kind, w.msg)
+		}
+	}
+}
+
+func TestAddAndRemoveFromFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ".milo", "permissions.yaml")
+
+	if replaced, err := AddToFile(path, Rule{Tool: "bash", Pattern: "npm:*", Action: Allow}); err != nil || replaced {
+		t.Fatalf("AddToFile() = %v, %v", replaced, err)
+	}
+	if _, err := AddToFile(path, Rule{Tool: "bash", Pattern: "make*", Action: Allow}); err != nil {
+		t.Fatal(err)
+	}
+	if replaced, err := AddToFile(path, Rule{Tool: "bash", Pattern: "npm:*", Action: Deny}); err != nil || !replaced {
+		t.Fatalf("AddToFile() replace = %v, %v", replaced, err)
+	}
+
+	rules, err := ReadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, ",") != "Bash(npm:*):deny,Bash(make*)" {
+		t.Errorf("rules = %v", rules)
+	}
+
+	if removed, err := RemoveFromFile(path, "2"); err != nil || removed != "Bash(make*)" {
+		t.Errorf("RemoveFromFile(2) = %q, %v", removed, err)
+	}
+	if removed, err := RemoveFromFile(path, "Bash(npm:*)"); err != nil || removed != "Bash(npm:*):deny" {
+		t.Errorf("RemoveFromFile(rule) = %q, %v", removed, err)
+	}
+	if _, err := RemoveFromFile(path, "Bash(npm:*)"); err == nil {
+		t.Error("expected error removing a missing rule")
+	}
+}
+
+func TestLoadFromFileReportsAllBadRules(t *testing.T) {
+	t.Parallel()
+
+	path := writeRules(t, t.TempDir(), "Bash(a", "Bash(npm:*)", "Bash(b):maybe")
+
+	c := NewChecker()
+	loaded, err := c.LoadFromFile(path)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if loaded != 1 {
+		t.Errorf("loaded = %d, want the one valid rule", loaded)
+	}
+	if !strings.Contains(err.Error(), "rule 1") || !strings.Contains(err.Error(), "rule 3") {
+		t.Errorf("error should name both bad rules: %v", err)
+	}
+}
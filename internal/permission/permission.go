@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 // Action represents the permission decision for a tool.
@@ -51,8 +53,22 @@ type Rule struct {
 
 	// Action is the permission action to take when this rule matches.
 	Action Action
+
+	// Source is where the rule came from: SourceDefault, SourceSession or
+	// the path of the permissions file that defined it.
+	Source string
+
+	// Locked marks a rule from the managed policy, which other rules
+	// can't loosen and which can't be removed from within milo.
+	Locked bool
 }
 
+// Rule sources other than permission files.
+const (
+	SourceDefault = "default"
+	SourceSession = "session"
+)
+
 // Key returns a unique identifier for this rule (tool:pattern).
 func (r *Rule) Key() string {
 	return r.Tool + ":" + r.Pattern
@@ -136,14 +152,35 @@ func ParseRule(s string) (Rule, error) {
 	}
 
 	return Rule{
-		Tool:    strings.ToLower(tool),
+		Tool:    toolName(tool),
 		Pattern: pattern,
 		Action:  action,
 	}, nil
 }
 
+// toolName converts the tool name in a rule to the registered name, so
+// "Bash" becomes "bash" and "WebFetch" or "Web_fetch" becomes "web_fetch".
+func toolName(s string) string {
+	if strings.Contains(s, "_") {
+		return strings.ToLower(s)
+	}
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(s[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
 // Matches checks if this rule matches the given tool name and input.
 func (r *Rule) Matches(toolName, input string) bool {
+	return r.matchesAs(toolName, input, kindOf(toolName))
+}
+
+// matchesAs checks if this rule matches an input of the given kind.
+func (r *Rule) matchesAs(toolName, input string, kind SubjectKind) bool {
 	// Check tool name match
 	if r.Tool != "*" && r.Tool != toolName {
 		return false
@@ -154,6 +191,16 @@ func (r *Rule) Matches(toolName, input string) bool {
 		return true
 	}
 
+	// URLs match on the host, or the whole URL
+	if kind == SubjectURL {
+		return matchURL(r.Pattern, input)
+	}
+
+	// "**" spans directories in path patterns
+	if kind == SubjectPath && strings.Contains(r.Pattern, "**") {
+		return matchPath(r.Pattern, input)
+	}
+
 	// Use filepath.Match for glob matching
 	matched, err := filepath.Match(r.Pattern, input)
 	if err != nil {
@@ -164,8 +211,8 @@ func (r *Rule) Matches(toolName, input string) bool {
 		return true
 	}
 
-	// For path patterns, also try matching just the base name
-	if isFilePathTool(toolName) {
+	// Patterns without a directory, like "*.pem", also match the base name
+	if kind == SubjectPath && !strings.Contains(r.Pattern, "/") {
 		baseName := filepath.Base(input)
 		matched, err = filepath.Match(r.Pattern, baseName)
 		if err == nil && matched {
@@ -176,7 +223,7 @@ func (r *Rule) Matches(toolName, input string) bool {
 	// For command patterns with colon syntax: "git:*" means command "git" with any args.
 	// This matches "git", "git status" but NOT "gitconfig".
 	// Also handles compound commands (cd /path && go test) by checking each part.
-	if toolName == "bash" && strings.HasSuffix(r.Pattern, ":*") {
+	if kind == SubjectCommand && strings.HasSuffix(r.Pattern, ":*") {
 		cmd := strings.TrimSuffix(r.Pattern, ":*")
 		// Check the full command first
 		if matchesBashPattern(input, cmd) {
@@ -267,8 +314,21 @@ type Checker struct {
 	defaultRules  []Rule          // Built-in rules (read-only)
 	customRules   map[string]Rule // User-defined rules keyed by tool:pattern
 	sessionAlways map[string]bool // Session-level always-allow
+	sessionRules  map[string]Rule // Rules granted for this session only
 	defaultAction Action
-	workDir       string // Working directory for saving config
+	workDir       string   // Working directory for saving config
+	sandboxed     bool     // Bash commands run in a sandbox
+	envScrubbed   bool     // Secrets are stripped from the bash environment
+	extraDirs     []string // Resolved workspace directories besides workDir
+	outsideReads  Action   // Action for file reads outside the workspace
+	outsideWrites Action   // Action for file writes outside the workspace
+
+	subjects          SubjectFunc   // Subjects of tool calls, from the tools
+	bashDir           func() string // Where bash commands run, if not workDir
+	warnings          []string      // Rules skipped while loading
+	managedRules      []Rule        // Locked rules from the managed policy
+	disableBypass     bool          // The policy turns off prompt-skipping modes
+	disablePersistent bool          // The policy keeps grants out of permission files
 }
 
 // NewChecker creates a permission checker with default rules.
@@ -277,11 +337,17 @@ func NewChecker() *Checker {
 		defaultRules:  make([]Rule, 0),
 		customRules:   make(map[string]Rule),
 		sessionAlways: make(map[string]bool),
+		sessionRules:  make(map[string]Rule),
 		defaultAction: Ask,
+		outsideReads:  Allow,
+		outsideWrites: Ask,
 	}
 
 	// Add default rules for safe operations
 	c.addDefaultRules()
+	for i := range c.defaultRules {
+		c.defaultRules[i].Source = SourceDefault
+	}
 
 	return c
 }
@@ -296,6 +362,7 @@ func (c *Checker) addDefaultRules() {
 		Rule{Tool: "glob", Pattern: "*", Action: Allow},
 		Rule{Tool: "grep", Pattern: "*", Action: Allow},
 		Rule{Tool: "todo", Pattern: "*", Action: Allow}, // Internal state only
+		Rule{Tool: "job", Pattern: "*", Action: Allow},  // Only touches jobs started via bash
 	)
 
 	// Git tool permissions - safe read-only operations
@@ -332,6 +399,10 @@ func (c *Checker) addDefaultRules() {
 		"git remote*",
 		"ls*",
 		"pwd*",
+		// cd writes nothing itself. A relative redirect after it can't be
+		// placed statically, so that makes the command ask; see
+		// shellAnalysis.changesDir.
+		"cd:*",
 		"cat *",
 		"head *",
 		"tail *",
@@ -343,8 +414,6 @@ func (c *Checker) addDefaultRules() {
 		"whoami*",
 		"hostname*",
 		"uname*",
-		"env*",
-		"printenv*",
 		"go version*",
 		"go list*",
 		"go mod graph*",
@@ -359,6 +428,12 @@ func (c *Checker) addDefaultRules() {
 		c.defaultRules = append(c.defaultRules, Rule{Tool: "bash", Pattern: cmd, Action: Allow})
 	}
 
+	// Commands that dump the environment are only safe once secrets have
+	// been scrubbed from it; see SetEnvScrubbed.
+	for _, cmd := range envCommands {
+		c.defaultRules = append(c.defaultRules, Rule{Tool: "bash", Pattern: cmd, Action: Ask})
+	}
+
 	// Dangerous patterns that should always be denied
 	// Use :* suffix for prefix matching
 	dangerousPatterns := []string{
@@ -374,7 +449,11 @@ func (c *Checker) addDefaultRules() {
 		c.defaultRules = append(c.defaultRules, Rule{Tool: "bash", Pattern: pattern, Action: Deny})
 	}
 
-	// Sensitive file patterns that should require confirmation
+	// Redirecting bash output onto a raw disk is as bad as mkfs
+	c.defaultRules = append(c.defaultRules, Rule{Tool: "write", Pattern: "/dev/sd*", Action: Deny})
+
+	// Sensitive file patterns that should require confirmation, for every
+	// tool that reads or changes file contents
 	sensitiveFiles := []string{
 		"*.env",
 		"*/.env",
@@ -392,6 +471,9 @@ func (c *Checker) addDefaultRules() {
 			Rule{Tool: "write", Pattern: pattern, Action: Ask},
 			Rule{Tool: "edit", Pattern: pattern, Action: Ask},
 			Rule{Tool: "read", Pattern: pattern, Action: Ask},
+			Rule{Tool: "multi_read", Pattern: pattern, Action: Ask},
+			Rule{Tool: "diff", Pattern: pattern, Action: Ask},
+			Rule{Tool: "move", Pattern: pattern, Action: Ask},
 		)
 	}
 
@@ -403,6 +485,63 @@ func (c *Checker) addDefaultRules() {
 	)
 }
 
+// SetSandboxed relaxes the catch-all bash rule from ask to allow when bash
+// commands run inside a sandbox that keeps them off the network and writing
+// only to the project and the temp directory. A sandbox with the network or
+// extra writable paths doesn't count. Deny rules and custom rules still
+// apply. A managed policy with disable_bypass keeps it at ask.
+func (c *Checker) SetSandboxed(sandboxed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sandboxed = sandboxed
+	c.applySandbox()
+}
+
+// applySandbox sets the catch-all bash rule for the sandbox setting, unless
+// the managed policy disables bypass modes.
+// Must be called with c.mu held.
+func (c *Checker) applySandbox() {
+	action := Ask
+	if c.sandboxed && !c.disableBypass {
+		action = Allow
+	}
+	for i, rule := range c.defaultRules {
+		if rule.Tool == "bash" && rule.Pattern == "*" {
+			c.defaultRules[i].Action = action
+		}
+	}
+}
+
+// envCommands are bash patterns that print the whole environment.
+var envCommands = []string{"env*", "printenv*"}
+
+// SetEnvScrubbed allows commands that print the environment without a
+// prompt when secrets are stripped from the bash environment, and asks
+// for them otherwise.
+func (c *Checker) SetEnvScrubbed(scrubbed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.envScrubbed = scrubbed
+	action := Ask
+	if scrubbed {
+		action = Allow
+	}
+	for i, rule := range c.defaultRules {
+		if rule.Tool == "bash" && slices.Contains(envCommands, rule.Pattern) {
+			c.defaultRules[i].Action = action
+		}
+	}
+}
+
+// Sandboxed reports whether bash commands run inside a sandbox.
+func (c *Checker) Sandboxed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sandboxed
+}
+
 // SetWorkDir sets the working directory for config file operations.
 func (c *Checker) SetWorkDir(dir string) {
 	c.mu.Lock()
@@ -419,57 +558,24 @@ func (c *Checker) WorkDir() string {
 
 // Check returns the permission action for the given tool and input.
 // It evaluates rules in order of specificity, returning the action
-// of the most specific matching rule.
+// of the most specific matching rule. Use Decide to find out why.
 func (c *Checker) Check(toolName string, toolInput json.RawMessage) Action {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	// Extract the relevant input string based on tool type
-	input := extractInputString(toolName, toolInput)
-
-	// Check session-level always-allow first
-	sessionKey := toolName + ":" + input
-	if c.sessionAlways[sessionKey] {
-		return Allow
-	}
-	// Also check tool-level always-allow for backwards compatibility
-	if c.sessionAlways[toolName] {
-		return Allow
-	}
-
-	// Combine all rules for evaluation
-	allRules := c.allRules()
-
-	// Find the most specific matching rule
-	var bestMatch *Rule
-	bestScore := -1
-
-	for i := range allRules {
-		rule := &allRules[i]
-		if rule.Matches(toolName, input) {
-			score := rule.Specificity()
-			if score > bestScore {
-				bestScore = score
-				bestMatch = rule
-			}
-		}
-	}
-
-	if bestMatch != nil {
-		return bestMatch.Action
-	}
-
-	return c.defaultAction
+	return c.Decide(toolName, toolInput).Action
 }
 
-// allRules returns all rules (default + custom) for evaluation.
+// allRules returns all rules (default, managed, custom and session) for
+// evaluation.
 // Must be called with at least a read lock held.
 func (c *Checker) allRules() []Rule {
-	result := make([]Rule, 0, len(c.defaultRules)+len(c.customRules))
+	result := make([]Rule, 0, len(c.defaultRules)+len(c.managedRules)+len(c.customRules)+len(c.sessionRules))
 	result = append(result, c.defaultRules...)
+	result = append(result, c.managedRules...)
 	for _, rule := range c.customRules {
 		result = append(result, rule)
 	}
+	for _, rule := range c.sessionRules {
+		result = append(result, rule)
+	}
 	return result
 }
 
@@ -508,6 +614,14 @@ func extractInputString(toolName string, toolInput json.RawMessage) string {
 		if path, ok := data["path"].(string); ok {
 			return path
 		}
+	case "web_fetch":
+		if u, ok := data["url"].(string); ok {
+			return u
+		}
+	case "web_search":
+		if query, ok := data["query"].(string); ok {
+			return query
+		}
 	case "git":
 		if operation, ok := data["operation"].(string); ok {
 			// Include args in the input string for more specific matching
@@ -529,46 +643,107 @@ func extractInputString(toolName string, toolInput json.RawMessage) string {
 	return ""
 }
 
-// AllowAlways marks a specific tool+input combination as allowed for this session
-// and persists it to the config file.
-func (c *Checker) AllowAlways(toolName string, toolInput json.RawMessage) error {
-	input := extractInputString(toolName, toolInput)
+// normalizeInput resolves the path file tools match rules against, so
+// symlinks and ".." can't disguise where a file really is.
+// Must be called with at least a read lock held.
+func (c *Checker) normalizeInput(toolName, input string) string {
+	switch toolName {
+	case "read", "write", "edit", "grep":
+		if input != "" {
+			return resolvePath(c.workDir, input)
+		}
+	}
+	return input
+}
 
-	c.mu.Lock()
-	// Session-level allow
-	if input != "" {
-		c.sessionAlways[toolName+":"+input] = true
+// ToolInput builds tool input for toolName from the value its rules match
+// against: a command for bash, a path for file tools, a URL for web_fetch,
+// a query for web_search, an operation and arguments for git. A value
+// that is already a JSON object is returned unchanged.
+func ToolInput(toolName, value string) json.RawMessage {
+	var obj map[string]any
+	if json.Unmarshal([]byte(value), &obj) == nil {
+		return json.RawMessage(value)
 	}
-	c.sessionAlways[toolName] = true
 
-	// Add as a custom rule for persistence
-	pattern := input
-	if pattern == "" {
-		pattern = "*"
+	switch toolName {
+	case "bash":
+		obj = map[string]any{"command": value}
+	case "read", "write", "edit":
+		obj = map[string]any{"file_path": value}
+	case "glob":
+		obj = map[string]any{"pattern": value}
+	case "grep":
+		obj = map[string]any{"path": value}
+	case "web_fetch":
+		obj = map[string]any{"url": value}
+	case "web_search":
+		obj = map[string]any{"query": value}
+	case "git":
+		fields := strings.Fields(value)
+		obj = map[string]any{}
+		if len(fields) > 0 {
+			obj["operation"] = fields[0]
+		}
+		if len(fields) > 1 {
+			obj["args"] = fields[1:]
+		}
+	default:
+		obj = map[string]any{}
 	}
-	rule := Rule{Tool: toolName, Pattern: pattern, Action: Allow}
-	c.customRules[rule.Key()] = rule
-	workDir := c.workDir
-	c.mu.Unlock()
+	data, _ := json.Marshal(obj)
+	return data
+}
 
-	// Persist to config file
-	if workDir != "" {
-		return c.SaveToDirectory(workDir)
+// AllowAlways allows this exact tool call from now on, saving the rule to
+// the project file when there is a working directory. Use Grant to choose
+// the scope or allow a broader rule.
+func (c *Checker) AllowAlways(toolName string, toolInput json.RawMessage) error {
+	scope := ScopeSession
+	if c.WorkDir() != "" {
+		scope = ScopeProject
 	}
-	return nil
+	_, err := c.Grant(toolName, toolInput, nil, scope)
+	return err
+}
+
+// savedRuleSource is the Source of rules added at runtime, which are
+// persisted to the project file when there is a working directory.
+// Must be called with c.mu held.
+func (c *Checker) savedRuleSource() string {
+	if c.workDir == "" {
+		return SourceSession
+	}
+	return ProjectFile(c.workDir)
 }
 
 // AllowToolAlways marks a tool as allowed for all inputs for this session.
-func (c *Checker) AllowToolAlways(toolName string) {
+// It fails if the managed policy disables bypass modes.
+func (c *Checker) AllowToolAlways(toolName string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.disableBypass {
+		return fmt.Errorf("allowing every %s call: %w", toolName, ErrManagedPolicy)
+	}
 	c.sessionAlways[toolName] = true
+	return nil
 }
 
 // AddRule adds a custom rule to the checker and persists to disk.
 // If a rule with the same tool:pattern already exists, it is replaced.
+// When the managed policy disables persistent grants, allow rules are kept
+// for the session only.
 func (c *Checker) AddRule(rule Rule) {
 	c.mu.Lock()
+	if c.disablePersistent && rule.Action == Allow {
+		rule.Source = SourceSession
+		c.sessionRules[rule.Key()] = rule
+		c.mu.Unlock()
+		return
+	}
+	if rule.Source == "" {
+		rule.Source = c.savedRuleSource()
+	}
 	c.customRules[rule.Key()] = rule
 	workDir := c.workDir
 	c.mu.Unlock()
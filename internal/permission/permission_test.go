@@ -671,14 +671,14 @@ func TestCompoundCommandMatching(t *testing.T) {
 		command string
 		want    Action
 	}{
-		{"go test ./...", Allow},                      // Direct match
-		{"cd /path && go test ./...", Allow},          // Compound with &&
-		{"cd /path; go build", Allow},                 // Compound with ;
-		{"echo hello || go run main.go", Allow},       // Compound with ||
-		{"cd /path && npm install && go test", Allow}, // Multiple parts, one matches
-		{"cd /path && npm install", Ask},              // No go command
-		{"gopher", Ask},                               // "gopher" is not "go"
-		{"cd /path && go-task build", Ask},            // "go-task" is not "go"
+		{"go test ./...", Allow},                    // Direct match
+		{"cd /path && go test ./...", Allow},        // Compound with &&
+		{"cd /path; go build", Allow},               // Compound with ;
+		{"echo hello || go run main.go", Allow},     // Compound with ||
+		{"cd /path && npm install && go test", Ask}, // Every part must be allowed
+		{"cd /path && npm install", Ask},            // No go command
+		{"gopher", Ask},                             // "gopher" is not "go"
+		{"cd /path && go-task build", Ask},          // "go-task" is not "go"
 	}
 
 	for _, tt := range tests {
@@ -831,3 +831,65 @@ func TestParseRuleRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestSetSandboxed(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	input := json.RawMessage(`{"command":"go test ./..."}`)
+
+	if got := c.Check("bash", input); got != Ask {
+		t.Fatalf("unsandboxed bash = %v, want ask", got)
+	}
+
+	c.SetSandboxed(true)
+	if !c.Sandboxed() {
+		t.Error("Sandboxed() = false after SetSandboxed(true)")
+	}
+	if got := c.Check("bash", input); got != Allow {
+		t.Errorf("sandboxed bash = %v, want allow", got)
+	}
+	if got := c.Check("bash", json.RawMessage(`{"command":"rm -rf /"}`)); got != Deny {
+		t.Errorf("sandboxed dangerous command = %v, want deny", got)
+	}
+	if got := c.Check("write", json.RawMessage(`{"file_path":"/tmp/x"}`)); got != Ask {
+		t.Errorf("sandbox should not relax write, got %v", got)
+	}
+
+	c.AddRule(Rule{Tool: "bash", Pattern: "go test:*", Action: Ask})
+	if got := c.Check("bash", input); got != Ask {
+		t.Errorf("custom rule should win inside the sandbox, got %v", got)
+	}
+
+	c.SetSandboxed(false)
+	if got := c.Check("bash", json.RawMessage(`{"command":"make"}`)); got != Ask {
+		t.Errorf("bash after leaving sandbox = %v, want ask", got)
+	}
+}
+
+func TestSetEnvScrubbed(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	for _, cmd := range []string{"env", "printenv HOME"} {
+		input := json.RawMessage(`{"command":"` + cmd + `"}`)
+		if got := c.Check("bash", input); got != Ask {
+			t.Errorf("%q with secrets in env = %v, want ask", cmd, got)
+		}
+	}
+
+	c.SetEnvScrubbed(true)
+	for _, cmd := range []string{"env", "printenv HOME"} {
+		input := json.RawMessage(`{"command":"` + cmd + `"}`)
+		if got := c.Check("bash", input); got != Allow {
+			t.Errorf("%q with scrubbed env = %v, want allow", cmd, got)
+		}
+	}
+
+	// Sandboxing alone doesn't make dumping the environment safe.
+	c.SetEnvScrubbed(false)
+	c.SetSandboxed(true)
+	if got := c.Check("bash", json.RawMessage(`{"command":"env"}`)); got != Ask {
+		t.Errorf("env in sandbox without scrubbing = %v, want ask", got)
+	}
+}
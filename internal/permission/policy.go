@@ -0,0 +1,144 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyEnv names the environment variable that overrides where the
+// managed policy is read from.
+const PolicyEnv = "MILO_POLICY_FILE"
+
+// DefaultPolicyFile is where the managed policy is read from unless
+// PolicyEnv is set.
+const DefaultPolicyFile = "/etc/milo/policy.yaml"
+
+// ErrManagedPolicy is returned for changes the managed policy forbids.
+var ErrManagedPolicy = errors.New("not allowed by the managed policy")
+
+// Policy is a managed permissions policy, installed by an administrator
+// outside any project or home directory. Its rules are locked: no global,
+// project or session rule can loosen them, however specific.
+type Policy struct {
+	Rules []string `yaml:"rules"`
+	// DisableBypass turns off modes that skip prompts: the sandbox
+	// allowing every bash command and allowing a whole tool for the session.
+	DisableBypass bool `yaml:"disable_bypass,omitempty"`
+	// DisablePersistentGrants keeps always-allow answers and added allow
+	// rules for the session only, instead of saving them to a permissions
+	// file.
+	DisablePersistentGrants bool `yaml:"disable_persistent_grants,omitempty"`
+}
+
+// PolicyFile returns the path of the managed policy: $MILO_POLICY_FILE if
+// set, otherwise DefaultPolicyFile.
+func PolicyFile() string {
+	if path := os.Getenv(PolicyEnv); path != "" {
+		return path
+	}
+	return DefaultPolicyFile
+}
+
+// LoadPolicy reads the managed policy at path. A missing file means there
+// is no policy and returns (nil, nil).
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy file: %w", err)
+	}
+	return &p, nil
+}
+
+// SetPolicy applies a managed policy read from source, replacing any set
+// before. Unlike other permission files, a policy with a bad rule is
+// rejected as a whole so it can't silently enforce less than intended.
+func (c *Checker) SetPolicy(p *Policy, source string) error {
+	var rules []Rule
+	var errs []error
+	if p != nil {
+		for i, ruleStr := range p.Rules {
+			rule, err := ParseRule(ruleStr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule %d: %w", i+1, err))
+				continue
+			}
+			rule.Source = source
+			rule.Locked = true
+			rules = append(rules, rule)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %w", source, errors.Join(errs...))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.managedRules = rules
+	c.disableBypass = p != nil && p.DisableBypass
+	c.disablePersistent = p != nil && p.DisablePersistentGrants
+	c.applySandbox()
+	return nil
+}
+
+// LoadManaged applies the managed policy from PolicyFile, if there is one.
+// It returns the number of locked rules loaded.
+func (c *Checker) LoadManaged() (int, error) {
+	path := PolicyFile()
+	p, err := LoadPolicy(path)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	if err := c.SetPolicy(p, path); err != nil {
+		return 0, err
+	}
+	return len(p.Rules), nil
+}
+
+// ManagedRules returns the locked rules of the managed policy, sorted.
+func (c *Checker) ManagedRules() []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := append([]Rule(nil), c.managedRules...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key() < result[j].Key()
+	})
+	return result
+}
+
+// PersistentGrantsAllowed reports whether always-allow grants and added
+// allow rules may be saved to permissions files.
+func (c *Checker) PersistentGrantsAllowed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.disablePersistent
+}
+
+// enforceLocked makes the strictest matching locked rule the winner of ev
+// when it is stricter than the rule that won on specificity.
+func enforceLocked(ev *Evaluation) {
+	strictest := -1
+	for i, m := range ev.Matches {
+		if m.Rule.Locked && (strictest < 0 || rank(m.Rule.Action) > rank(ev.Matches[strictest].Rule.Action)) {
+			strictest = i
+		}
+	}
+	if strictest <= 0 || rank(ev.Matches[strictest].Rule.Action) <= rank(ev.Action) {
+		return
+	}
+	locked := ev.Matches[strictest]
+	ev.Matches = append(ev.Matches[:strictest], ev.Matches[strictest+1:]...)
+	ev.Matches = append([]Match{locked}, ev.Matches...)
+	ev.Action = locked.Rule.Action
+}
@@ -0,0 +1,197 @@
+package permission
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyLockedRulesWin(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	c.SetWorkDir(t.TempDir())
+	policy := &Policy{Rules: []string{
+		"Bash(curl:*):deny",
+		"Bash(git push:*):ask",
+		"Read(/secrets/**):deny",
+	}}
+	if err := c.SetPolicy(policy, "/etc/milo/policy.yaml"); err != nil {
+		t.Fatalf("SetPolicy() error = %v", err)
+	}
+
+	// More specific project rules try to loosen the policy.
+	c.customRules["bash:curl https://internal.example.com/*"] = Rule{Tool: "bash", Pattern: "curl https://internal.example.com/*", Action: Allow, Source: "project"}
+	c.customRules["bash:git push origin main"] = Rule{Tool: "bash", Pattern: "git push origin main", Action: Allow, Source: "project"}
+	c.customRules["read:/secrets/public/*"] = Rule{Tool: "read", Pattern: "/secrets/public/*", Action: Allow, Source: "project"}
+	// Making things stricter still works.
+	c.customRules["bash:ls:*"] = Rule{Tool: "bash", Pattern: "ls:*", Action: Deny, Source: "project"}
+
+	tests := []struct {
+		tool  string
+		input string
+		want  Action
+	}{
+		{"bash", "curl https://internal.example.com/api", Deny},
+		{"bash", "echo hi && curl https://evil.example.com", Deny},
+		{"bash", "git push origin main", Ask},
+		{"read", "/secrets/public/key.txt", Deny},
+		{"read", "/tmp/notes.txt", Allow},
+		{"bash", "ls -la", Deny},
+	}
+	for _, tt := range tests {
+		d := c.Decide(tt.tool, ToolInput(tt.tool, tt.input))
+		if d.Action != tt.want {
+			t.Errorf("Decide(%s %q) = %s (%s), want %s", tt.tool, tt.input, d.Action, d.Reason, tt.want)
+		}
+	}
+
+	d := c.Decide("bash", ToolInput("bash", "curl https://internal.example.com/api"))
+	if d.Rule == nil || !d.Rule.Locked || !strings.Contains(d.Reason, "managed policy /etc/milo/policy.yaml") {
+		t.Errorf("decision = rule %v, reason %q; want the locked rule named", d.Rule, d.Reason)
+	}
+
+	// Session grants can't get past a locked rule either.
+	if _, err := c.Grant("bash", ToolInput("bash", "curl https://x.example.com"), nil, ScopeSession); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "curl https://x.example.com")); got != Deny {
+		t.Errorf("granted curl = %s, want deny", got)
+	}
+	if _, err := c.Grant("bash", ToolInput("bash", "git push origin main"), nil, ScopeSession); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "git push origin main")); got != Ask {
+		t.Errorf("granted git push = %s, want ask", got)
+	}
+
+	if got := c.ManagedRules(); len(got) != 3 || !got[0].Locked {
+		t.Errorf("ManagedRules() = %+v, want 3 locked rules", got)
+	}
+}
+
+func TestPolicyDisableBypass(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	c.SetSandboxed(true)
+	if got := c.Check("bash", ToolInput("bash", "make")); got != Allow {
+		t.Fatalf("sandboxed make = %s, want allow before the policy", got)
+	}
+
+	if err := c.SetPolicy(&Policy{DisableBypass: true}, "policy.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make")); got != Ask {
+		t.Errorf("sandboxed make = %s, want ask with disable_bypass", got)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make > out.txt")); got != Ask {
+		t.Errorf("sandboxed redirect = %s, want ask with disable_bypass", got)
+	}
+	if err := c.AllowToolAlways("bash"); !errors.Is(err, ErrManagedPolicy) {
+		t.Errorf("AllowToolAlways() error = %v, want ErrManagedPolicy", err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make")); got != Ask {
+		t.Errorf("make after AllowToolAlways = %s, want ask", got)
+	}
+
+	// Always-allowing a call with nothing to narrow the grant to, or with
+	// a catch-all rule, would allow the whole tool.
+	if _, err := c.Grant("deploy", json.RawMessage(`{}`), nil, ScopeSession); !errors.Is(err, ErrManagedPolicy) {
+		t.Errorf("Grant(whole tool) error = %v, want ErrManagedPolicy", err)
+	}
+	if got := c.Check("deploy", json.RawMessage(`{"env":"prod"}`)); got != Ask {
+		t.Errorf("deploy after a whole-tool grant = %s, want ask", got)
+	}
+	if _, err := c.Grant("bash", ToolInput("bash", "make"), &Rule{Tool: "bash", Pattern: "*"}, ScopeSession); !errors.Is(err, ErrManagedPolicy) {
+		t.Errorf("Grant(Bash(*)) error = %v, want ErrManagedPolicy", err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "rm -rf build")); got != Ask {
+		t.Errorf("bash after a Bash(*) grant = %s, want ask", got)
+	}
+
+	// A grant for the exact call still works.
+	if _, err := c.Grant("bash", ToolInput("bash", "make"), nil, ScopeSession); err != nil {
+		t.Errorf("Grant(exact call) error = %v", err)
+	}
+	if got := c.Check("bash", ToolInput("bash", "make")); got != Allow {
+		t.Errorf("make after an exact grant = %s, want allow", got)
+	}
+}
+
+func TestPolicyDisablePersistentGrants(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+	if err := c.SetPolicy(&Policy{DisablePersistentGrants: true}, "policy.yaml"); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := c.Grant("bash", ToolInput("bash", "go test ./..."), &Rule{Tool: "bash", Pattern: "go test:*"}, ScopeProject)
+	if !errors.Is(err, ErrManagedPolicy) {
+		t.Errorf("Grant(project) error = %v, want ErrManagedPolicy", err)
+	}
+	if rule.Source != SourceSession {
+		t.Errorf("granted rule source = %q, want session", rule.Source)
+	}
+	if got := c.Check("bash", ToolInput("bash", "go test -run X")); got != Allow {
+		t.Errorf("granted for the session = %s, want allow", got)
+	}
+
+	c.AddRule(Rule{Tool: "bash", Pattern: "npm run:*", Action: Allow})
+	c.AddRule(Rule{Tool: "bash", Pattern: "npm publish:*", Action: Deny})
+	if got := c.Check("bash", ToolInput("bash", "npm run build")); got != Allow {
+		t.Errorf("added allow rule = %s, want allow", got)
+	}
+
+	rules, err := ReadRules(ProjectFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rules, ",") != "Bash(npm publish:*):deny" {
+		t.Errorf("project rules = %v, want only the deny rule saved", rules)
+	}
+}
+
+func TestLoadManaged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	t.Setenv(PolicyEnv, path)
+
+	// No policy file: nothing is locked.
+	c, err := NewCheckerWithConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCheckerWithConfig() without a policy error = %v", err)
+	}
+	if len(c.ManagedRules()) != 0 || !c.PersistentGrantsAllowed() {
+		t.Errorf("checker without a policy has managed rules or locked grants")
+	}
+
+	data := "rules:\n  - Bash(curl:*):deny\ndisable_persistent_grants: true\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewCheckerWithConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCheckerWithConfig() error = %v", err)
+	}
+	if rules := c.ManagedRules(); len(rules) != 1 || rules[0].Source != path {
+		t.Errorf("ManagedRules() = %+v, want one rule from %s", rules, path)
+	}
+	if c.PersistentGrantsAllowed() {
+		t.Error("PersistentGrantsAllowed() = true, want false")
+	}
+
+	// A policy with a bad rule is rejected rather than partly enforced.
+	if err := os.WriteFile(path, []byte("rules:\n  - Bash(curl:*):deny\n  - nonsense\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCheckerWithConfig(t.TempDir()); err == nil {
+		t.Error("NewCheckerWithConfig() with a bad policy rule succeeded, want an error")
+	}
+}
@@ -0,0 +1,226 @@
+package permission
+
+import (
+	"path"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// shellAnalysis is what a bash command line does, as far as can be told
+// without running it.
+type shellAnalysis struct {
+	// Commands holds the text of every simple command, including pipeline
+	// stages, command substitutions, subshells and scripts passed to
+	// bash -c or eval.
+	Commands []string
+	// Writes holds the targets of redirections that write files.
+	Writes []string
+	// Opaque is set when part of the command can't be analysed, such as a
+	// parse error, a redirect to a computed path or bash -c "$script".
+	Opaque bool
+	// changesDir is set when the command changes directory, which moves
+	// where relative redirect targets land.
+	changesDir bool
+}
+
+// dirCommands change the directory later commands run in.
+var dirCommands = map[string]bool{"cd": true, "pushd": true, "popd": true}
+
+// shellInterpreters run their -c argument as a script.
+var shellInterpreters = map[string]bool{
+	"bash": true, "sh": true, "zsh": true, "dash": true, "ksh": true,
+}
+
+// commandWrappers run the rest of their arguments as another command.
+var commandWrappers = map[string]bool{
+	"env": true, "sudo": true, "doas": true, "nohup": true, "time": true,
+	"nice": true, "timeout": true, "exec": true, "command": true,
+	"builtin": true, "xargs": true, "stdbuf": true,
+}
+
+// harmlessWriteTargets are redirect targets that don't touch real files.
+var harmlessWriteTargets = map[string]bool{
+	"/dev/null": true, "/dev/stdout": true, "/dev/stderr": true, "/dev/tty": true,
+}
+
+// analyzeCommand parses cmd as bash and collects its simple commands and
+// file writes.
+func analyzeCommand(cmd string) shellAnalysis {
+	var a shellAnalysis
+	a.add(cmd, 0)
+	if a.changesDir {
+		for _, target := range a.Writes {
+			if !path.IsAbs(target) {
+				a.Opaque = true // Where it lands depends on the cd
+			}
+		}
+	}
+	return a
+}
+
+// maxShellDepth bounds recursion into nested bash -c scripts.
+const maxShellDepth = 5
+
+func (a *shellAnalysis) add(src string, depth int) {
+	if depth > maxShellDepth {
+		a.Opaque = true
+		return
+	}
+
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(src), "")
+	if err != nil {
+		a.Opaque = true
+		return
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			a.addCall(src, n.Args, depth)
+		case *syntax.Redirect:
+			a.addRedirect(n)
+		}
+		return true
+	})
+}
+
+// addCall records a simple command and looks inside commands that run
+// other commands.
+func (a *shellAnalysis) addCall(src string, args []*syntax.Word, depth int) {
+	if len(args) == 0 {
+		return // Bare assignment; any substitutions are walked separately
+	}
+	a.Commands = append(a.Commands, src[args[0].Pos().Offset():args[len(args)-1].End().Offset()])
+
+	name, ok := literalWord(args[0])
+	if !ok {
+		// The command name itself is computed, e.g. $CMD or $(which rm).
+		a.Opaque = true
+		return
+	}
+	name = path.Base(name)
+
+	switch {
+	case dirCommands[name]:
+		a.changesDir = true
+	case name == "eval":
+		a.addScript(args[1:], depth)
+	case shellInterpreters[name]:
+		for i := 1; i < len(args)-1; i++ {
+			if flag, _ := literalWord(args[i]); strings.HasPrefix(flag, "-") && !strings.HasPrefix(flag, "--") && strings.Contains(flag, "c") {
+				a.addScript(args[i+1:i+2], depth)
+				return
+			}
+		}
+	case commandWrappers[name]:
+		if inner := wrappedCommand(name, args[1:]); len(inner) > 0 {
+			a.addCall(src, inner, depth)
+		}
+	}
+}
+
+// addScript analyses the words passed to eval or bash -c as a script.
+func (a *shellAnalysis) addScript(words []*syntax.Word, depth int) {
+	if len(words) == 0 {
+		return
+	}
+	parts := make([]string, 0, len(words))
+	for _, w := range words {
+		s, ok := literalWord(w)
+		if !ok {
+			a.Opaque = true
+			return
+		}
+		parts = append(parts, s)
+	}
+	a.add(strings.Join(parts, " "), depth+1)
+}
+
+// wrappedCommand skips a wrapper's options (and env's assignments, and
+// timeout's duration) and returns the command it runs. Options that take
+// a value leave that value as the "command", which only makes the result
+// stricter.
+func wrappedCommand(wrapper string, args []*syntax.Word) []*syntax.Word {
+	positional := 0
+	for i, w := range args {
+		s, ok := literalWord(w)
+		if !ok {
+			return args[i:]
+		}
+		switch {
+		case strings.HasPrefix(s, "-"):
+			continue
+		case wrapper == "env" && strings.Contains(s, "="):
+			continue
+		case wrapper == "timeout" && positional == 0:
+			positional++
+			continue
+		}
+		return args[i:]
+	}
+	return nil
+}
+
+// addRedirect records redirections that write to a file.
+func (a *shellAnalysis) addRedirect(r *syntax.Redirect) {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut, syntax.RdrInOut, syntax.DplOut:
+	default:
+		return
+	}
+	target, ok := literalWord(r.Word)
+	if !ok {
+		a.Opaque = true
+		return
+	}
+	// ">&2" and ">&-" duplicate or close a file descriptor, but ">& file"
+	// writes stdout and stderr to file like "&>".
+	if r.Op == syntax.DplOut && isDescriptor(target) {
+		return
+	}
+	if !harmlessWriteTargets[target] {
+		a.Writes = append(a.Writes, target)
+	}
+}
+
+// isDescriptor reports whether a ">&" target is a file descriptor or "-".
+func isDescriptor(target string) bool {
+	if target == "-" {
+		return true
+	}
+	for _, c := range target {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return target != ""
+}
+
+// literalWord returns the value of a word made only of literal text and
+// quotes, with the quotes removed.
+func literalWord(w *syntax.Word) (string, bool) {
+	if w == nil {
+		return "", false
+	}
+	var b strings.Builder
+	for _, part := range w.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, dp := range p.Parts {
+				lit, ok := dp.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				b.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
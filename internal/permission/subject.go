@@ -0,0 +1,123 @@
+package permission
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SubjectKind says what a Subject's value is, and so how rule patterns
+// match it.
+type SubjectKind int
+
+const (
+	// SubjectText is matched with a plain glob, like git operations.
+	SubjectText SubjectKind = iota
+	// SubjectPath is a file path. It is resolved like read and write paths,
+	// and supports "./", "~/" and "**" patterns and the workspace boundary.
+	SubjectPath
+	// SubjectCommand is a shell command, matched like bash patterns
+	// (including "cmd:*") but without parsing it.
+	SubjectCommand
+	// SubjectURL is matched on its host or the whole URL, like web_fetch.
+	SubjectURL
+)
+
+// Subject is one thing a tool call acts on that permission rules match
+// against, such as each path a move touches.
+type Subject struct {
+	Kind  SubjectKind
+	Value string
+	// Write is set for paths the call changes, which the workspace
+	// boundary treats as writes.
+	Write bool
+}
+
+// SubjectFunc returns the subjects of a tool call, and false when the tool
+// doesn't report any, so the built-in input extraction applies.
+type SubjectFunc func(toolName string, toolInput json.RawMessage) ([]Subject, bool)
+
+// SetSubjects sets where the checker gets the subjects of tool calls from,
+// usually the tool registry. Every subject is checked against the tool's
+// rules and the strictest action wins.
+func (c *Checker) SetSubjects(fn SubjectFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subjects = fn
+}
+
+// SetBashDir sets where the checker learns the directory bash commands
+// run in, such as a persistent shell's, which relative redirect targets
+// are resolved against. Without it they resolve against the working
+// directory.
+func (c *Checker) SetBashDir(fn func() string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bashDir = fn
+}
+
+// kindOf returns how rules for a built-in tool match its input.
+func kindOf(toolName string) SubjectKind {
+	switch {
+	case toolName == "bash":
+		return SubjectCommand
+	case toolName == "web_fetch":
+		return SubjectURL
+	case isFilePathTool(toolName):
+		return SubjectPath
+	default:
+		return SubjectText
+	}
+}
+
+// reportedSubjects returns the subjects the tool reports for a call, with
+// paths resolved, and false if it reports none.
+// Must be called with at least a read lock held.
+func (c *Checker) reportedSubjects(toolName string, toolInput json.RawMessage) ([]Subject, bool) {
+	if c.subjects == nil {
+		return nil, false
+	}
+	subjects, ok := c.subjects(toolName, toolInput)
+	if !ok {
+		return nil, false
+	}
+	result := make([]Subject, 0, len(subjects))
+	for _, s := range subjects {
+		if s.Value == "" {
+			continue
+		}
+		if s.Kind == SubjectPath {
+			s.Value = resolvePath(c.workDir, s.Value)
+		}
+		result = append(result, s)
+	}
+	return result, true
+}
+
+// subjectsInput joins subject values into the single input recorded in a
+// Decision and used to key exact-call grants.
+func subjectsInput(subjects []Subject) string {
+	values := make([]string, len(subjects))
+	for i, s := range subjects {
+		values[i] = s.Value
+	}
+	return strings.Join(values, "\n")
+}
+
+// decideSubjects checks every subject against the tool's rules. The first
+// subject with the strictest action decides.
+// Must be called with at least a read lock held.
+func (c *Checker) decideSubjects(toolName string, subjects []Subject) Decision {
+	if len(subjects) == 0 {
+		return decisionFrom([]Evaluation{c.evaluate(toolName, "")}, 0, false)
+	}
+
+	trace := make([]Evaluation, 0, len(subjects))
+	deciding := 0
+	for i, s := range subjects {
+		trace = append(trace, c.evaluateAs(toolName, s.Value, s.Kind))
+		if rank(trace[i].Action) > rank(trace[deciding].Action) {
+			deciding = i
+		}
+	}
+	return decisionFrom(trace, deciding, len(trace) > 1)
+}
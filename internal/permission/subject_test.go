@@ -0,0 +1,115 @@
+package permission
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeSubjects reports subjects for move, as the move tool does, and for a
+// third-party "deploy" tool that runs a command.
+func fakeSubjects(toolName string, input json.RawMessage) ([]Subject, bool) {
+	var in map[string]string
+	_ = json.Unmarshal(input, &in)
+	switch toolName {
+	case "move":
+		return []Subject{
+			{Kind: SubjectPath, Value: in["source"], Write: true},
+			{Kind: SubjectPath, Value: in["destination"], Write: true},
+		}, true
+	case "deploy":
+		return []Subject{{Kind: SubjectCommand, Value: in["command"]}}, true
+	}
+	return nil, false
+}
+
+func TestDecideSubjects(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+	c.SetSubjects(fakeSubjects)
+	for _, text := range []string{"Move(./src/**)", "Move(*.pem):deny", "Deploy(kubectl apply:*)", "Deploy(kubectl delete:*):deny"} {
+		rule, err := ParseRule(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.customRules[rule.Key()] = rule
+	}
+
+	move := func(src, dst string) json.RawMessage {
+		data, _ := json.Marshal(map[string]string{"source": src, "destination": dst})
+		return data
+	}
+	deploy := func(cmd string) json.RawMessage {
+		data, _ := json.Marshal(map[string]string{"command": cmd})
+		return data
+	}
+
+	tests := []struct {
+		name  string
+		tool  string
+		input json.RawMessage
+		want  Action
+	}{
+		{"both paths allowed", "move", move("src/a.go", "src/pkg/b.go"), Allow},
+		{"destination denied", "move", move("src/a.go", "keys/server.pem"), Deny},
+		{"source not covered", "move", move("docs/a.md", "src/a.md"), Ask},
+		{"destination outside the workspace", "move", move("src/a.go", "/tmp/a.go"), Ask},
+		{"command rule", "deploy", deploy("kubectl apply -f app.yaml"), Allow},
+		{"command deny", "deploy", deploy("kubectl delete ns prod"), Deny},
+		{"command not covered", "deploy", deploy("helm install x"), Ask},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			d := c.Decide(tt.tool, tt.input)
+			if d.Action != tt.want {
+				t.Errorf("Decide() = %s (%s), want %s", d.Action, d.Reason, tt.want)
+			}
+		})
+	}
+
+	// Every path is in the trace, and the reason names the one that decided.
+	d := c.Decide("move", move("src/a.go", "keys/server.pem"))
+	if len(d.Trace) != 2 || !strings.Contains(d.Reason, "server.pem") {
+		t.Errorf("trace has %d steps, reason %q; want both paths and the .pem named", len(d.Trace), d.Reason)
+	}
+}
+
+func TestGrantSubjects(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+	c.SetSubjects(fakeSubjects)
+	input := json.RawMessage(`{"source":"docs/a.md","destination":"notes/a.md"}`)
+
+	if _, err := c.Grant("move", input, nil, ScopeProject); err != nil {
+		t.Fatalf("Grant() error = %v", err)
+	}
+	if got := c.Check("move", input); got != Allow {
+		t.Errorf("granted move = %s, want allow", got)
+	}
+	if got := c.Check("move", json.RawMessage(`{"source":"docs/b.md","destination":"notes/b.md"}`)); got != Ask {
+		t.Errorf("other move = %s, want ask", got)
+	}
+
+	rules, err := ReadRules(ProjectFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := resolvePath("", dir)
+	want := []string{
+		"Move(" + filepath.Join(root, "docs/a.md") + ")",
+		"Move(" + filepath.Join(root, "notes/a.md") + ")",
+	}
+	if !slices.Equal(rules, want) {
+		t.Errorf("project rules = %v, want one per path %v", rules, want)
+	}
+}
@@ -0,0 +1,79 @@
+package permission
+
+import (
+	"slices"
+	"sort"
+)
+
+// MinApprovals is how many times calls covered by a suggested rule must
+// have been approved before Suggestions offers it.
+const MinApprovals = 3
+
+// Answer is a past answer to a permission prompt.
+type Answer struct {
+	Tool     string
+	Input    string // Normalized input, as in Decision.Input
+	Approved bool
+}
+
+// Suggestion is a generalized rule backed by past prompt answers.
+type Suggestion struct {
+	Rule     Rule
+	Approved int
+	Denied   int
+	// Examples are a few distinct inputs the rule would have allowed.
+	Examples []string
+}
+
+// maxExamples caps Suggestion.Examples.
+const maxExamples = 3
+
+// Suggestions groups past prompt answers by the rule SuggestRule offers for
+// each and returns the rules approved at least min times and never denied,
+// most approved first. Rules that are already configured are left out.
+func (c *Checker) Suggestions(history []Answer, min int) []Suggestion {
+	byKey := make(map[string]*Suggestion)
+	var order []string
+	for _, a := range history {
+		rule := c.SuggestRule(a.Tool, ToolInput(a.Tool, a.Input))
+		if rule == nil {
+			continue
+		}
+		s, ok := byKey[rule.Key()]
+		if !ok {
+			s = &Suggestion{Rule: *rule}
+			byKey[rule.Key()] = s
+			order = append(order, rule.Key())
+		}
+		if !a.Approved {
+			s.Denied++
+			continue
+		}
+		s.Approved++
+		if len(s.Examples) < maxExamples && !slices.Contains(s.Examples, a.Input) {
+			s.Examples = append(s.Examples, a.Input)
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var result []Suggestion
+	for _, key := range order {
+		s := byKey[key]
+		if s.Approved < min || s.Denied > 0 {
+			continue
+		}
+		if _, exists := c.customRules[key]; exists {
+			continue
+		}
+		if _, exists := c.sessionRules[key]; exists {
+			continue
+		}
+		result = append(result, *s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Approved > result[j].Approved
+	})
+	return result
+}
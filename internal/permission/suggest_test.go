@@ -0,0 +1,55 @@
+package permission
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSuggestions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := NewChecker()
+	c.SetWorkDir(dir)
+	c.customRules["bash:npm run:*"] = Rule{Tool: "bash", Pattern: "npm run:*", Action: Allow}
+
+	approve := func(tool, input string) Answer { return Answer{Tool: tool, Input: input, Approved: true} }
+	history := []Answer{
+		approve("bash", "go test ./internal/..."),
+		approve("bash", "go test ./cmd/..."),
+		approve("bash", "go test ./internal/..."),
+		approve("bash", "go test -run TestX ./pkg"),
+		// Approved often, but rm:* would also cover the built-in rm -rf / deny.
+		approve("bash", "rm -rf build"), approve("bash", "rm -rf dist"), approve("bash", "rm -rf tmp"),
+		// Approved often, but denied once.
+		approve("bash", "docker build ."), approve("bash", "docker build -t x ."), approve("bash", "docker build ./svc"),
+		{Tool: "bash", Input: "docker build --push .", Approved: false},
+		// Already a rule.
+		approve("bash", "npm run a"), approve("bash", "npm run b"), approve("bash", "npm run c"),
+		// Not enough approvals yet.
+		approve("bash", "cargo check"), approve("bash", "cargo check --all"),
+		// Paths generalize to the directory and extension.
+		approve("edit", filepath.Join(dir, "internal", "a.go")),
+		approve("edit", filepath.Join(dir, "internal", "b.go")),
+		approve("edit", filepath.Join(dir, "internal", "c.go")),
+	}
+
+	got := c.Suggestions(history, MinApprovals)
+	if len(got) != 2 {
+		for _, s := range got {
+			t.Log(s.Rule.String(), s.Approved, s.Denied)
+		}
+		t.Fatalf("got %d suggestions, want 2", len(got))
+	}
+
+	first := got[0]
+	if first.Rule.String() != "Bash(go test:*)" || first.Approved != 4 || first.Denied != 0 {
+		t.Errorf("first suggestion = %s approved %d denied %d", first.Rule.String(), first.Approved, first.Denied)
+	}
+	if len(first.Examples) != 3 || first.Examples[0] != "go test ./internal/..." || first.Examples[1] != "go test ./cmd/..." {
+		t.Errorf("examples = %q, want distinct inputs in order", first.Examples)
+	}
+	if got[1].Rule.String() != "Edit(./internal/*.go)" || got[1].Approved != 3 {
+		t.Errorf("second suggestion = %s approved %d", got[1].Rule.String(), got[1].Approved)
+	}
+}
@@ -0,0 +1,58 @@
+package permission
+
+import (
+	"net/url"
+	"strings"
+)
+
+// matchURL matches a web_fetch rule pattern against a URL. A pattern with
+// a scheme, like "https://go.dev/doc/*", matches the whole URL, with *
+// spanning "/". Any other pattern matches the host: "go.dev" only that
+// host, and "*.golang.org" golang.org itself and any subdomain.
+func matchURL(pattern, rawURL string) bool {
+	if strings.Contains(pattern, "://") {
+		return wildcardMatch(strings.ToLower(pattern), strings.ToLower(rawURL))
+	}
+
+	host := urlHost(rawURL)
+	if host == "" {
+		return false
+	}
+	pattern = strings.ToLower(pattern)
+	if apex, ok := strings.CutPrefix(pattern, "*."); ok && host == apex {
+		return true
+	}
+	return wildcardMatch(pattern, host)
+}
+
+// urlHost returns the lowercased host of rawURL without its port, or ""
+// if it has none.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// wildcardMatch reports whether s matches pattern, where * matches any
+// run of characters, including none.
+func wildcardMatch(pattern, s string) bool {
+	// Match the literal parts in order; the last must end s.
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	if len(parts) == 1 {
+		return s == ""
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,82 @@
+package permission
+
+import "testing"
+
+func TestMatchURL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{"go.dev", "https://go.dev/doc/", true},
+		{"go.dev", "https://pkg.go.dev/fmt", false},
+		{"*.go.dev", "https://pkg.go.dev/fmt", true},
+		{"*.go.dev", "https://go.dev/", true},
+		{"*.go.dev", "https://evilgo.dev/", false},
+		{"*.golang.org", "https://proxy.golang.org:443/x", true},
+		{"*.golang.org", "https://golang.org.evil.com/", false},
+		{"GitHub.com", "https://github.com/zhubert/milo", true},
+		{"https://github.com/zhubert/*", "https://github.com/zhubert/milo/issues", true},
+		{"https://github.com/zhubert/*", "https://github.com/other/milo", false},
+		{"https://github.com/zhubert/*", "http://github.com/zhubert/milo", false},
+		{"localhost", "http://localhost:8080/admin", true},
+		{"go.dev", "not a url", false},
+	}
+	for _, tt := range tests {
+		if got := matchURL(tt.pattern, tt.url); got != tt.want {
+			t.Errorf("matchURL(%q, %q) = %v, want %v", tt.pattern, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestWebRules(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	for _, text := range []string{"WebFetch(*.golang.org)", "Web_fetch(localhost):deny", "WebSearch(*)"} {
+		rule, err := ParseRule(text)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) error = %v", text, err)
+		}
+		c.customRules[rule.Key()] = rule
+	}
+
+	tests := []struct {
+		tool  string
+		input string
+		want  Action
+	}{
+		{"web_fetch", "https://pkg.golang.org/x/tools", Allow},
+		{"web_fetch", "http://localhost:6060/debug/pprof", Deny},
+		{"web_fetch", "https://example.com/", Ask},
+		{"web_search", "golang generics tutorial", Allow},
+	}
+	for _, tt := range tests {
+		if got := c.Check(tt.tool, ToolInput(tt.tool, tt.input)); got != tt.want {
+			t.Errorf("Check(%s %q) = %s, want %s", tt.tool, tt.input, got, tt.want)
+		}
+	}
+
+	if got := c.SuggestRule("web_fetch", ToolInput("web_fetch", "https://docs.python.org/3/library/os.html")); got == nil || got.String() != "Web_fetch(docs.python.org)" {
+		t.Errorf("SuggestRule(web_fetch) = %v, want Web_fetch(docs.python.org)", got)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]string{
+		"Bash":      "bash",
+		"BASH":      "bash",
+		"WebFetch":  "web_fetch",
+		"Web_fetch": "web_fetch",
+		"MultiRead": "multi_read",
+		"list_dir":  "list_dir",
+	} {
+		if got := toolName(in); got != want {
+			t.Errorf("toolName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace configures which directories file tools may touch without
+// extra scrutiny. The working directory is always part of the workspace.
+type Workspace struct {
+	// Dirs are extra directories in the workspace, such as those given
+	// with --add-dir. Relative paths are relative to the working directory
+	// and a leading ~ expands to $HOME.
+	Dirs []string `yaml:"dirs,omitempty"`
+	// OutsideReads is the action for reads outside the workspace: allow
+	// (the default), ask or deny.
+	OutsideReads string `yaml:"outside_reads,omitempty"`
+	// OutsideWrites is the action for writes outside the workspace: ask
+	// (the default) or deny.
+	OutsideWrites string `yaml:"outside_writes,omitempty"`
+}
+
+// SetWorkspace sets the directories and outside-access actions used for
+// the workspace boundary. It must be called after the working directory
+// is set.
+func (c *Checker) SetWorkspace(w Workspace) error {
+	reads, writes := Allow, Ask
+	var err error
+	if w.OutsideReads != "" {
+		if reads, err = parseAction(w.OutsideReads); err != nil {
+			return fmt.Errorf("workspace outside_reads: %w", err)
+		}
+	}
+	if w.OutsideWrites != "" {
+		if writes, err = parseAction(w.OutsideWrites); err != nil {
+			return fmt.Errorf("workspace outside_writes: %w", err)
+		}
+		if writes == Allow {
+			return fmt.Errorf("workspace outside_writes: must be ask or deny")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirs := make([]string, 0, len(w.Dirs))
+	for _, d := range w.Dirs {
+		expanded, err := expandHome(d)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, resolvePath(c.workDir, expanded))
+	}
+	c.extraDirs = dirs
+	c.outsideReads = reads
+	c.outsideWrites = writes
+	return nil
+}
+
+// WorkspaceDirs returns the resolved directories of the workspace, the
+// working directory first.
+func (c *Checker) WorkspaceDirs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.roots()
+}
+
+// roots returns the resolved workspace directories.
+// Must be called with at least a read lock held.
+func (c *Checker) roots() []string {
+	if c.workDir == "" {
+		return nil
+	}
+	return append([]string{resolvePath("", c.workDir)}, c.extraDirs...)
+}
+
+// inWorkspace reports whether the resolved path is inside a workspace
+// directory. Without a working directory everything is inside.
+// Must be called with at least a read lock held.
+func (c *Checker) inWorkspace(path string) bool {
+	roots := c.roots()
+	if len(roots) == 0 {
+		return true
+	}
+	for _, root := range roots {
+		if within(root, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkBoundary applies the workspace boundary to d: touching a path
+// outside the workspace makes the decision at least as strict as the
+// outside action for reads or writes, whatever the rules said.
+// Must be called with at least a read lock held.
+func (c *Checker) checkBoundary(toolName string, subjects []Subject, d Decision) Decision {
+	for _, s := range subjects {
+		if s.Kind != SubjectPath {
+			continue
+		}
+		action, kind := c.outsideReads, "read"
+		if s.Write {
+			action, kind = c.outsideWrites, "write"
+		}
+
+		p := s.Value
+		resolved := resolvePath(c.workDir, p)
+		if c.inWorkspace(resolved) {
+			continue
+		}
+		note := fmt.Sprintf("%s outside the workspace (%s)", kind, strings.Join(c.roots(), ", "))
+		if resolved != filepath.Clean(p) {
+			note = fmt.Sprintf("%s resolves to %s, a %s", p, resolved, note)
+		}
+		ev := Evaluation{Tool: toolName, Input: resolved, Action: action, Note: note}
+		d.Trace = append(d.Trace, ev)
+		// The boundary explains an ask or deny even when a rule agreed.
+		if action != Allow && rank(action) >= rank(d.Action) {
+			d.Action, d.Rule, d.Score = action, nil, 0
+			d.Reason = note
+		}
+	}
+	return d
+}
+
+// accessedPaths returns the file paths a built-in file tool call touches,
+// for tools that don't report their subjects. Tools without file paths
+// return nothing.
+func accessedPaths(toolName string, toolInput json.RawMessage) []Subject {
+	var in struct {
+		FilePath    string `json:"file_path"`
+		Path        string `json:"path"`
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		Files       []struct {
+			FilePath string `json:"file_path"`
+		} `json:"files"`
+	}
+	if len(toolInput) == 0 || json.Unmarshal(toolInput, &in) != nil {
+		return nil
+	}
+
+	var paths []string
+	add := func(p string) {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	write := false
+	switch toolName {
+	case "read":
+		add(in.FilePath)
+	case "write", "edit":
+		add(in.FilePath)
+		write = true
+	case "move":
+		add(in.Source)
+		add(in.Destination)
+		write = true
+	case "multi_read":
+		for _, f := range in.Files {
+			add(f.FilePath)
+		}
+	case "glob", "grep", "list_dir", "tree":
+		add(in.Path)
+	}
+	subjects := make([]Subject, len(paths))
+	for i, p := range paths {
+		subjects[i] = Subject{Kind: SubjectPath, Value: p, Write: write}
+	}
+	return subjects
+}
+
+// resolvePath makes p absolute (relative to base), cleans out "." and ".."
+// and resolves symlinks. A path that doesn't exist yet is resolved through
+// its deepest existing parent, so a new file under a symlinked directory
+// still lands where the link points.
+func resolvePath(base, p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+	p = filepath.Clean(p)
+
+	var rest []string
+	dir := p
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return p
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("expanding %s: %w", p, err)
+	}
+	return filepath.Join(home, p[1:]), nil
+}
+
+// expandPattern turns the project-relative "./" and home-relative "~/"
+// forms of a path pattern into absolute patterns. Other patterns are
+// returned unchanged.
+// Must be called with at least a read lock held.
+func (c *Checker) expandPattern(pattern string) string {
+	switch {
+	case strings.HasPrefix(pattern, "./") && c.workDir != "":
+		return filepath.Join(resolvePath("", c.workDir), pattern[2:])
+	case strings.HasPrefix(pattern, "~/"):
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(resolvePath("", home), pattern[2:])
+		}
+	}
+	return pattern
+}
+
+// matchPath matches a path against a glob pattern in which "**" matches
+// any number of directories, including none.
+func matchPath(pattern, path string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, err := filepath.Match(pattern[0], path[0]); err != nil || !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,187 @@
+package permission
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newWorkspaceChecker returns a checker rooted in a fresh project directory
+// next to an "outside" directory, with a symlink from the project to it.
+func newWorkspaceChecker(t *testing.T, w Workspace) (c *Checker, project, outside string) {
+	t.Helper()
+
+	base := t.TempDir()
+	project = filepath.Join(base, "project")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{project, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(project, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	c = NewChecker()
+	c.SetWorkDir(project)
+	for i, d := range w.Dirs {
+		w.Dirs[i] = strings.ReplaceAll(d, "$BASE", base)
+	}
+	if err := c.SetWorkspace(w); err != nil {
+		t.Fatalf("SetWorkspace() error = %v", err)
+	}
+	return c, project, outside
+}
+
+func TestWorkspaceBoundary(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		workspace Workspace
+		rules     []string
+		tool      string
+		input     string // $P is the project, $O the outside directory
+		want      Action
+	}{
+		{"write inside allowed by rule", Workspace{}, []string{"Write(./**)"}, "write", `{"file_path":"$P/src/main.go"}`, Allow},
+		{"write outside asks despite rule", Workspace{}, []string{"Write(/**)"}, "write", `{"file_path":"$O/x"}`, Ask},
+		{"write through symlink asks", Workspace{}, []string{"Write(./**)"}, "write", `{"file_path":"$P/link/cron"}`, Ask},
+		{"write via .. asks", Workspace{}, []string{"Write(./**)"}, "edit", `{"file_path":"$P/../outside/x"}`, Ask},
+		{"outside writes denied", Workspace{OutsideWrites: "deny"}, nil, "write", `{"file_path":"$O/x"}`, Deny},
+		{"move out of the workspace", Workspace{}, []string{"Move(*)"}, "move", `{"source":"$P/a","destination":"$O/a"}`, Ask},
+		{"added dir is inside", Workspace{Dirs: []string{"$BASE/outside"}}, []string{"Write(/**)"}, "write", `{"file_path":"$O/x"}`, Allow},
+		{"outside reads allowed by default", Workspace{}, nil, "read", `{"file_path":"$O/notes.txt"}`, Allow},
+		{"outside reads denied", Workspace{OutsideReads: "deny"}, nil, "read", `{"file_path":"$P/link/notes.txt"}`, Deny},
+		{"multi_read checks every file", Workspace{OutsideReads: "ask"}, nil, "multi_read", `{"files":[{"file_path":"$P/a"},{"file_path":"$O/b"}]}`, Ask},
+		{"grep outside asks", Workspace{OutsideReads: "ask"}, nil, "grep", `{"pattern":"x","path":"$O"}`, Ask},
+		{"deny rule inside still denies", Workspace{}, []string{"Read(./secrets/*):deny"}, "read", `{"file_path":"$P/secrets/key"}`, Deny},
+		{"redirect inside allowed by rule", Workspace{}, []string{"Write(./**)"}, "bash", `{"command":"echo x > out.txt"}`, Allow},
+		{"redirect via .. asks", Workspace{}, []string{"Write(/**)"}, "bash", `{"command":"echo x > ../outside/x"}`, Ask},
+		{"redirect through symlink denied", Workspace{OutsideWrites: "deny"}, []string{"Write(/**)"}, "bash", `{"command":"echo x >> link/cron"}`, Deny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, project, outside := newWorkspaceChecker(t, tt.workspace)
+			for _, s := range tt.rules {
+				rule, err := ParseRule(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.customRules[rule.Key()] = rule
+			}
+
+			input := strings.NewReplacer("$P", project, "$O", outside).Replace(tt.input)
+			d := c.Decide(tt.tool, []byte(input))
+			if d.Action != tt.want {
+				t.Errorf("Decide(%s, %s) = %s (%s), want %s", tt.tool, input, d.Action, d.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestBashRedirectResolved(t *testing.T) {
+	t.Parallel()
+
+	c, project, outside := newWorkspaceChecker(t, Workspace{Dirs: []string{"$BASE/outside"}})
+	c.AddRule(Rule{Tool: "write", Pattern: outside + "/**", Action: Deny})
+
+	command := func(cmd string) json.RawMessage { return ToolInput("bash", cmd) }
+	if d := c.Decide("bash", command("echo x > ../outside/cron")); d.Action != Deny {
+		t.Errorf("redirect via .. = %s (%s), want the deny rule to apply", d.Action, d.Reason)
+	}
+
+	// Relative targets follow the shell's directory.
+	c.SetBashDir(func() string { return outside })
+	if d := c.Decide("bash", command("echo x > cron")); d.Action != Deny {
+		t.Errorf("redirect from the shell's directory = %s (%s), want deny", d.Action, d.Reason)
+	}
+	c.SetBashDir(func() string { return project })
+	if d := c.Decide("bash", command("echo x > cron")); d.Action == Deny {
+		t.Errorf("redirect in the project = %s (%s)", d.Action, d.Reason)
+	}
+}
+
+func TestWorkspaceBoundaryOverridesSessionGrant(t *testing.T) {
+	t.Parallel()
+
+	c, _, outside := newWorkspaceChecker(t, Workspace{})
+	c.AllowToolAlways("write")
+
+	d := c.Decide("write", ToolInput("write", filepath.Join(outside, "x")))
+	if d.Action != Ask {
+		t.Fatalf("Decide() = %s, want ask", d.Action)
+	}
+	if !strings.Contains(d.Reason, "write outside the workspace") {
+		t.Errorf("Reason = %q", d.Reason)
+	}
+}
+
+func TestWorkspaceSymlinkReason(t *testing.T) {
+	t.Parallel()
+
+	c, project, outside := newWorkspaceChecker(t, Workspace{})
+	d := c.Decide("write", ToolInput("write", filepath.Join(project, "link", "x")))
+
+	want := "resolves to " + filepath.Join(resolvePath("", outside), "x")
+	if !strings.Contains(d.Reason, want) {
+		t.Errorf("Reason = %q, want it to contain %q", d.Reason, want)
+	}
+}
+
+func TestSetWorkspaceRejectsAllowedOutsideWrites(t *testing.T) {
+	t.Parallel()
+
+	c := NewChecker()
+	if err := c.SetWorkspace(Workspace{OutsideWrites: "allow"}); err == nil {
+		t.Error("expected error for outside_writes: allow")
+	}
+	if err := c.SetWorkspace(Workspace{OutsideReads: "sometimes"}); err == nil {
+		t.Error("expected error for an unknown action")
+	}
+}
+
+func TestHomeRelativePattern(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	c := NewChecker()
+	c.SetWorkDir(t.TempDir())
+	rule, _ := ParseRule("Read(~/.ssh/*):deny")
+	c.customRules[rule.Key()] = rule
+
+	if got := c.Check("read", ToolInput("read", filepath.Join(home, ".ssh", "config"))); got != Deny {
+		t.Errorf("Check(~/.ssh/config) = %s, want deny", got)
+	}
+	if got := c.Check("read", ToolInput("read", filepath.Join(home, "notes.txt"))); got != Allow {
+		t.Errorf("Check(~/notes.txt) = %s, want allow", got)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/p/**", "/p/a/b/c.go", true},
+		{"/p/**", "/p", true},
+		{"/p/**/*.go", "/p/main.go", true},
+		{"/p/**/*.go", "/p/a/b/main.go", true},
+		{"/p/**/*.go", "/p/a/b/main.rs", false},
+		{"/p/*/x", "/p/a/b/x", false},
+		{"/p/**", "/q/a", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package redact masks secrets such as API tokens and private keys in text
+// before it is sent to the model, saved in a session or written to a log.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Config controls which detectors run.
+type Config struct {
+	// Disabled turns redaction off entirely.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// DisableEntropy turns off the high-entropy string detector, which
+	// can mask things like hashes that only look random.
+	DisableEntropy bool `yaml:"disable_entropy,omitempty"`
+	// Patterns are additional detectors.
+	Patterns []Pattern `yaml:"patterns,omitempty"`
+}
+
+// Pattern is a named regular expression. If the expression has a capturing
+// group, only the first group is masked; otherwise the whole match is.
+type Pattern struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+}
+
+// detector is a compiled Pattern.
+type detector struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// builtinPatterns detect common credential formats.
+var builtinPatterns = []Pattern{
+	{Name: "private-key", Regex: `-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`},
+	{Name: "aws-access-key", Regex: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret-key", Regex: `(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`},
+	{Name: "github-token", Regex: `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`},
+	{Name: "anthropic-key", Regex: `\bsk-ant-[A-Za-z0-9_-]{20,}`},
+	{Name: "openai-key", Regex: `\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`},
+	{Name: "slack-token", Regex: `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+	{Name: "google-api-key", Regex: `\bAIza[0-9A-Za-z_-]{35}\b`},
+	{Name: "stripe-key", Regex: `\b[rs]k_live_[0-9A-Za-z]{20,}\b`},
+	{Name: "jwt", Regex: `\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`},
+	{Name: "url-password", Regex: `\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:([^@\s/]+)@`},
+}
+
+// Entropy detection looks at long runs of token characters that mix
+// upper case, lower case and digits.
+var (
+	entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_-]{32,}`)
+	// entropyAllowedPrefixes precede checksums that look random but aren't secret.
+	entropyAllowedPrefixes = []string{"h1:", "sha256-", "sha384-", "sha512-"}
+	// entropyAllowedIDs start API identifiers, which must survive intact so
+	// tool results still pair with their tool calls.
+	entropyAllowedIDs = []string{"toolu_", "srvtoolu_", "msg_", "req_"}
+)
+
+// minEntropy is the Shannon entropy in bits per character above which a
+// candidate is treated as a secret. Random base64 scores around 5; prose
+// and identifiers score well under 4.5.
+const minEntropy = 4.5
+
+// Redactor masks secrets in text. A nil Redactor masks nothing.
+type Redactor struct {
+	detectors []detector
+	entropy   bool
+}
+
+// New compiles the built-in detectors and any custom patterns from cfg.
+func New(cfg Config) (*Redactor, error) {
+	if cfg.Disabled {
+		return &Redactor{}, nil
+	}
+
+	r := &Redactor{entropy: !cfg.DisableEntropy}
+	for _, p := range append(builtinPatterns, cfg.Patterns...) {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("compiling redaction pattern %q: %w", p.Name, err)
+		}
+		kind := p.Name
+		if kind == "" {
+			kind = "secret"
+		}
+		r.detectors = append(r.detectors, detector{kind: kind, re: re})
+	}
+	return r, nil
+}
+
+// Redact replaces each secret in s with [REDACTED:<kind>] and returns the
+// masked text along with the kind of each secret found.
+func (r *Redactor) Redact(s string) (string, []string) {
+	if r == nil {
+		return s, nil
+	}
+	return r.redact(s, r.entropy)
+}
+
+// RedactKnown is Redact without the high-entropy detector: it masks only
+// secrets in a recognised format. It suits file contents the model may
+// quote back in an edit, which a masked hash or random-looking fixture
+// would no longer match.
+func (r *Redactor) RedactKnown(s string) (string, []string) {
+	if r == nil {
+		return s, nil
+	}
+	return r.redact(s, false)
+}
+
+// redact runs the detectors, and the high-entropy one if entropy is set.
+func (r *Redactor) redact(s string, entropy bool) (string, []string) {
+
+	var kinds []string
+	for _, d := range r.detectors {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			sub := d.re.FindStringSubmatchIndex(match)
+			start, end := 0, len(match)
+			if len(sub) >= 4 && sub[2] >= 0 {
+				start, end = sub[2], sub[3]
+			}
+			kinds = append(kinds, d.kind)
+			return match[:start] + mask(d.kind) + match[end:]
+		})
+	}
+
+	if entropy {
+		s = redactHighEntropy(s, &kinds)
+	}
+	return s, kinds
+}
+
+// RedactJSON masks secrets in every string value of a JSON document. Only
+// the masked strings change: keys, their order, numbers and spacing stay
+// as they were. The document is returned unchanged when nothing is found.
+func (r *Redactor) RedactJSON(data []byte) ([]byte, []string, error) {
+	if _, kinds := r.Redact(string(data)); len(kinds) == 0 {
+		return data, nil, nil
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("parsing JSON for redaction: %w", err)
+	}
+
+	// Outside string literals a valid document has no quotes, so each
+	// quote starts a key or a string value.
+	var out bytes.Buffer
+	var kinds []string
+	last := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '"' {
+			continue
+		}
+		end := stringEnd(data, i)
+		if !isKey(data[end:]) {
+			var s string
+			if err := json.Unmarshal(data[i:end], &s); err != nil {
+				return nil, nil, fmt.Errorf("parsing JSON for redaction: %w", err)
+			}
+			if masked, found := r.Redact(s); len(found) > 0 {
+				quoted, err := quoteJSON(masked)
+				if err != nil {
+					return nil, nil, fmt.Errorf("marshaling redacted JSON: %w", err)
+				}
+				out.Write(data[last:i])
+				out.Write(quoted)
+				last = end
+				kinds = append(kinds, found...)
+			}
+		}
+		i = end - 1
+	}
+	if last == 0 {
+		return data, nil, nil
+	}
+	out.Write(data[last:])
+	return out.Bytes(), kinds, nil
+}
+
+// stringEnd returns the index just past the string literal starting with
+// the quote at data[start].
+func stringEnd(data []byte, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// isKey reports whether the string literal followed by rest is an object
+// key.
+func isKey(rest []byte) bool {
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	return len(rest) > 0 && rest[0] == ':'
+}
+
+// quoteJSON encodes s as a JSON string literal without escaping HTML.
+func quoteJSON(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Describe summarizes the kinds returned by Redact for the user, for
+// example "2 secrets masked (github-token, private-key)".
+func Describe(kinds []string) string {
+	if len(kinds) == 0 {
+		return ""
+	}
+	seen := make(map[string]bool)
+	var unique []string
+	for _, k := range kinds {
+		if !seen[k] {
+			seen[k] = true
+			unique = append(unique, k)
+		}
+	}
+	sort.Strings(unique)
+
+	noun := "secrets"
+	if len(kinds) == 1 {
+		noun = "secret"
+	}
+	return fmt.Sprintf("%d %s masked (%s)", len(kinds), noun, strings.Join(unique, ", "))
+}
+
+func mask(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// redactHighEntropy masks long random-looking tokens.
+func redactHighEntropy(s string, kinds *[]string) string {
+	locs := entropyCandidate.FindAllStringIndex(s, -1)
+	if len(locs) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		token := s[loc[0]:loc[1]]
+		if !looksRandom(token) || hasAllowedPrefix(s[:loc[0]]) || isAPIIdentifier(token) {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(mask("high-entropy"))
+		*kinds = append(*kinds, "high-entropy")
+		last = loc[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// looksRandom reports whether token mixes character classes and has high
+// Shannon entropy. Pure hex strings such as commit hashes are ignored.
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	return shannonEntropy(token) >= minEntropy
+}
+
+func hasAllowedPrefix(before string) bool {
+	for _, p := range entropyAllowedPrefixes {
+		if strings.HasSuffix(before, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAPIIdentifier(token string) bool {
+	for _, p := range entropyAllowedIDs {
+		if strings.HasPrefix(token, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
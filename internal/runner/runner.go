@@ -10,16 +10,22 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/charmbracelet/glamour"
 	"github.com/chzyer/readline"
 
 	"github.com/zhubert/milo/internal/agent"
+	"github.com/zhubert/milo/internal/checkpoint"
 	"github.com/zhubert/milo/internal/permission"
+	"github.com/zhubert/milo/internal/redact"
 	"github.com/zhubert/milo/internal/session"
+	"github.com/zhubert/milo/internal/textutil"
 	"github.com/zhubert/milo/internal/todo"
+	"github.com/zhubert/milo/internal/tool"
 	"github.com/zhubert/milo/internal/version"
 )
 
@@ -39,21 +45,52 @@ type Runner struct {
 	agent        *agent.Agent
 	session      *session.Session
 	sessionStore *session.Store
+	jobs         *tool.JobManager
+	shell        *tool.Shell
 	workDir      string
 	cancel       context.CancelFunc
 	rl           *readline.Instance
+	// prefill is put in the input line the next time it's read, such as a
+	// rewound message to edit.
+	prefill string
+	// sessionMu guards the session, which the background titler also
+	// updates and saves.
+	sessionMu sync.Mutex
+	// titling is closed when the title request in flight finishes, and nil
+	// when there is none.
+	titling chan struct{}
+	// checkpoints snapshots the working tree before each turn, and is nil
+	// when checkpoints are off.
+	checkpoints *checkpoint.Repo
 }
 
+const (
+	// titleTimeout bounds a background title request.
+	titleTimeout = 30 * time.Second
+	// titleExitWait is how long quitting waits for a title in flight.
+	titleExitWait = 3 * time.Second
+	// checkpointTimeout bounds snapshotting the working tree.
+	checkpointTimeout = 30 * time.Second
+)
+
 // New creates a new Runner.
-func New(ag *agent.Agent, workDir string, store *session.Store, sess *session.Session) *Runner {
+// The shell may be nil when the bash tool runs without a persistent shell.
+func New(ag *agent.Agent, workDir string, store *session.Store, sess *session.Session, jobs *tool.JobManager, shell *tool.Shell) *Runner {
 	return &Runner{
 		agent:        ag,
 		session:      sess,
 		sessionStore: store,
+		jobs:         jobs,
+		shell:        shell,
 		workDir:      workDir,
 	}
 }
 
+// SetCheckpoints turns on snapshotting the working tree before each turn.
+func (r *Runner) SetCheckpoints(repo *checkpoint.Repo) {
+	r.checkpoints = repo
+}
+
 // Run starts the main interaction loop.
 func (r *Runner) Run() error {
 	r.printWelcome()
@@ -64,7 +101,7 @@ func (r *Runner) Run() error {
 
 	// Set up readline with history.
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          colorBold + "> " + colorReset,
+		Prompt:          r.prompt(),
 		HistoryFile:     filepath.Join(os.Getenv("HOME"), ".milo_history"),
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
@@ -73,10 +110,17 @@ func (r *Runner) Run() error {
 		return fmt.Errorf("initializing readline: %w", err)
 	}
 	defer func() { _ = rl.Close() }()
+	defer r.waitForTitle(titleExitWait)
 	r.rl = rl
 
 	for {
-		line, err := rl.Readline()
+		var line string
+		if r.prefill != "" {
+			line, err = rl.ReadlineWithDefault(r.prefill)
+			r.prefill = ""
+		} else {
+			line, err = rl.Readline()
+		}
 		if err != nil {
 			if err == readline.ErrInterrupt {
 				continue // Ctrl+C clears line, continue prompting
@@ -110,9 +154,21 @@ func (r *Runner) Run() error {
 		if err := r.processInput(input, sigCh); err != nil {
 			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colorRed, err, colorReset)
 		}
+		rl.SetPrompt(r.prompt())
 	}
 }
 
+// prompt returns the input prompt, prefixed with the persistent shell's
+// directory when it has moved away from the working directory.
+func (r *Runner) prompt() string {
+	if r.shell != nil {
+		if dir := r.shell.Dir(); dir != r.workDir {
+			return colorDim + shortenPath(dir) + colorReset + " " + colorBold + "> " + colorReset
+		}
+	}
+	return colorBold + "> " + colorReset
+}
+
 func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	r.cancel = cancel
@@ -120,6 +176,14 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 		r.cancel = nil
 	}()
 
+	// Until the turn ends, a saved session shows it never finished.
+	if r.session != nil {
+		r.sessionMu.Lock()
+		r.session.SetStatus(session.StatusInterrupted)
+		r.sessionMu.Unlock()
+	}
+	r.checkpoint(input)
+
 	// Start streaming response.
 	ch := r.agent.SendMessage(ctx, input)
 
@@ -169,6 +233,11 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 			cancel()
 			flushText()
 			fmt.Println(colorYellow + "\n[Cancelled]" + colorReset)
+			// The agent may still be running, so save what the last
+			// snapshot had.
+			if r.session != nil {
+				r.finishTurn(session.StatusCancelled, r.session.Messages)
+			}
 			return nil
 
 		case chunk, ok := <-ch:
@@ -216,6 +285,9 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 					} else {
 						fmt.Printf("%s\n", status)
 					}
+					if len(chunk.Redacted) > 0 {
+						fmt.Printf("  %s⚠ %s in output%s\n", colorYellow, redact.Describe(chunk.Redacted), colorReset)
+					}
 				} else {
 					fmt.Println()
 				}
@@ -229,9 +301,30 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 				}
 				// Show the command/input being requested in function-call style
 				permInfo := formatPermissionInfo(chunk.ToolName, chunk.ToolInput)
-				prompt := fmt.Sprintf("%sAllow %s%s(%s%s%s)%s? [y/n/a]: %s",
-					colorYellow, colorBold, chunk.ToolName, colorDim, permInfo, colorYellow, colorReset, colorReset)
-				resp := r.readPermissionResponseWithPrompt(prompt)
+				var where string
+				if chunk.Dir != "" && chunk.Dir != r.workDir {
+					where = fmt.Sprintf(" in %s", shortenPath(chunk.Dir))
+				}
+				if chunk.Reason != "" {
+					fmt.Printf("%s%s↳ %s%s\n", toolIndent(), colorDim, chunk.Reason, colorReset)
+				}
+				switch {
+				case chunk.Suggestion != nil && chunk.Approvals >= permission.MinApprovals:
+					fmt.Printf("%s%s↳ you've approved %d calls like this; r to always allow %s%s\n",
+						toolIndent(), colorCyan, chunk.Approvals, chunk.Suggestion.String(), colorReset)
+				case chunk.Suggestion != nil:
+					fmt.Printf("%s%s↳ r to always allow %s%s\n", toolIndent(), colorDim, chunk.Suggestion.String(), colorReset)
+				}
+				choices := "y/n/s/p/g"
+				if editableField(chunk.ToolName) != "" {
+					choices = "y/n/e/s/p/g"
+				}
+				if chunk.Suggestion != nil {
+					choices += "/r"
+				}
+				prompt := fmt.Sprintf("%sAllow %s%s(%s%s%s)%s%s? [%s/?]: %s",
+					colorYellow, colorBold, chunk.ToolName, colorDim, permInfo, colorYellow, colorReset, where, choices, colorReset)
+				resp := r.readPermissionResponse(prompt, chunk)
 				r.agent.PermResp <- resp
 
 			case agent.ChunkParallelProgress:
@@ -239,6 +332,11 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 
 			case agent.ChunkContextCompacted:
 				flushText()
+				if r.session != nil && chunk.CompactionInfo != nil {
+					r.sessionMu.Lock()
+					r.session.Compact(chunk.CompactionInfo.Messages)
+					r.sessionMu.Unlock()
+				}
 				fmt.Printf("%s%s→ context compacted%s\n", toolIndent(), colorDim, colorReset)
 
 			case agent.ChunkTodoUpdate:
@@ -279,14 +377,31 @@ func (r *Runner) processInput(input string, sigCh chan os.Signal) error {
 					hasActiveTask = false
 				}
 
+			case agent.ChunkSnapshot:
+				// Save after the user's message and every tool round, so
+				// a crash or Ctrl+C mid-turn keeps what was done.
+				r.saveSession(chunk.Messages)
+
 			case agent.ChunkDone:
 				flushText()
 				fmt.Println()
-				r.saveSession()
+				if r.session != nil && chunk.Usage != nil {
+					r.sessionMu.Lock()
+					r.session.AddUsage(session.Usage{
+						Model:        chunk.Usage.Model,
+						InputTokens:  chunk.Usage.InputTokens,
+						OutputTokens: chunk.Usage.OutputTokens,
+						Cost:         chunk.Usage.Cost(),
+					})
+					r.sessionMu.Unlock()
+				}
+				r.finishTurn(session.StatusCompleted, r.agent.Messages())
+				r.retitle(false)
 				return nil
 
 			case agent.ChunkError:
 				flushText()
+				r.finishTurn(session.StatusError, r.agent.Messages())
 				if chunk.Err != nil {
 					return chunk.Err
 				}
@@ -310,6 +425,16 @@ func (r *Runner) handleSlashCommand(input string) {
 		r.handleModelCommand(args)
 	case "/permissions", "/perms", "/p":
 		r.handlePermissionsCommand(args)
+	case "/jobs", "/j":
+		r.handleJobsCommand(args)
+	case "/shell":
+		r.handleShellCommand(args)
+	case "/rewind":
+		r.handleRewindCommand(args)
+	case "/checkpoints", "/cp":
+		r.handleCheckpointsCommand(args)
+	case "/title":
+		r.handleTitleCommand(strings.TrimSpace(strings.TrimPrefix(input, parts[0])))
 	case "/help", "/h", "/?":
 		r.handleHelpCommand()
 	default:
@@ -329,6 +454,20 @@ Available commands:
     add <rule>             - Add a rule, e.g. Bash(git:*)
     rm <number>            - Remove by number (e.g. /p rm 2)
     rm <rule>              - Remove by rule text
+  /jobs, /j                - List background jobs
+    output <id>            - Show new output from a job
+    kill <id>              - Stop a running job
+  /shell                   - Show the persistent shell's directory
+    reset                  - Restart the shell, clearing env and cd
+  /rewind                  - List your messages in this conversation
+    <number>               - Drop that message and everything after it
+    <number> edit          - Same, then put the message back in the prompt to edit
+  /checkpoints, /cp        - List the snapshots of your files taken before each message
+    restore <number>       - Put your files back as they were at that snapshot
+    restore <number> conv  - Same, and rewind the conversation to that message
+  /title                   - Show the session's title
+    <text>                 - Set the title; it's no longer generated
+    auto                   - Generate the title again, now and as the topic changes
   /help, /h, /?            - Show this help message
 
   exit, quit               - Close the application
@@ -412,6 +551,7 @@ Permission commands:
   /p add <rule>        - Add a rule (default: allow)
   /p rm <number>       - Remove by number (e.g. /p rm 2)
   /p rm <rule>         - Remove by rule text
+  /p suggest           - Rules learned from calls you keep approving
 
 Examples:
   /p add Bash(npm:*)
@@ -433,12 +573,21 @@ Examples:
 		r.addPermission(perms, subargs)
 	case "remove", "rm", "delete", "del":
 		r.removePermission(perms, subargs)
+	case "suggest", "suggestions", "s":
+		r.suggestPermissions()
 	default:
 		fmt.Printf("%sUnknown permissions subcommand: %s%s\n", colorRed, subcmd, colorReset)
 	}
 }
 
 func (r *Runner) listPermissions(perms *permission.Checker) {
+	if managed := perms.ManagedRules(); len(managed) > 0 {
+		fmt.Printf("\nManaged policy rules (locked, from %s):\n", managed[0].Source)
+		for _, rule := range managed {
+			fmt.Printf("  %s🔒%s %s\n", colorYellow, colorReset, rule.String())
+		}
+	}
+
 	rules := perms.CustomRules()
 	if len(rules) == 0 {
 		fmt.Println("No custom permission rules configured.")
@@ -465,9 +614,32 @@ func (r *Runner) addPermission(perms *permission.Checker, args []string) {
 		return
 	}
 	perms.AddRule(rule)
+	if rule.Action == permission.Allow && !perms.PersistentGrantsAllowed() {
+		fmt.Printf("Added rule for this session only (the managed policy doesn't allow saving allow rules): %s%s%s\n",
+			colorGreen, ruleStr, colorReset)
+		return
+	}
 	fmt.Printf("Added rule: %s%s%s\n", colorGreen, ruleStr, colorReset)
 }
 
+func (r *Runner) suggestPermissions() {
+	suggestions := r.agent.RuleSuggestions()
+	if len(suggestions) == 0 {
+		fmt.Printf("No suggestions yet. Rules are suggested once you've approved %d similar calls and denied none.\n",
+			permission.MinApprovals)
+		return
+	}
+
+	fmt.Println("\nSuggested rules, from calls you approved in this project:")
+	for _, s := range suggestions {
+		fmt.Printf("  %s%s%s  approved %d times\n", colorGreen, s.Rule.String(), colorReset, s.Approved)
+		for _, example := range s.Examples {
+			fmt.Printf("    %s%s%s\n", colorDim, formatPermissionInfo(s.Rule.Tool, example), colorReset)
+		}
+	}
+	fmt.Println("\nAdd one with: /p add <rule>")
+}
+
 func (r *Runner) removePermission(perms *permission.Checker, args []string) {
 	if len(args) == 0 {
 		fmt.Printf("%sUsage: /permissions remove <number> or <rule>%s\n", colorRed, colorReset)
@@ -495,54 +667,566 @@ func (r *Runner) removePermission(perms *permission.Checker, args []string) {
 	rule := strings.Join(args, " ")
 	if perms.RemoveRule(rule) {
 		fmt.Printf("Removed rule: %s%s%s\n", colorGreen, rule, colorReset)
+	} else if isManagedRule(perms, rule) {
+		fmt.Printf("%s%s is locked by the managed policy%s\n", colorYellow, rule, colorReset)
 	} else {
 		fmt.Printf("%sRule not found: %s%s\n", colorYellow, rule, colorReset)
 	}
 }
 
-func (r *Runner) readPermissionResponseWithPrompt(prompt string) agent.PermissionResponse {
+func (r *Runner) handleJobsCommand(args []string) {
+	if r.jobs == nil {
+		fmt.Println("Background jobs are not available.")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Println(tool.FormatJobList(r.jobs.List()))
+		return
+	}
+
+	subcmd := strings.ToLower(args[0])
+	if subcmd == "list" || subcmd == "ls" || subcmd == "l" {
+		fmt.Println(tool.FormatJobList(r.jobs.List()))
+		return
+	}
+
+	if len(args) < 2 {
+		fmt.Printf("%sUsage: /jobs output <id> or /jobs kill <id>%s\n", colorRed, colorReset)
+		return
+	}
+	id := args[1]
+
+	switch subcmd {
+	case "output", "out", "o":
+		out, _, err := r.jobs.ReadNew(id)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+			return
+		}
+		if out == "" {
+			out = "(no new output)"
+		}
+		fmt.Println(out)
+	case "kill", "k":
+		if err := r.jobs.Kill(id); err != nil {
+			fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+			return
+		}
+		fmt.Printf("Killed %s%s%s\n", colorGreen, id, colorReset)
+	default:
+		fmt.Printf("%sUnknown jobs subcommand: %s%s\n", colorRed, subcmd, colorReset)
+	}
+}
+
+func (r *Runner) handleShellCommand(args []string) {
+	if r.shell == nil {
+		fmt.Println("Persistent shell is disabled. Start milo with --persistent-shell to enable it.")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Printf("Shell directory: %s\n", shortenPath(r.shell.Dir()))
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "reset":
+		r.shell.Reset()
+		r.rl.SetPrompt(r.prompt())
+		fmt.Printf("Shell reset to %s%s%s\n", colorGreen, shortenPath(r.workDir), colorReset)
+	default:
+		fmt.Printf("%sUnknown shell subcommand: %s%s\n", colorRed, args[0], colorReset)
+	}
+}
+
+// handleRewindCommand lists the user's messages, or truncates the
+// conversation to just before the chosen one.
+func (r *Runner) handleRewindCommand(args []string) {
+	messages := r.agent.Messages()
+	prompts := session.Prompts(messages)
+	if len(prompts) == 0 {
+		fmt.Println("Nothing to rewind.")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Printf("\n%sYour messages:%s\n\n", colorBold, colorReset)
+		for i, p := range prompts {
+			text := textutil.Truncate(strings.Join(strings.Fields(p.Text), " "), 70)
+			fmt.Printf("  %d. %s\n", i+1, text)
+		}
+		fmt.Println("\nUsage: /rewind <number> [edit]")
+		return
+	}
+
+	num, err := strconv.Atoi(args[0])
+	if err != nil || num < 1 || num > len(prompts) {
+		fmt.Printf("%sInvalid message number: %s (choose 1-%d)%s\n", colorRed, args[0], len(prompts), colorReset)
+		return
+	}
+	edit := len(args) > 1 && strings.ToLower(args[1]) == "edit"
+
+	chosen := prompts[num-1]
+	kept := messages[:chosen.Index]
+	r.agent.SetMessages(kept)
+	r.saveSession(kept)
+	fmt.Printf("Rewound to before message %d, dropping %d messages\n", num, len(messages)-len(kept))
+
+	if edit {
+		// The input line holds one line, so newlines become spaces.
+		r.prefill = strings.Join(strings.Fields(chosen.Text), " ")
+	}
+}
+
+// checkpoint snapshots the working tree before the turn for input starts.
+// A failure turns checkpoints off rather than holding up every turn.
+func (r *Runner) checkpoint(input string) {
+	if r.checkpoints == nil || r.session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	if _, err := r.checkpoints.Create(ctx, r.session.ID, input, len(r.agent.Messages())); err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: checkpoints turned off: %v%s\n", colorYellow, err, colorReset)
+		r.checkpoints = nil
+	}
+}
+
+// handleCheckpointsCommand lists the session's checkpoints, or restores
+// the files, and optionally the conversation, to one of them.
+func (r *Runner) handleCheckpointsCommand(args []string) {
+	if r.checkpoints == nil || r.session == nil {
+		fmt.Println("Checkpoints are off.")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	checkpoints, err := r.checkpoints.List(ctx, r.session.ID)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		return
+	}
+	if len(checkpoints) == 0 {
+		fmt.Println("No checkpoints yet.")
+		return
+	}
+
+	if len(args) == 0 {
+		fmt.Printf("\n%sCheckpoints, newest first:%s\n\n", colorBold, colorReset)
+		for i, cp := range checkpoints {
+			fmt.Printf("  %d. %s%s %s%s  %s\n", i+1, colorDim, cp.Time.Format("Jan 2 15:04"), cp.Short(), colorReset, cp.Prompt)
+		}
+		fmt.Println("\nUsage: /checkpoints restore <number> [conv]")
+		return
+	}
+
+	if strings.ToLower(args[0]) != "restore" {
+		fmt.Printf("%sUnknown checkpoints subcommand: %s%s\n", colorRed, args[0], colorReset)
+		return
+	}
+	if len(args) < 2 {
+		fmt.Println("Usage: /checkpoints restore <number> [conv]")
+		return
+	}
+	num, err := strconv.Atoi(args[1])
+	if err != nil || num < 1 || num > len(checkpoints) {
+		fmt.Printf("%sInvalid checkpoint number: %s (choose 1-%d)%s\n", colorRed, args[1], len(checkpoints), colorReset)
+		return
+	}
+	conversation := len(args) > 2 && strings.HasPrefix(strings.ToLower(args[2]), "conv")
+	r.restoreCheckpoint(ctx, checkpoints[num-1], num, conversation)
+}
+
+// restoreCheckpoint puts the working tree back as it was at cp, after
+// taking a checkpoint of it as it is now so the restore can be undone too.
+func (r *Runner) restoreCheckpoint(ctx context.Context, cp checkpoint.Checkpoint, num int, conversation bool) {
+	label := fmt.Sprintf("before restoring checkpoint %d (%s)", num, cp.Short())
+	if _, err := r.checkpoints.Create(ctx, r.session.ID, label, len(r.agent.Messages())); err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		return
+	}
+	changed, err := r.checkpoints.Restore(ctx, cp)
+	if err != nil {
+		fmt.Printf("%sError: %v%s\n", colorRed, err, colorReset)
+		return
+	}
+	fmt.Printf("Restored %d files to checkpoint %d (%s)\n", len(changed), num, cp.Short())
+	for _, path := range changed {
+		fmt.Printf("  %s%s%s\n", colorDim, path, colorReset)
+	}
+	if !conversation {
+		return
+	}
+
+	// Only rewind if the message the checkpoint was taken before is
+	// still where it was; /rewind may have changed the conversation since.
+	messages := r.agent.Messages()
+	for _, p := range session.Prompts(messages) {
+		if p.Index == cp.Messages && checkpoint.Excerpt(p.Text) == cp.Prompt {
+			kept := messages[:p.Index]
+			r.agent.SetMessages(kept)
+			r.saveSession(kept)
+			fmt.Printf("Rewound the conversation to before that message, dropping %d messages\n", len(messages)-len(kept))
+			return
+		}
+	}
+	fmt.Println("The conversation has changed since that checkpoint, so only the files were restored.")
+}
+
+// permissionScopes maps the always-allow answers to where the grant lives.
+var permissionScopes = map[string]permission.Scope{
+	"s": permission.ScopeSession,
+	"p": permission.ScopeProject,
+	"a": permission.ScopeProject, // "always", kept from the old y/n/a prompt
+	"g": permission.ScopeGlobal,
+}
+
+// isManagedRule reports whether rule, given as text or a tool:pattern
+// key, is one of the managed policy's locked rules.
+func isManagedRule(perms *permission.Checker, rule string) bool {
+	key := rule
+	if parsed, err := permission.ParseRule(rule); err == nil {
+		key = parsed.Key()
+	}
+	for _, managed := range perms.ManagedRules() {
+		if managed.Key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) readPermissionResponse(prompt string, chunk agent.StreamChunk) agent.PermissionResponse {
 	// Set the prompt for readline (this ensures proper display)
 	oldPrompt := r.rl.Config.Prompt
+	defer r.rl.SetPrompt(oldPrompt)
 	r.rl.SetPrompt(prompt)
 
-	first := true
+	denied := agent.PermissionResponse{Answer: agent.PermissionDenied}
+	field := editableField(chunk.ToolName)
 	for {
-		if !first {
-			r.rl.SetPrompt("Please enter y, n, or a: ")
-		}
-		first = false
-
 		line, err := r.rl.Readline()
 		if err != nil {
-			r.rl.SetPrompt(oldPrompt)
-			return agent.PermissionDenied
+			return denied
 		}
-		switch strings.ToLower(strings.TrimSpace(line)) {
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		switch answer {
 		case "y", "yes":
-			r.rl.SetPrompt(oldPrompt)
-			return agent.PermissionGranted
+			return agent.PermissionResponse{Answer: agent.PermissionGranted}
+
 		case "n", "no":
-			r.rl.SetPrompt(oldPrompt)
-			return agent.PermissionDenied
-		case "a", "always":
-			r.rl.SetPrompt(oldPrompt)
-			return agent.PermissionGrantedAlways
+			r.rl.SetPrompt("Tell the model why (enter to skip): ")
+			feedback, err := r.rl.Readline()
+			if err != nil {
+				return denied
+			}
+			return agent.PermissionResponse{Answer: agent.PermissionDenied, Feedback: strings.TrimSpace(feedback)}
+
+		case "e", "edit":
+			if field == "" {
+				break
+			}
+			if resp, ok := r.editToolInput(chunk.ToolInput, field); ok {
+				return resp
+			}
+			r.rl.SetPrompt(prompt)
+			continue
+
+		case "s", "p", "a", "g":
+			return r.alwaysAllow(permissionScopes[answer], nil)
+
+		case "r":
+			if chunk.Suggestion == nil {
+				break
+			}
+			r.rl.SetPrompt(fmt.Sprintf("Always allow %s for the [s]ession, [p]roject or [g]lobally? ", chunk.Suggestion.String()))
+			scopeLine, err := r.rl.Readline()
+			if err != nil {
+				return denied
+			}
+			if scope, ok := permissionScopes[strings.ToLower(strings.TrimSpace(scopeLine))]; ok {
+				return r.alwaysAllow(scope, chunk.Suggestion)
+			}
+			r.rl.SetPrompt(prompt)
+			continue
+
+		case "?", "h", "help":
+			printPermissionHelp(chunk, field)
+			r.rl.SetPrompt(prompt)
+			continue
 		}
+
+		r.rl.SetPrompt("Please answer y, n, e, s, p, g, r or ? for help: ")
+	}
+}
+
+// alwaysAllow answers a permission prompt with an always-allow grant,
+// warning when the managed policy keeps it to this session.
+func (r *Runner) alwaysAllow(scope permission.Scope, rule *permission.Rule) agent.PermissionResponse {
+	if scope != permission.ScopeSession && !r.agent.Permissions().PersistentGrantsAllowed() {
+		fmt.Printf("%sThe managed policy doesn't allow saving grants; allowed for this session only.%s\n", colorYellow, colorReset)
+		scope = permission.ScopeSession
+	}
+	return agent.PermissionResponse{Answer: agent.PermissionGrantedAlways, Scope: scope, Rule: rule}
+}
+
+// editToolInput lets the user change field of the tool input, starting
+// from its current value. It returns false if they leave it unchanged.
+func (r *Runner) editToolInput(input, field string) (agent.PermissionResponse, bool) {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(input), &data); err != nil {
+		return agent.PermissionResponse{}, false
+	}
+	current, _ := data[field].(string)
+
+	r.rl.SetPrompt(fmt.Sprintf("Edit %s: ", field))
+	edited, err := r.rl.ReadlineWithDefault(current)
+	edited = strings.TrimSpace(edited)
+	if err != nil || edited == "" || edited == current {
+		fmt.Printf("%sunchanged%s\n", colorDim, colorReset)
+		return agent.PermissionResponse{}, false
+	}
+
+	data[field] = edited
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return agent.PermissionResponse{}, false
+	}
+	return agent.PermissionResponse{Answer: agent.PermissionEdited, Input: raw}, true
+}
+
+// editableField returns the tool input field the user can edit at a
+// permission prompt, or "" if the tool has none.
+func editableField(toolName string) string {
+	switch toolName {
+	case "bash":
+		return "command"
+	case "read", "write", "edit":
+		return "file_path"
+	case "move":
+		return "destination"
+	case "web_fetch":
+		return "url"
+	default:
+		return ""
+	}
+}
+
+func printPermissionHelp(chunk agent.StreamChunk, field string) {
+	fmt.Println("  y  allow once")
+	fmt.Println("  n  deny, optionally telling the model why")
+	if field != "" {
+		fmt.Printf("  e  edit the %s, then run it\n", strings.ReplaceAll(field, "_", " "))
+	}
+	fmt.Println("  s  always allow this exact call for this session")
+	fmt.Println("  p  always allow this exact call in this project (.milo/permissions.yaml)")
+	fmt.Println("  g  always allow this exact call everywhere (~/.milo/permissions.yaml)")
+	if chunk.Suggestion != nil {
+		fmt.Printf("  r  always allow %s instead, then choose s, p or g\n", chunk.Suggestion.String())
+	}
+}
+
+// finishTurn records how a turn ended and the repository's state after it,
+// then saves the session.
+func (r *Runner) finishTurn(status session.TurnStatus, messages []anthropic.MessageParam) {
+	if r.session == nil {
+		return
 	}
+	r.sessionMu.Lock()
+	defer r.sessionMu.Unlock()
+	r.session.SetStatus(status)
+	r.session.SetGit(session.CurrentGit(r.workDir))
+	r.saveSessionLocked(messages)
+}
+
+// saveSession brings the saved session up to date with messages.
+func (r *Runner) saveSession(messages []anthropic.MessageParam) {
+	r.sessionMu.Lock()
+	defer r.sessionMu.Unlock()
+	r.saveSessionLocked(messages)
 }
 
-func (r *Runner) saveSession() {
+// saveSessionLocked is saveSession for a caller holding sessionMu.
+func (r *Runner) saveSessionLocked(messages []anthropic.MessageParam) {
 	if r.sessionStore == nil || r.session == nil {
 		return
 	}
 
-	r.session.SetMessages(r.agent.Messages())
+	r.session.SetMessages(messages)
+	r.session.SetModel(r.agent.Model())
+	changes := tool.DefaultFileHistory.GetAllChanges()
+	for _, change := range changes {
+		r.session.TouchFiles(r.workDir, change.FilePath)
+	}
+	r.session.SetTodos(r.agent.TodoStore().List())
+	r.session.SetFileHistory(sessionChanges(changes))
 
 	if r.session.Title == "" && len(r.session.Messages) > 0 {
 		r.session.Title = extractSessionTitle(r.session.Messages)
 	}
 
-	_ = r.sessionStore.Save(r.session)
+	if err := r.sessionStore.Save(r.session); err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: saving session: %v%s\n", colorYellow, err, colorReset)
+	}
+}
+
+// sessionChanges converts file changes, most recent first, to the
+// session's record of them, oldest first.
+func sessionChanges(changes []tool.FileChange) []session.FileChange {
+	result := make([]session.FileChange, len(changes))
+	for i, c := range changes {
+		result[len(changes)-1-i] = session.FileChange{
+			Path:        c.FilePath,
+			Existed:     c.Existed,
+			Content:     c.OldContent,
+			Time:        c.Timestamp,
+			Tool:        c.ToolName,
+			Description: c.Description,
+		}
+	}
+	return result
+}
+
+// RestoreState puts a resumed session's task list and undo history back
+// into the todo store and file history.
+func RestoreState(sess *session.Session, todos *todo.Store, history *tool.FileHistory) {
+	todos.Set(sess.Todos)
+	changes := make([]tool.FileChange, len(sess.FileHistory))
+	for i, c := range sess.FileHistory {
+		changes[i] = tool.FileChange{
+			FilePath:    c.Path,
+			OldContent:  c.Content,
+			Existed:     c.Existed,
+			Timestamp:   c.Time,
+			ToolName:    c.Tool,
+			Description: c.Description,
+		}
+	}
+	history.SetChanges(changes)
+}
+
+// retitle asks the small model in the background for a title after a
+// completed turn: a first title, or a new one if the topic has clearly
+// changed. With fresh, a new title is written whatever the current one.
+// A title the user set is left alone, and a turn that ends while a request
+// is in flight doesn't start another.
+func (r *Runner) retitle(fresh bool) {
+	if r.sessionStore == nil || r.session == nil || !r.titleDone() {
+		return
+	}
+	r.sessionMu.Lock()
+	sess := r.session
+	current := sess.Title
+	source := sess.TitleSource
+	r.sessionMu.Unlock()
+	if source == session.TitleUser {
+		return
+	}
+	if fresh || source != session.TitleGenerated {
+		// The excerpt is no title to keep.
+		current = ""
+	}
+
+	messages := r.agent.Messages()
+	done := make(chan struct{})
+	r.titling = done
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+
+		title, err := r.agent.Title(ctx, messages, current)
+		if err != nil || title == "" {
+			return
+		}
+		r.sessionMu.Lock()
+		defer r.sessionMu.Unlock()
+		if r.session != sess || sess.TitleSource == session.TitleUser {
+			return
+		}
+		sess.SetGeneratedTitle(title)
+		if err := r.sessionStore.Save(sess); err != nil {
+			fmt.Fprintf(os.Stderr, "%sWarning: saving session: %v%s\n", colorYellow, err, colorReset)
+		}
+	}()
+}
+
+// waitForTitle waits up to timeout for a title request in flight, so a
+// title generated just before quitting is saved.
+func (r *Runner) waitForTitle(timeout time.Duration) {
+	if r.titling == nil {
+		return
+	}
+	select {
+	case <-r.titling:
+	case <-time.After(timeout):
+	}
+	r.titling = nil
+}
+
+// titleDone clears a finished title request so another can start.
+func (r *Runner) titleDone() bool {
+	if r.titling == nil {
+		return true
+	}
+	select {
+	case <-r.titling:
+		r.titling = nil
+		return true
+	default:
+		return false
+	}
+}
+
+// handleTitleCommand shows the session's title, sets it, or with "auto"
+// goes back to generated titles.
+func (r *Runner) handleTitleCommand(arg string) {
+	if r.session == nil {
+		fmt.Println("No session.")
+		return
+	}
+
+	r.sessionMu.Lock()
+	switch {
+	case arg == "":
+		title := r.session.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		note := ""
+		switch r.session.TitleSource {
+		case session.TitleUser:
+			note = " (set with /title)"
+		case session.TitleExcerpt:
+			note = " (from your first message until one is generated)"
+		}
+		r.sessionMu.Unlock()
+		fmt.Printf("%s%s%s\n", title, colorDim+note, colorReset)
+		return
+	case strings.EqualFold(arg, "auto"):
+		r.session.AutoTitle()
+		r.sessionMu.Unlock()
+		if len(r.agent.Messages()) == 0 {
+			fmt.Println("A title will be generated after the first reply.")
+			return
+		}
+		fmt.Println("Generating a title...")
+		r.waitForTitle(titleTimeout)
+		r.retitle(true)
+		r.waitForTitle(titleTimeout)
+		r.sessionMu.Lock()
+		title := r.session.Title
+		r.sessionMu.Unlock()
+		fmt.Printf("Title: %s\n", title)
+		return
+	}
+
+	r.session.SetTitle(arg)
+	r.sessionMu.Unlock()
+	r.saveSession(r.agent.Messages())
+	fmt.Printf("Title set to %q\n", arg)
 }
 
 func extractSessionTitle(messages []anthropic.MessageParam) string {
@@ -550,11 +1234,7 @@ func extractSessionTitle(messages []anthropic.MessageParam) string {
 		if string(msg.Role) == "user" {
 			for _, block := range msg.Content {
 				if block.OfText != nil && block.OfText.Text != "" {
-					text := block.OfText.Text
-					if len(text) > 50 {
-						return text[:47] + "..."
-					}
-					return text
+					return textutil.Truncate(block.OfText.Text, 50)
 				}
 			}
 		}
@@ -582,6 +1262,9 @@ func (r *Runner) printWelcome() {
 		"",
 		"",
 	}
+	if r.agent.Permissions().Sandboxed() {
+		info[4] = "bash sandbox on"
+	}
 
 	for i, line := range logo {
 		fmt.Printf("%s  %s%s%s\n", line, colorDim, info[i], colorReset)
@@ -623,8 +1306,18 @@ func formatToolInfo(name, input string) string {
 			if len(cmd) > 60 {
 				cmd = cmd[:57] + "..."
 			}
+			if bg, _ := data["background"].(bool); bg {
+				cmd += " &"
+			}
 			return fmt.Sprintf("%s %s%s%s", name, colorDim, cmd, colorReset)
 		}
+	case "job":
+		if op, ok := data["operation"].(string); ok {
+			if id, ok := data["id"].(string); ok && id != "" {
+				op += " " + id
+			}
+			return fmt.Sprintf("%s %s%s%s", name, colorDim, op, colorReset)
+		}
 	case "read", "write", "edit", "glob", "grep":
 		if fp, ok := data["file_path"].(string); ok {
 			short := shortenFilePath(fp, 3)
@@ -789,6 +1482,12 @@ func renderMarkdown(content string) string {
 	return strings.TrimSuffix(rendered, "\n")
 }
 
+// RenderMarkdown renders markdown for the terminal the way responses are
+// shown.
+func RenderMarkdown(content string) string {
+	return renderMarkdown(content)
+}
+
 // formatPermissionInfo extracts the key info from tool input for permission display.
 func formatPermissionInfo(toolName, input string) string {
 	var data map[string]any
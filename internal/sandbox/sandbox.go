@@ -0,0 +1,120 @@
+// Package sandbox confines shell commands so they can only write inside the
+// project and, unless allowed, cannot reach the network.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupported is returned when the platform or kernel cannot sandbox commands.
+var ErrUnsupported = errors.New("sandbox not supported")
+
+// Config holds the user-facing sandbox settings.
+type Config struct {
+	// Enabled turns the sandbox on for bash commands.
+	Enabled bool `yaml:"enabled"`
+	// Network allows sandboxed commands to use the network. When false,
+	// TCP connections and listeners are refused, including on localhost.
+	Network bool `yaml:"network"`
+	// Writable lists extra paths commands may write to, in addition to the
+	// working directory and the temp directory. A leading ~ expands to $HOME.
+	Writable []string `yaml:"writable,omitempty"`
+}
+
+// Confined reports whether commands get no network and may write only to
+// the working directory and the temp directory.
+func (c Config) Confined() bool {
+	return !c.Network && len(c.Writable) == 0
+}
+
+// Sandbox describes the restrictions applied to a command.
+type Sandbox struct {
+	writable []string
+	network  bool
+}
+
+// New creates a sandbox rooted at workDir. It returns an error wrapping
+// ErrUnsupported when commands cannot be sandboxed on this system.
+func New(workDir string, cfg Config) (*Sandbox, error) {
+	if err := Supported(); err != nil {
+		return nil, err
+	}
+	if !cfg.Network {
+		if err := supportsNetwork(); err != nil {
+			return nil, err
+		}
+	}
+
+	writable := append([]string{workDir, os.TempDir()}, devWritable...)
+	for _, p := range cfg.Writable {
+		expanded, err := expandHome(p)
+		if err != nil {
+			return nil, err
+		}
+		writable = append(writable, expanded)
+	}
+
+	return &Sandbox{writable: writable, network: cfg.Network}, nil
+}
+
+// devWritable are the device files commands routinely write to. The rest of
+// /dev, such as disks, stays read-only, since a sandboxed command runs
+// without a prompt.
+var devWritable = []string{"/dev/null", "/dev/zero", "/dev/tty", "/dev/ptmx", "/dev/pts", "/dev/shm"}
+
+// WritablePaths returns the paths sandboxed commands may write to.
+func (s *Sandbox) WritablePaths() []string {
+	return append([]string(nil), s.writable...)
+}
+
+// NetworkAllowed reports whether sandboxed commands may use the network.
+func (s *Sandbox) NetworkAllowed() bool {
+	return s.network
+}
+
+// Describe returns a one-line summary of the restrictions.
+func (s *Sandbox) Describe() string {
+	network := "off"
+	if s.network {
+		network = "on"
+	}
+	return fmt.Sprintf("writable: %s; network: %s", strings.Join(s.writable, ", "), network)
+}
+
+// violationMarkers are error messages commonly printed when a command
+// runs into the sandbox's filesystem or network restrictions.
+var violationMarkers = []string{
+	"Permission denied",
+	"Read-only file system",
+	"Operation not permitted",
+	"Network is unreachable",
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"No address associated with hostname",
+}
+
+// LooksLikeViolation reports whether command output suggests the command
+// failed because of the sandbox.
+func LooksLikeViolation(output string) bool {
+	for _, marker := range violationMarkers {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return filepath.Clean(path), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("expanding %s: %w", path, err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,152 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// writeAccess is every Landlock filesystem right that modifies the
+// filesystem in ABI version 1. Reads and execution are left unrestricted.
+const writeAccess = unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+	unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+	unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+	unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+
+// networkABI is the first Landlock ABI version that can restrict TCP.
+const networkABI = 4
+
+// Supported reports whether the kernel provides Landlock.
+func Supported() error {
+	if _, err := landlockABI(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// supportsNetwork reports whether Landlock can restrict network access.
+func supportsNetwork() error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+	if abi < networkABI {
+		return fmt.Errorf("%w: landlock ABI %d cannot restrict the network (needs %d, Linux 6.7+); set sandbox.network: true",
+			ErrUnsupported, abi, networkABI)
+	}
+	return nil
+}
+
+// Start launches cmd inside the sandbox. Filesystem writes outside the
+// writable paths and, when the network is off, all TCP connects and binds
+// are refused with Landlock.
+//
+// Landlock restrictions apply to the calling thread and are inherited by
+// children, so the restriction and the fork happen on a dedicated, locked
+// OS thread that is never returned to the Go scheduler.
+func (s *Sandbox) Start(cmd *exec.Cmd) error {
+	errCh := make(chan error, 1)
+	go func() {
+		// Deliberately never unlocked: the thread exits with this goroutine.
+		runtime.LockOSThread()
+		if err := s.restrictThread(); err != nil {
+			errCh <- err
+			return
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
+
+// restrictThread applies the Landlock ruleset to the current thread.
+func (s *Sandbox) restrictThread() error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+
+	handled := uint64(writeAccess)
+	if abi >= 2 {
+		handled |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	if !s.network {
+		if abi < networkABI {
+			return supportsNetwork()
+		}
+		// Handling TCP without adding any port rules denies it all.
+		attr.Access_net = unix.LANDLOCK_ACCESS_NET_BIND_TCP | unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("creating landlock ruleset: %w", errno)
+	}
+	rulesetFD := int(fd)
+	defer func() { _ = unix.Close(rulesetFD) }()
+
+	for _, path := range s.writable {
+		if err := addPathRule(rulesetFD, path, handled); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(rulesetFD), 0, 0); errno != 0 {
+		return fmt.Errorf("enforcing landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// addPathRule grants access beneath path. Paths that don't exist are skipped.
+func addPathRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("opening %s for sandbox: %w", path, err)
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s for sandbox: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		// Directory-only rights can't be granted on files.
+		access &= unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD),
+		unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("adding sandbox rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// landlockABI returns the kernel's Landlock ABI version.
+func landlockABI() (int, error) {
+	v, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0, fmt.Errorf("%w: landlock unavailable: %v", ErrUnsupported, errno)
+	}
+	return int(v), nil
+}
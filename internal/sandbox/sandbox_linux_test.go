@@ -0,0 +1,118 @@
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runSandboxed(t *testing.T, s *Sandbox, command string) (string, error) {
+	t.Helper()
+	cmd := exec.Command("bash", "-c", command)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := s.Start(cmd); err != nil {
+		return "", err
+	}
+	err := cmd.Wait()
+	return out.String(), err
+}
+
+func TestSandboxFilesystem(t *testing.T) {
+	t.Parallel()
+	if err := Supported(); err != nil {
+		t.Skip(err)
+	}
+
+	work := t.TempDir()
+	outside := t.TempDir()
+	// Network stays on so the test doesn't depend on user namespaces.
+	s := &Sandbox{writable: append([]string{work}, devWritable...), network: true}
+
+	out, err := runSandboxed(t, s, "echo ok > "+filepath.Join(work, "inside.txt"))
+	if err != nil {
+		t.Fatalf("write inside sandbox failed: %v: %s", err, out)
+	}
+
+	out, err = runSandboxed(t, s, "echo no > "+filepath.Join(outside, "outside.txt"))
+	if err == nil {
+		t.Fatal("write outside sandbox should fail")
+	}
+	if !LooksLikeViolation(out) {
+		t.Errorf("expected a recognizable violation, got %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "outside.txt")); !os.IsNotExist(err) {
+		t.Error("file outside the sandbox should not exist")
+	}
+
+	out, err = runSandboxed(t, s, "cat "+filepath.Join(work, "inside.txt")+" > /dev/null; echo err > /dev/stderr")
+	if err != nil {
+		t.Errorf("reads, /dev/null and /dev/stderr should be allowed: %v: %s", err, out)
+	}
+
+	// Other device nodes are off limits.
+	out, err = runSandboxed(t, s, "echo x > /dev/urandom")
+	if err == nil || !LooksLikeViolation(out) {
+		t.Errorf("writing /dev/urandom = %v: %q, want a violation", err, out)
+	}
+}
+
+func TestSandboxNetwork(t *testing.T) {
+	t.Parallel()
+	if err := supportsNetwork(); err != nil {
+		t.Skip(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	port := ln.Addr().(*net.TCPAddr).Port
+	connect := fmt.Sprintf("exec 3<>/dev/tcp/127.0.0.1/%d", port)
+
+	allowed := &Sandbox{writable: devWritable, network: true}
+	if out, err := runSandboxed(t, allowed, connect); err != nil {
+		t.Fatalf("connect with network allowed failed: %v: %s", err, out)
+	}
+
+	blocked := &Sandbox{writable: devWritable, network: false}
+	out, err := runSandboxed(t, blocked, connect)
+	if err == nil {
+		t.Fatal("connect with network off should fail")
+	}
+	if !LooksLikeViolation(out) {
+		t.Errorf("expected a recognizable violation, got %q", out)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if err := Supported(); err != nil {
+		t.Skip(err)
+	}
+	t.Setenv("HOME", "/home/tester")
+
+	s, err := New("/work", Config{Writable: []string{"~/.cache/go-build"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	paths := s.WritablePaths()
+	if paths[0] != "/work" {
+		t.Errorf("first writable path = %q, want /work", paths[0])
+	}
+	if paths[len(paths)-1] != "/home/tester/.cache/go-build" {
+		t.Errorf("expected ~ to expand, got %q", paths[len(paths)-1])
+	}
+	if s.NetworkAllowed() {
+		t.Error("network should be off by default")
+	}
+	if !strings.Contains(s.Describe(), "network: off") {
+		t.Errorf("Describe() = %q", s.Describe())
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Supported reports whether commands can be sandboxed. Only Linux is supported.
+func Supported() error {
+	return fmt.Errorf("%w on %s", ErrUnsupported, runtime.GOOS)
+}
+
+func supportsNetwork() error {
+	return Supported()
+}
+
+// Start is never reached on unsupported platforms since New fails.
+func (s *Sandbox) Start(cmd *exec.Cmd) error {
+	return Supported()
+}
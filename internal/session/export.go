@@ -0,0 +1,382 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	ctxmgr "github.com/zhubert/milo/internal/context"
+	"github.com/zhubert/milo/internal/redact"
+)
+
+// ExportFormat is a format a session can be exported to.
+type ExportFormat string
+
+const (
+	FormatMarkdown ExportFormat = "md"
+	FormatHTML     ExportFormat = "html"
+	FormatJSON     ExportFormat = "json"
+)
+
+// ParseExportFormat returns the export format with the given name.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(name)); f {
+	case FormatMarkdown, FormatHTML, FormatJSON:
+		return f, nil
+	case "markdown":
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want md, html or json)", name)
+}
+
+// ItemKind identifies an entry of an exported transcript.
+type ItemKind string
+
+const (
+	ItemUser       ItemKind = "user"
+	ItemAssistant  ItemKind = "assistant"
+	ItemToolCall   ItemKind = "tool_call"
+	ItemToolResult ItemKind = "tool_result"
+	ItemCompaction ItemKind = "compaction"
+	ItemRewind     ItemKind = "rewind"
+	ItemModel      ItemKind = "model"
+	ItemUsage      ItemKind = "usage"
+)
+
+// Item is one entry of an exported transcript.
+type Item struct {
+	Kind    ItemKind  `json:"kind"`
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text,omitempty"`
+	Tool    string    `json:"tool,omitempty"`
+	Input   string    `json:"input,omitempty"`
+	IsError bool      `json:"is_error,omitempty"`
+	Usage   *Usage    `json:"usage,omitempty"`
+}
+
+// ExportOptions controls what is masked in an export.
+type ExportOptions struct {
+	// Redactor masks secrets, when set.
+	Redactor *redact.Redactor
+	// Paths maps paths to what replaces them, such as the project
+	// directory to "<project>". Longer paths are replaced first.
+	Paths map[string]string
+}
+
+// Export is a session rendered as a list of items, ready to be written in
+// any format.
+type Export struct {
+	Session Summary  `json:"session"`
+	Models  []string `json:"models,omitempty"`
+	Total   Usage    `json:"total"`
+	Items   []Item   `json:"items"`
+}
+
+// NewExport builds the export of a session from its transcript events.
+func NewExport(summary Summary, events []Event, opts ExportOptions) Export {
+	clean := opts.cleaner()
+	summary.Title = clean(summary.Title)
+	exp := Export{Session: summary}
+	toolNames := make(map[string]string)
+
+	addModel := func(model string) {
+		if model != "" && !slices.Contains(exp.Models, model) {
+			exp.Models = append(exp.Models, model)
+		}
+	}
+
+	for _, e := range events {
+		switch e.Type {
+		case EventMessage, EventToolResult:
+			if e.Message != nil {
+				exp.Items = append(exp.Items, messageItems(*e.Message, e.Time, toolNames, clean)...)
+			}
+		case EventCompaction:
+			item := Item{Kind: ItemCompaction, Time: e.Time}
+			for _, msg := range e.Messages {
+				if ctxmgr.IsSummary(msg) {
+					item.Text = clean(messageText(msg))
+					break
+				}
+			}
+			exp.Items = append(exp.Items, item)
+		case EventReplace:
+			exp.Items = append(exp.Items, Item{
+				Kind: ItemRewind,
+				Time: e.Time,
+				Text: fmt.Sprintf("Conversation rewound to %d messages", len(e.Messages)),
+			})
+		case EventModel:
+			addModel(e.Model)
+			exp.Items = append(exp.Items, Item{Kind: ItemModel, Time: e.Time, Text: e.Model})
+		case EventUsage:
+			if e.Usage == nil {
+				continue
+			}
+			addModel(e.Usage.Model)
+			exp.Total.InputTokens += e.Usage.InputTokens
+			exp.Total.OutputTokens += e.Usage.OutputTokens
+			exp.Total.Cost += e.Usage.Cost
+			exp.Items = append(exp.Items, Item{Kind: ItemUsage, Time: e.Time, Usage: e.Usage})
+		}
+	}
+	return exp
+}
+
+// messageItems returns the items for each block of a message.
+func messageItems(msg anthropic.MessageParam, at time.Time, toolNames map[string]string, clean func(string) string) []Item {
+	kind := ItemUser
+	if msg.Role == anthropic.MessageParamRoleAssistant {
+		kind = ItemAssistant
+	}
+
+	var items []Item
+	for _, block := range msg.Content {
+		switch {
+		case block.OfText != nil && block.OfText.Text != "":
+			items = append(items, Item{Kind: kind, Time: at, Text: clean(block.OfText.Text)})
+		case block.OfToolUse != nil:
+			toolNames[block.OfToolUse.ID] = block.OfToolUse.Name
+			input, err := json.MarshalIndent(block.OfToolUse.Input, "", "  ")
+			if err != nil {
+				input = []byte(fmt.Sprint(block.OfToolUse.Input))
+			}
+			items = append(items, Item{
+				Kind:  ItemToolCall,
+				Time:  at,
+				Tool:  block.OfToolUse.Name,
+				Input: clean(string(input)),
+			})
+		case block.OfToolResult != nil:
+			var text []string
+			for _, c := range block.OfToolResult.Content {
+				if c.OfText != nil {
+					text = append(text, c.OfText.Text)
+				}
+			}
+			items = append(items, Item{
+				Kind:    ItemToolResult,
+				Time:    at,
+				Tool:    toolNames[block.OfToolResult.ToolUseID],
+				Text:    clean(strings.Join(text, "\n")),
+				IsError: block.OfToolResult.IsError.Value,
+			})
+		}
+	}
+	return items
+}
+
+// cleaner returns the function that masks secrets and paths in text.
+func (o ExportOptions) cleaner() func(string) string {
+	paths := make([]string, 0, len(o.Paths))
+	for path := range o.Paths {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+
+	return func(s string) string {
+		s, _ = o.Redactor.Redact(s)
+		for _, path := range paths {
+			s = strings.ReplaceAll(s, path, o.Paths[path])
+		}
+		return s
+	}
+}
+
+// Write writes the export in the given format.
+func (e Export) Write(w io.Writer, format ExportFormat) error {
+	switch format {
+	case FormatMarkdown:
+		_, err := io.WriteString(w, e.Markdown(true))
+		return err
+	case FormatHTML:
+		return e.writeHTML(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// Markdown renders the export as Markdown. With collapsible set, tool
+// outputs go in <details> sections; without it, for renderers that don't
+// support HTML, long outputs are cut to their first lines instead.
+func (e Export) Markdown(collapsible bool) string {
+	var sb strings.Builder
+
+	title := e.Session.Title
+	if title == "" {
+		title = "Session " + e.Session.ID
+	}
+	fmt.Fprintf(&sb, "# %s\n\n", title)
+	fmt.Fprintf(&sb, "- **Session:** `%s`", e.Session.ID)
+	if e.Session.ParentID != "" {
+		fmt.Fprintf(&sb, " (forked from `%s` at message %d)", e.Session.ParentID, e.Session.BranchPoint)
+	}
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, "- **Created:** %s\n", e.Session.CreatedAt.Format("2006-01-02 15:04"))
+	if len(e.Models) > 0 {
+		fmt.Fprintf(&sb, "- **Models:** %s\n", strings.Join(e.Models, ", "))
+	}
+	if e.Total.InputTokens > 0 || e.Total.OutputTokens > 0 {
+		fmt.Fprintf(&sb, "- **Usage:** %s\n", formatUsage(e.Total))
+	}
+	sb.WriteString("\n---\n")
+
+	var speaker ItemKind
+	for _, item := range e.Items {
+		switch item.Kind {
+		case ItemUser, ItemAssistant:
+			if item.Kind != speaker {
+				name := "User"
+				if item.Kind == ItemAssistant {
+					name = "Assistant"
+				}
+				fmt.Fprintf(&sb, "\n## %s\n", name)
+				speaker = item.Kind
+			}
+			fmt.Fprintf(&sb, "\n%s\n", item.Text)
+		case ItemToolCall:
+			fmt.Fprintf(&sb, "\n**Tool call:** `%s`\n\n%s", item.Tool, codeBlock(item.Input, "json"))
+		case ItemToolResult:
+			label := "Output"
+			if item.IsError {
+				label = "Error"
+			}
+			if item.Tool != "" {
+				label += " of " + item.Tool
+			}
+			if collapsible {
+				fmt.Fprintf(&sb, "\n<details><summary>%s</summary>\n\n%s\n</details>\n", label, codeBlock(item.Text, ""))
+			} else {
+				fmt.Fprintf(&sb, "\n*%s:*\n\n%s", label, codeBlock(firstLines(item.Text, outputPreviewLines), ""))
+			}
+		case ItemCompaction:
+			sb.WriteString("\n> **Context compacted.** Earlier messages were replaced by a summary.\n")
+			if item.Text != "" {
+				sb.WriteString(">\n")
+				for _, line := range strings.Split(item.Text, "\n") {
+					fmt.Fprintf(&sb, "> %s\n", line)
+				}
+			}
+			speaker = ""
+		case ItemRewind:
+			fmt.Fprintf(&sb, "\n> **%s.**\n", item.Text)
+			speaker = ""
+		case ItemModel:
+			fmt.Fprintf(&sb, "\n*Model: %s*\n", item.Text)
+		case ItemUsage:
+			fmt.Fprintf(&sb, "\n*Turn used %s*\n", formatUsage(*item.Usage))
+			speaker = ""
+		}
+	}
+	return sb.String()
+}
+
+// outputPreviewLines is how much of a tool output non-collapsible Markdown
+// shows.
+const outputPreviewLines = 20
+
+// firstLines returns the first n lines of s, noting how many were left out.
+func firstLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n… %d more lines", len(lines)-n)
+}
+
+// codeBlock fences s, with a fence longer than any backtick run inside it.
+func codeBlock(s, lang string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(s, "\n"), fence)
+}
+
+// formatUsage describes token counts and their cost.
+func formatUsage(u Usage) string {
+	s := fmt.Sprintf("%s input / %s output tokens", formatCount(u.InputTokens), formatCount(u.OutputTokens))
+	if u.Cost > 0 {
+		s += fmt.Sprintf(", $%.4f", u.Cost)
+	}
+	return s
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// exportPage is the HTML page a session is exported as.
+var exportPage = template.Must(template.New("session").Funcs(template.FuncMap{
+	"usage":     formatUsage,
+	"turnUsage": func(u *Usage) string { return formatUsage(*u) },
+	"time":      func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"join":      strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{if .Session.Title}}{{.Session.Title}}{{else}}Session {{.Session.ID}}{{end}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+.meta { color: #555; }
+.msg { border-left: 4px solid #ccc; padding: .25rem 1rem; margin: 1rem 0; white-space: pre-wrap; }
+.user { border-color: #3b82f6; }
+.assistant { border-color: #a855f7; }
+.role { font-weight: bold; display: block; }
+pre { background: #f5f5f5; padding: .75rem; overflow-x: auto; }
+details.error summary { color: #b91c1c; }
+.note { color: #555; font-style: italic; }
+blockquote { border-left: 4px solid #f59e0b; margin: 1rem 0; padding: .25rem 1rem; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{if .Session.Title}}{{.Session.Title}}{{else}}Session {{.Session.ID}}{{end}}</h1>
+<ul class="meta">
+<li>Session <code>{{.Session.ID}}</code>{{if .Session.ParentID}} (forked from <code>{{.Session.ParentID}}</code> at message {{.Session.BranchPoint}}){{end}}</li>
+<li>Created {{time .Session.CreatedAt}}</li>
+{{if .Models}}<li>Models: {{join .Models ", "}}</li>{{end}}
+{{if or .Total.InputTokens .Total.OutputTokens}}<li>Usage: {{usage .Total}}</li>{{end}}
+</ul>
+{{range .Items}}
+{{- if eq .Kind "user"}}<div class="msg user"><span class="role">User</span>{{.Text}}</div>
+{{else if eq .Kind "assistant"}}<div class="msg assistant"><span class="role">Assistant</span>{{.Text}}</div>
+{{else if eq .Kind "tool_call"}}<div class="call">Tool call: <code>{{.Tool}}</code><pre>{{.Input}}</pre></div>
+{{else if eq .Kind "tool_result"}}<details{{if .IsError}} class="error"{{end}}><summary>{{if .IsError}}Error{{else}}Output{{end}}{{if .Tool}} of {{.Tool}}{{end}}</summary><pre>{{.Text}}</pre></details>
+{{else if eq .Kind "compaction"}}<blockquote><strong>Context compacted.</strong> Earlier messages were replaced by a summary.{{if .Text}}
+
+{{.Text}}{{end}}</blockquote>
+{{else if eq .Kind "rewind"}}<blockquote><strong>{{.Text}}.</strong></blockquote>
+{{else if eq .Kind "model"}}<p class="note">Model: {{.Text}}</p>
+{{else if eq .Kind "usage"}}<p class="note">Turn used {{turnUsage .Usage}}</p>
+{{end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// writeHTML writes the export as a standalone HTML page.
+func (e Export) writeHTML(w io.Writer) error {
+	if err := exportPage.Execute(w, e); err != nil {
+		return fmt.Errorf("rendering HTML: %w", err)
+	}
+	return nil
+}
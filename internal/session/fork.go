@@ -0,0 +1,56 @@
+package session
+
+import (
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	ctxmgr "github.com/zhubert/milo/internal/context"
+	"github.com/zhubert/milo/internal/todo"
+)
+
+// Fork returns a new session that starts as a copy of s, recording s as
+// its parent and the number of messages copied as the branch point.
+func (s *Session) Fork() (*Session, error) {
+	fork, err := NewSession()
+	if err != nil {
+		return nil, err
+	}
+	fork.Title = s.Title
+	fork.TitleSource = s.TitleSource
+	fork.SetModel(s.Model)
+	fork.Messages = append([]anthropic.MessageParam(nil), s.Messages...)
+	fork.Todos = append([]todo.Todo(nil), s.Todos...)
+	fork.FileHistory = append([]FileChange(nil), s.FileHistory...)
+	fork.ParentID = s.ID
+	fork.BranchPoint = len(s.Messages)
+	return fork, nil
+}
+
+// Prompt is a message the user typed, as opposed to tool results and
+// compaction summaries, which are also sent as user messages.
+type Prompt struct {
+	// Index is the message's position in the conversation.
+	Index int
+	Text  string
+}
+
+// Prompts returns the messages the user typed, in order.
+func Prompts(messages []anthropic.MessageParam) []Prompt {
+	var prompts []Prompt
+	for i, msg := range messages {
+		if msg.Role != anthropic.MessageParamRoleUser || ctxmgr.IsSummary(msg) {
+			continue
+		}
+		var text []string
+		for _, block := range msg.Content {
+			if block.OfText != nil {
+				text = append(text, block.OfText.Text)
+			}
+		}
+		if len(text) > 0 {
+			prompts = append(prompts, Prompt{Index: i, Text: strings.Join(text, "\n")})
+		}
+	}
+	return prompts
+}
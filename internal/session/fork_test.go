@@ -0,0 +1,81 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestFork(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	parent, _ := NewSession()
+	parent.SetTitle("Fix the LSP deadlock")
+	parent.SetModel("claude-opus-4-5")
+	parent.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("why does gopls hang?")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("Let me look.")),
+	})
+
+	fork, err := parent.Fork()
+	if err != nil {
+		t.Fatalf("Fork() error: %v", err)
+	}
+	if fork.ID == parent.ID || fork.ParentID != parent.ID || fork.BranchPoint != 2 {
+		t.Errorf("fork = id %s, parent %s at %d; want a new id, parent %s at 2", fork.ID, fork.ParentID, fork.BranchPoint, parent.ID)
+	}
+
+	// The fork's conversation is its own.
+	fork.SetMessages(append(fork.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("try another way"))))
+	if parent.MessageCount() != 2 {
+		t.Errorf("parent has %d messages after the fork grew, want 2", parent.MessageCount())
+	}
+
+	if err := store.Save(fork); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	loaded, err := store.Load(fork.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.ParentID != parent.ID || loaded.BranchPoint != 2 || loaded.Model != "claude-opus-4-5" || loaded.MessageCount() != 3 {
+		t.Errorf("loaded fork = parent %q at %d, model %q, %d messages", loaded.ParentID, loaded.BranchPoint, loaded.Model, loaded.MessageCount())
+	}
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].ParentID != parent.ID {
+		t.Errorf("List() = %+v, want the fork's lineage", summaries)
+	}
+}
+
+func TestPrompts(t *testing.T) {
+	t.Parallel()
+
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("[CONVERSATION SUMMARY - Earlier messages have been condensed]\n\nwe fixed x")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("list the files")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t1", json.RawMessage(`{}`), "glob")),
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("t1", "a.go", false)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("There is a.go.")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("now delete it")),
+	}
+
+	got := Prompts(messages)
+	want := []Prompt{{Index: 1, Text: "list the files"}, {Index: 5, Text: "now delete it"}}
+	if len(got) != len(want) {
+		t.Fatalf("Prompts() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Prompts()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// The index lives in a directory of its own inside the store, so its
+// files are never mistaken for sessions: summaries.json holds every
+// session's summary, and <id>.jsonl the text of its messages for search.
+const (
+	indexDir      = "index"
+	summariesFile = "summaries.json"
+)
+
+// snippetWidth is how much text around a match a search snippet shows.
+const snippetWidth = 80
+
+// Match is a session whose title or messages contain a search query.
+type Match struct {
+	Summary
+	// Snippets are excerpts of the messages around each match.
+	Snippets []string
+}
+
+// textEntry is one message's text in a session's search index.
+type textEntry struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// messageText returns the text blocks of a message.
+func messageText(msg anthropic.MessageParam) string {
+	var parts []string
+	for _, block := range msg.Content {
+		if block.OfText != nil && block.OfText.Text != "" {
+			parts = append(parts, block.OfText.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// readSummaries returns the indexed summaries by session ID, or nil if the
+// index hasn't been written yet.
+// Caller must hold at least a read lock.
+func (s *Store) readSummaries() (map[string]Summary, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, indexDir, summariesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session index: %w", err)
+	}
+	var summaries map[string]Summary
+	if err := json.Unmarshal(data, &summaries); err != nil {
+		// A damaged index is rebuilt from the sessions themselves.
+		return nil, nil
+	}
+	return summaries, nil
+}
+
+// writeSummaries replaces the summary index.
+// Caller must hold the write lock.
+func (s *Store) writeSummaries(summaries map[string]Summary) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, indexDir), 0755); err != nil {
+		return fmt.Errorf("creating session index: %w", err)
+	}
+	data, err := json.Marshal(summaries)
+	if err != nil {
+		return fmt.Errorf("marshaling session index: %w", err)
+	}
+	if err := writeAtomic(filepath.Join(s.dir, indexDir, summariesFile), data); err != nil {
+		return fmt.Errorf("writing session index: %w", err)
+	}
+	return nil
+}
+
+// updateIndex records a saved session's summary and appends the text of
+// its new messages to its search index. Text of messages that were later
+// compacted or rewound away stays searchable.
+// Caller must hold the write lock.
+func (s *Store) updateIndex(session *Session, events []Event) error {
+	summaries, err := s.readSummaries()
+	if err != nil {
+		return err
+	}
+	if summaries == nil {
+		summaries = make(map[string]Summary)
+	}
+	summaries[session.ID] = session.Summary()
+	if err := s.writeSummaries(summaries); err != nil {
+		return err
+	}
+
+	var lines [][]byte
+	for _, e := range events {
+		if e.Message == nil {
+			continue
+		}
+		line, err := s.textLine(*e.Message)
+		if err != nil {
+			return err
+		}
+		if line != nil {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return appendTranscript(s.textPath(session.ID), lines)
+}
+
+// textLine returns the search index line for a message, or nil if it has
+// no text.
+func (s *Store) textLine(msg anthropic.MessageParam) ([]byte, error) {
+	text := messageText(msg)
+	if text == "" {
+		return nil, nil
+	}
+	text, _ = s.redactor.Redact(text)
+	line, err := json.Marshal(textEntry{Role: string(msg.Role), Text: text})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling session text: %w", err)
+	}
+	return line, nil
+}
+
+// indexText writes the search index of a session saved before there was
+// one.
+// Caller must hold the write lock.
+func (s *Store) indexText(id string) error {
+	session, err := s.loadUnlocked(id)
+	if err != nil {
+		return err
+	}
+	var lines [][]byte
+	for _, msg := range session.Messages {
+		line, err := s.textLine(msg)
+		if err != nil {
+			return err
+		}
+		if line != nil {
+			lines = append(lines, line)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, indexDir), 0755); err != nil {
+		return fmt.Errorf("creating session index: %w", err)
+	}
+	return appendTranscript(s.textPath(id), lines)
+}
+
+// removeFromIndex drops a deleted session from the index.
+// Caller must hold the write lock.
+func (s *Store) removeFromIndex(id string) error {
+	summaries, err := s.readSummaries()
+	if err != nil {
+		return err
+	}
+	if _, ok := summaries[id]; ok {
+		delete(summaries, id)
+		if err := s.writeSummaries(summaries); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.textPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("deleting session text: %w", err)
+	}
+	return nil
+}
+
+// summaries returns every session's summary from the index, reading only
+// sessions the index doesn't know about yet, and whether the index needs
+// to be written back.
+// Caller must hold at least a read lock.
+func (s *Store) summaries() (map[string]Summary, bool, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("reading session directory: %w", err)
+	}
+	indexed, err := s.readSummaries()
+	if err != nil {
+		return nil, false, err
+	}
+
+	stale := indexed == nil
+	result := make(map[string]Summary)
+	for _, entry := range entries {
+		id, ok := sessionID(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if _, done := result[id]; done {
+			continue
+		}
+		if summary, ok := indexed[id]; ok {
+			result[id] = summary
+			continue
+		}
+		summary, err := s.summaryUnlocked(id)
+		if err != nil {
+			continue // Skip corrupted sessions
+		}
+		result[id] = summary
+		stale = true
+	}
+	if len(result) != len(indexed) {
+		stale = true
+	}
+	return result, stale, nil
+}
+
+// sortedSummaries returns summaries newest first.
+func sortedSummaries(summaries map[string]Summary) []Summary {
+	list := make([]Summary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	return list
+}
+
+// Search returns the sessions whose title or message text contains query,
+// ignoring case, newest first, with up to maxSnippets excerpts each.
+func (s *Store) Search(query string, maxSnippets int) ([]Match, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, errors.New("empty search query")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries, stale, err := s.summaries()
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		if err := s.writeSummaries(summaries); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []Match
+	for _, summary := range sortedSummaries(summaries) {
+		if _, err := os.Stat(s.textPath(summary.ID)); os.IsNotExist(err) {
+			if err := s.indexText(summary.ID); err != nil {
+				continue // Skip corrupted sessions
+			}
+		}
+		snippets, found, err := s.searchText(summary.ID, query, maxSnippets)
+		if err != nil {
+			return nil, err
+		}
+		if found || strings.Contains(strings.ToLower(summary.Title), query) {
+			matches = append(matches, Match{Summary: summary, Snippets: snippets})
+		}
+	}
+	return matches, nil
+}
+
+// searchText scans a session's indexed text for query, which must be
+// lower case.
+func (s *Store) searchText(id, query string, maxSnippets int) ([]string, bool, error) {
+	f, err := os.Open(s.textPath(id))
+	if err != nil {
+		return nil, false, fmt.Errorf("opening session text: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var snippets []string
+	found := false
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("reading session text: %w", err)
+		}
+		var entry textEntry
+		if json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		i := strings.Index(strings.ToLower(entry.Text), query)
+		if i < 0 {
+			continue
+		}
+		found = true
+		if len(snippets) < maxSnippets {
+			snippets = append(snippets, entry.Role+": "+snippet(entry.Text, i, len(query)))
+		}
+	}
+	return snippets, found, nil
+}
+
+// snippet returns the text around a match at [start, start+n), on one line.
+func snippet(text string, start, n int) string {
+	// Lower-casing can change byte lengths, so the match may be a little off.
+	start = min(start, len(text))
+	from := max(start-(snippetWidth-n)/2, 0)
+	to := min(from+snippetWidth, len(text))
+	// Keep to whole UTF-8 characters.
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	out := strings.Join(strings.Fields(text[from:to]), " ")
+	if from > 0 {
+		out = "…" + out
+	}
+	if to < len(text) {
+		out += "…"
+	}
+	return out
+}
+
+// textPath returns the path of a session's search index.
+func (s *Store) textPath(id string) string {
+	return filepath.Join(s.dir, indexDir, id+".jsonl")
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestStore_Search(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+
+	lsp, _ := NewSession()
+	lsp.SetTitle("gopls hangs")
+	lsp.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("the language server hangs after a rename")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("This is a deadlock in the LSP client: the reader waits on a lock held by the writer.")),
+	})
+	other, _ := NewSession()
+	other.SetTitle("Add a deadlock detector")
+	other.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("write the README")),
+	})
+	for _, sess := range []*Session{lsp, other} {
+		if err := store.Save(sess); err != nil {
+			t.Fatalf("Save() error: %v", err)
+		}
+	}
+
+	matches, err := store.Search("Deadlock", 3)
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Search() found %d sessions, want 2", len(matches))
+	}
+	for _, m := range matches {
+		switch m.ID {
+		case lsp.ID:
+			if len(m.Snippets) != 1 || !strings.Contains(m.Snippets[0], "deadlock in the LSP client") || !strings.HasPrefix(m.Snippets[0], "assistant: ") {
+				t.Errorf("snippets = %q, want the assistant's explanation", m.Snippets)
+			}
+		case other.ID:
+			if len(m.Snippets) != 0 {
+				t.Errorf("title match has snippets %q, want none", m.Snippets)
+			}
+		}
+	}
+
+	// Text from messages rewound away is still found.
+	lsp.SetMessages(lsp.Messages[:1])
+	if err := store.Save(lsp); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if matches, _ := store.Search("reader waits", 3); len(matches) != 1 {
+		t.Errorf("Search() after rewind found %d sessions, want 1", len(matches))
+	}
+
+	if err := store.Delete(lsp.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if matches, _ := store.Search("rename", 3); len(matches) != 0 {
+		t.Errorf("Search() found %d sessions after delete, want 0", len(matches))
+	}
+	if _, err := store.Search("  ", 3); err == nil {
+		t.Error("Search() of an empty query should fail")
+	}
+}
+
+func TestStore_SearchUnindexed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	legacy := `{"id": "0badc0de", "title": "Old", "messages": [{"role": "user", "content": [{"type": "text", "text": "fix the flaky test"}]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "0badc0de.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := store.Search("flaky", 1)
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "0badc0de" || matches[0].Snippets[0] != "user: fix the flaky test" {
+		t.Errorf("Search() = %+v, want the legacy session", matches)
+	}
+}
+
+func TestStore_ListUsesIndex(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	sess, _ := NewSession()
+	sess.SetTitle("Indexed")
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// Listing doesn't open sessions the index knows about.
+	if err := os.WriteFile(filepath.Join(dir, sess.ID+".meta.json"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, sess.ID+".jsonl"), []byte("garbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Title != "Indexed" {
+		t.Errorf("List() = %+v, want the indexed summary", summaries)
+	}
+
+	// A session written without the index is picked up, and a removed one dropped.
+	if err := os.Remove(filepath.Join(dir, sess.ID+".meta.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, sess.ID+".jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"id": "0badc0de", "title": "Old", "messages": []}`
+	if err := os.WriteFile(filepath.Join(dir, "0badc0de.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summaries, err = store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].ID != "0badc0de" {
+		t.Errorf("List() = %+v, want only the new session", summaries)
+	}
+}
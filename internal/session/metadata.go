@@ -0,0 +1,175 @@
+package session
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TurnStatus is how the last turn of a session ended.
+type TurnStatus string
+
+const (
+	// StatusInterrupted is recorded when a turn starts, so a turn that
+	// never finished, because milo crashed or was killed, keeps it.
+	StatusInterrupted TurnStatus = "interrupted"
+	StatusCompleted   TurnStatus = "completed"
+	StatusError       TurnStatus = "error"
+	StatusCancelled   TurnStatus = "cancelled"
+)
+
+// GitState is the branch and commit a repository was on.
+type GitState struct {
+	Branch string `json:"branch,omitempty"`
+	Head   string `json:"head"`
+}
+
+// String returns the state as branch@short-commit.
+func (g *GitState) String() string {
+	if g == nil {
+		return ""
+	}
+	head := g.Head
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	if g.Branch == "" {
+		return head
+	}
+	return g.Branch + "@" + head
+}
+
+// gitTimeout bounds how long reading the git state may take.
+const gitTimeout = 2 * time.Second
+
+// CurrentGit returns the git state of the repository dir is in, or nil if
+// it isn't in one. The branch is empty on a detached HEAD.
+func CurrentGit(dir string) *GitState {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	git := func(args ...string) string {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	head := git("rev-parse", "HEAD")
+	if head == "" {
+		return nil
+	}
+	branch := git("rev-parse", "--abbrev-ref", "HEAD")
+	if branch == "HEAD" {
+		branch = ""
+	}
+	return &GitState{Branch: branch, Head: head}
+}
+
+// Metadata describes the work a session did, for listing and filtering
+// sessions without reading their transcripts.
+type Metadata struct {
+	Models       []string   `json:"models,omitempty"`
+	GitStart     *GitState  `json:"git_start,omitempty"`
+	GitEnd       *GitState  `json:"git_end,omitempty"`
+	FilesTouched []string   `json:"files_touched,omitempty"`
+	InputTokens  int64      `json:"input_tokens,omitempty"`
+	OutputTokens int64      `json:"output_tokens,omitempty"`
+	Cost         float64    `json:"cost_usd,omitempty"`
+	LastStatus   TurnStatus `json:"last_status,omitempty"`
+}
+
+// clone returns a copy of m that shares no slices with it.
+func (m Metadata) clone() Metadata {
+	m.Models = slices.Clone(m.Models)
+	m.FilesTouched = slices.Clone(m.FilesTouched)
+	return m
+}
+
+// addModel records that a model was used.
+func (m *Metadata) addModel(model string) {
+	if model != "" && !slices.Contains(m.Models, model) {
+		m.Models = append(m.Models, model)
+	}
+}
+
+// addUsage adds a turn's usage to the totals.
+func (m *Metadata) addUsage(u Usage) {
+	m.addModel(u.Model)
+	m.InputTokens += u.InputTokens
+	m.OutputTokens += u.OutputTokens
+	m.Cost += u.Cost
+}
+
+// SetStatus records how the last turn ended.
+func (s *Session) SetStatus(status TurnStatus) {
+	s.LastStatus = status
+	s.UpdatedAt = time.Now()
+}
+
+// SetGit records the repository's state now as the session's end state,
+// and as its start state if it has none.
+func (s *Session) SetGit(state *GitState) {
+	if state == nil {
+		return
+	}
+	if s.GitStart == nil {
+		s.GitStart = state
+	}
+	s.GitEnd = state
+}
+
+// TouchFiles records files the session wrote or edited. Paths inside
+// workDir are kept relative to it.
+func (s *Session) TouchFiles(workDir string, paths ...string) {
+	for _, path := range paths {
+		if rel, err := filepath.Rel(workDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		if !slices.Contains(s.FilesTouched, path) {
+			s.FilesTouched = append(s.FilesTouched, path)
+		}
+	}
+	slices.Sort(s.FilesTouched)
+}
+
+// Filter selects sessions by their metadata. Empty fields match anything.
+type Filter struct {
+	// Branch matches sessions that started or ended on the branch.
+	Branch string
+	// Touched matches sessions that wrote or edited the file, or a file
+	// under the directory, given relative to the project.
+	Touched string
+}
+
+// Matches reports whether the session summarized passes the filter.
+func (f Filter) Matches(s Summary) bool {
+	if f.Branch != "" && !onBranch(s.GitStart, f.Branch) && !onBranch(s.GitEnd, f.Branch) {
+		return false
+	}
+	if f.Touched != "" {
+		want := filepath.Clean(f.Touched)
+		found := false
+		for _, path := range s.FilesTouched {
+			if path == want || want == "." || strings.HasPrefix(path, want+string(filepath.Separator)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// onBranch reports whether g is on branch.
+func onBranch(g *GitState, branch string) bool {
+	return g != nil && g.Branch == branch
+}
@@ -0,0 +1,127 @@
+package session
+
+import (
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFilterMatches(t *testing.T) {
+	t.Parallel()
+
+	s := Summary{Metadata: Metadata{
+		GitStart:     &GitState{Branch: "main", Head: "aaa"},
+		GitEnd:       &GitState{Branch: "fix-lsp", Head: "bbb"},
+		FilesTouched: []string{"README.md", filepath.Join("internal", "lsp", "client.go")},
+	}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"no filter", Filter{}, true},
+		{"start branch", Filter{Branch: "main"}, true},
+		{"end branch", Filter{Branch: "fix-lsp"}, true},
+		{"other branch", Filter{Branch: "release"}, false},
+		{"touched file", Filter{Touched: "README.md"}, true},
+		{"touched directory", Filter{Touched: "internal/lsp"}, true},
+		{"directory with trailing slash", Filter{Touched: "internal/lsp/"}, true},
+		{"name prefix is not a directory", Filter{Touched: "internal/ls"}, false},
+		{"untouched file", Filter{Touched: "go.mod"}, false},
+		{"both must match", Filter{Branch: "main", Touched: "go.mod"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.filter.Matches(s); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionMetadata(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	sess, _ := NewSession()
+	sess.SetModel("claude-sonnet-4-5")
+	sess.SetGit(&GitState{Branch: "main", Head: "aaa"})
+	sess.TouchFiles("/work", "/work/b.go", "/work/a.go", "/elsewhere/c.go", "/work/a.go")
+	sess.AddUsage(Usage{Model: "claude-sonnet-4-5", InputTokens: 100, OutputTokens: 10, Cost: 0.5})
+	sess.SetModel("claude-opus-4-5")
+	sess.AddUsage(Usage{Model: "claude-opus-4-5", InputTokens: 50, OutputTokens: 5, Cost: 0.25})
+	sess.SetGit(&GitState{Branch: "fix", Head: "bbb"})
+	sess.SetStatus(StatusError)
+
+	if want := []string{"/elsewhere/c.go", "a.go", "b.go"}; !slices.Equal(sess.FilesTouched, want) {
+		t.Errorf("FilesTouched = %v, want %v", sess.FilesTouched, want)
+	}
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	check := func(name string, m Metadata) {
+		t.Helper()
+		if !slices.Equal(m.Models, []string{"claude-sonnet-4-5", "claude-opus-4-5"}) {
+			t.Errorf("%s models = %v", name, m.Models)
+		}
+		if m.GitStart.String() != "main@aaa" || m.GitEnd.String() != "fix@bbb" {
+			t.Errorf("%s git = %s → %s, want main@aaa → fix@bbb", name, m.GitStart, m.GitEnd)
+		}
+		if m.InputTokens != 150 || m.OutputTokens != 15 || m.Cost != 0.75 {
+			t.Errorf("%s usage = %d/%d $%v, want 150/15 $0.75", name, m.InputTokens, m.OutputTokens, m.Cost)
+		}
+		if m.LastStatus != StatusError || len(m.FilesTouched) != 3 {
+			t.Errorf("%s status %q, %d files", name, m.LastStatus, len(m.FilesTouched))
+		}
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	check("listed", summaries[0].Metadata)
+
+	// Usage is counted once even though it is both in the metadata file
+	// and replayed from the transcript.
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	check("loaded", loaded.Metadata)
+}
+
+func TestCurrentGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if got := CurrentGit(dir); got != nil {
+		t.Errorf("CurrentGit() outside a repository = %v, want nil", got)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-b", "trunk"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "first"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	got := CurrentGit(dir)
+	if got == nil || got.Branch != "trunk" || len(got.Head) != 40 {
+		t.Errorf("CurrentGit() = %+v, want trunk at a full commit hash", got)
+	}
+}
@@ -0,0 +1,257 @@
+package session
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveDir is where pruned sessions are bundled when archiving. Like the
+// index, it is a directory, so its files are never mistaken for sessions.
+const archiveDir = "archive"
+
+// Retention is the session retention policy from the config file.
+type Retention struct {
+	// MaxAge prunes sessions not updated for this long, such as "30d",
+	// "2w" or "36h".
+	MaxAge string `yaml:"max_age,omitempty"`
+	// Keep is how many of the most recently updated sessions are never
+	// pruned, or, without MaxAge, how many are kept at all.
+	Keep int `yaml:"keep,omitempty"`
+	// Archive bundles pruned sessions into a compressed archive instead
+	// of deleting them.
+	Archive bool `yaml:"archive,omitempty"`
+}
+
+// Enabled reports whether the policy prunes anything.
+func (r Retention) Enabled() bool {
+	return r.MaxAge != "" || r.Keep > 0
+}
+
+// Policy parses the retention policy.
+func (r Retention) Policy() (Policy, error) {
+	p := Policy{Keep: r.Keep, Archive: r.Archive}
+	if r.Keep < 0 {
+		return Policy{}, fmt.Errorf("session retention keep must not be negative, got %d", r.Keep)
+	}
+	if r.MaxAge != "" {
+		age, err := ParseAge(r.MaxAge)
+		if err != nil {
+			return Policy{}, fmt.Errorf("session retention max_age: %w", err)
+		}
+		p.OlderThan = age
+	}
+	return p, nil
+}
+
+// Policy selects sessions to prune. A session is pruned when it is older
+// than OlderThan, if set, and not among the Keep most recently updated, if
+// set. A policy with neither prunes nothing.
+type Policy struct {
+	OlderThan time.Duration
+	Keep      int
+	// Archive bundles pruned sessions instead of deleting them.
+	Archive bool
+	// Exclude lists sessions never pruned, such as the one in use.
+	Exclude []string
+}
+
+// Select returns the sessions the policy prunes from summaries, which must
+// be sorted newest first.
+func (p Policy) Select(summaries []Summary, now time.Time) []Summary {
+	if p.OlderThan <= 0 && p.Keep <= 0 {
+		return nil
+	}
+	var pruned []Summary
+	for i, s := range summaries {
+		if p.Keep > 0 && i < p.Keep {
+			continue
+		}
+		if p.OlderThan > 0 && now.Sub(s.UpdatedAt) < p.OlderThan {
+			continue
+		}
+		if slices.Contains(p.Exclude, s.ID) {
+			continue
+		}
+		pruned = append(pruned, s)
+	}
+	return pruned
+}
+
+// ParseAge parses an age such as "30d" or "2w", or any duration
+// time.ParseDuration accepts, such as "36h".
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q: use a number of days (30d), weeks (2w) or hours (36h)", s)
+	}
+	return d, nil
+}
+
+// Prune removes the sessions the policy selects and returns them, with the
+// path of the archive they were bundled into if the policy archives.
+func (s *Store) Prune(p Policy, now time.Time) ([]Summary, string, error) {
+	summaries, err := s.List()
+	if err != nil {
+		return nil, "", err
+	}
+	pruned := p.Select(summaries, now)
+	if len(pruned) == 0 {
+		return nil, "", nil
+	}
+
+	var archive string
+	if p.Archive {
+		ids := make([]string, len(pruned))
+		for i, summary := range pruned {
+			ids[i] = summary.ID
+		}
+		if archive, err = s.Archive(ids, now); err != nil {
+			return nil, "", err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, summary := range pruned {
+		if err := s.deleteUnlocked(summary.ID); err != nil {
+			return nil, archive, fmt.Errorf("deleting session %q: %w", summary.ID, err)
+		}
+	}
+	if err := s.removeUnusedBlobs(); err != nil {
+		return nil, archive, err
+	}
+	return pruned, archive, nil
+}
+
+// Archive bundles the files of the given sessions, with the file snapshots
+// their undo history refers to, into a gzipped tarball in the store's
+// archive directory and returns its path. The sessions themselves are left
+// in place. Extracting the archive into the store brings them back.
+func (s *Store) Archive(ids []string, now time.Time) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dir := filepath.Join(s.dir, archiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating session archive directory: %w", err)
+	}
+	f, path, err := createArchive(dir, now)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.writeArchive(f, ids); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("writing session archive: %w", err)
+	}
+	return path, nil
+}
+
+// createArchive creates a new archive file named for the time, adding a
+// counter if an archive of that name already exists.
+func createArchive(dir string, now time.Time) (*os.File, string, error) {
+	base := "sessions-" + now.Format("20060102-150405")
+	for n := 0; ; n++ {
+		name := base
+		if n > 0 {
+			name += "-" + strconv.Itoa(n)
+		}
+		path := filepath.Join(dir, name+".tar.gz")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("creating session archive: %w", err)
+		}
+		return f, path, nil
+	}
+}
+
+// writeArchive writes a gzipped tarball of the sessions' files to w.
+// Caller must hold at least a read lock.
+func (s *Store) writeArchive(w io.Writer, ids []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	blobs := make(map[string]bool)
+	for _, id := range ids {
+		paths := []string{s.transcriptPath(id), s.metaPath(id), s.legacyPath(id), s.statePath(id)}
+		st, err := s.readState(id)
+		if err != nil {
+			return err
+		}
+		for _, change := range st.FileHistory {
+			if validBlob(change.Blob) && !blobs[change.Blob] {
+				blobs[change.Blob] = true
+				paths = append(paths, s.blobPath(change.Blob))
+			}
+		}
+		for _, path := range paths {
+			if err := s.addToArchive(tw, path); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing session archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("writing session archive: %w", err)
+	}
+	return nil
+}
+
+// addToArchive adds the file at path to the archive under its path in the
+// store. A missing file is skipped.
+func (s *Store) addToArchive(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading session file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("reading session file: %w", err)
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("archiving session file: %w", err)
+	}
+	if rel, err := filepath.Rel(s.dir, path); err == nil {
+		hdr.Name = filepath.ToSlash(rel)
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("archiving session file: %w", err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("archiving session file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package session
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestParseAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{" 1d ", 24 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"-3d", 0, true},
+		{"soon", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseAge(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAge(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAge(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicySelect(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// Newest first, updated 1, 10, 40 and 90 days ago.
+	summaries := []Summary{
+		{ID: "a", UpdatedAt: now.Add(-1 * day)},
+		{ID: "b", UpdatedAt: now.Add(-10 * day)},
+		{ID: "c", UpdatedAt: now.Add(-40 * day)},
+		{ID: "d", UpdatedAt: now.Add(-90 * day)},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{"empty policy", Policy{}, nil},
+		{"older than", Policy{OlderThan: 30 * day}, []string{"c", "d"}},
+		{"keep", Policy{Keep: 1}, []string{"b", "c", "d"}},
+		{"keep protects old sessions", Policy{OlderThan: 5 * day, Keep: 3}, []string{"d"}},
+		{"exclude", Policy{OlderThan: 30 * day, Exclude: []string{"d"}}, []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, s := range tt.policy.Select(summaries, now) {
+				got = append(got, s.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	t.Parallel()
+
+	if (Retention{}).Enabled() {
+		t.Error("empty retention should be disabled")
+	}
+	p, err := Retention{MaxAge: "30d", Keep: 50, Archive: true}.Policy()
+	if err != nil {
+		t.Fatalf("Policy() error: %v", err)
+	}
+	if p.OlderThan != 30*24*time.Hour || p.Keep != 50 || !p.Archive {
+		t.Errorf("Policy() = %+v", p)
+	}
+	if _, err := (Retention{MaxAge: "a month"}).Policy(); err == nil {
+		t.Error("Policy() with a bad max_age should fail")
+	}
+	if _, err := (Retention{Keep: -1}).Policy(); err == nil {
+		t.Error("Policy() with negative keep should fail")
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	t.Parallel()
+
+	for _, archive := range []bool{false, true} {
+		dir := t.TempDir()
+		store, err := NewStore(dir)
+		if err != nil {
+			t.Fatalf("NewStore() error: %v", err)
+		}
+		var ids []string
+		for range 3 {
+			sess, _ := NewSession()
+			sess.SetMessages([]anthropic.MessageParam{
+				anthropic.NewUserMessage(anthropic.NewTextBlock("hello")),
+			})
+			if err := store.Save(sess); err != nil {
+				t.Fatalf("Save() error: %v", err)
+			}
+			ids = append(ids, sess.ID)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		pruned, path, err := store.Prune(Policy{Keep: 1, Archive: archive}, time.Now())
+		if err != nil {
+			t.Fatalf("Prune() error: %v", err)
+		}
+		if len(pruned) != 2 {
+			t.Fatalf("pruned %d sessions, want 2", len(pruned))
+		}
+		summaries, err := store.List()
+		if err != nil {
+			t.Fatalf("List() error: %v", err)
+		}
+		if len(summaries) != 1 || summaries[0].ID != ids[2] {
+			t.Errorf("List() after prune = %+v, want only the newest session", summaries)
+		}
+
+		if !archive {
+			if path != "" {
+				t.Errorf("Prune() without archiving returned archive %q", path)
+			}
+			continue
+		}
+		if !strings.HasPrefix(path, dir) {
+			t.Errorf("archive %q outside the store", path)
+		}
+		names := archiveNames(t, path)
+		for _, id := range ids[:2] {
+			for _, name := range []string{id + ".jsonl", id + ".meta.json"} {
+				if !slices.Contains(names, name) {
+					t.Errorf("archive %v missing %s", names, name)
+				}
+			}
+		}
+	}
+}
+
+func archiveNames(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening archive: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	return names
+}
@@ -7,17 +7,58 @@ import (
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/todo"
 )
 
 // Session represents a saved conversation session.
 type Session struct {
-	ID        string                   `json:"id"`
-	Title     string                   `json:"title"`
-	CreatedAt time.Time                `json:"created_at"`
-	UpdatedAt time.Time                `json:"updated_at"`
-	Messages  []anthropic.MessageParam `json:"messages"`
+	ID          string                   `json:"id"`
+	Title       string                   `json:"title"`
+	TitleSource TitleSource              `json:"title_source,omitempty"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	Model       string                   `json:"model,omitempty"`
+	Messages    []anthropic.MessageParam `json:"messages"`
+
+	// ParentID and BranchPoint are set on a fork: the session it was
+	// copied from and how many of its messages were copied.
+	ParentID    string `json:"parent_id,omitempty"`
+	BranchPoint int    `json:"branch_point,omitempty"`
+
+	Metadata
+
+	// Todos and FileHistory are the agent's task list and the file changes
+	// undo can revert, oldest first, restored when the session resumes.
+	Todos       []todo.Todo  `json:"-"`
+	FileHistory []FileChange `json:"-"`
+
+	// Skipped counts the malformed transcript lines left out when the
+	// session was loaded.
+	Skipped int `json:"-"`
+
+	// saved holds a digest of each message already in the transcript, so
+	// Save appends only what's new.
+	saved []string
+	// pending holds events recorded since the last save that can't be
+	// derived from Messages, such as model switches and compactions.
+	pending []Event
 }
 
+// TitleSource is where a session's title came from.
+type TitleSource string
+
+const (
+	// TitleExcerpt is the start of the first message, used until a title
+	// is generated.
+	TitleExcerpt TitleSource = ""
+	// TitleGenerated is a title the model wrote for the conversation.
+	TitleGenerated TitleSource = "generated"
+	// TitleUser is a title the user set, which is never replaced by a
+	// generated one.
+	TitleUser TitleSource = "user"
+)
+
 // NewSession creates a new session with a generated ID.
 func NewSession() (*Session, error) {
 	id, err := generateID()
@@ -43,18 +84,64 @@ func generateID() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// SetTitle sets the session title.
+// SetTitle sets the title the user chose for the session. Generated titles
+// don't replace it.
 func (s *Session) SetTitle(title string) {
 	s.Title = title
+	s.TitleSource = TitleUser
+	s.UpdatedAt = time.Now()
+}
+
+// SetGeneratedTitle sets a title the model wrote, unless the user has set
+// one.
+func (s *Session) SetGeneratedTitle(title string) {
+	if s.TitleSource == TitleUser || title == "" {
+		return
+	}
+	s.Title = title
+	s.TitleSource = TitleGenerated
 	s.UpdatedAt = time.Now()
 }
 
+// AutoTitle lets generated titles replace a title the user set.
+func (s *Session) AutoTitle() {
+	if s.TitleSource == TitleUser {
+		s.TitleSource = TitleExcerpt
+	}
+}
+
 // SetMessages replaces the session's messages.
 func (s *Session) SetMessages(messages []anthropic.MessageParam) {
 	s.Messages = messages
 	s.UpdatedAt = time.Now()
 }
 
+// SetModel records the model the session uses from now on.
+func (s *Session) SetModel(model string) {
+	if model == s.Model {
+		return
+	}
+	s.Model = model
+	s.addModel(model)
+	s.UpdatedAt = time.Now()
+	s.pending = append(s.pending, Event{Type: EventModel, Time: s.UpdatedAt, Model: model})
+}
+
+// AddUsage records the tokens a turn used.
+func (s *Session) AddUsage(u Usage) {
+	s.addUsage(u)
+	s.UpdatedAt = time.Now()
+	s.pending = append(s.pending, Event{Type: EventUsage, Time: s.UpdatedAt, Usage: &u})
+}
+
+// Compact replaces the session's messages with a compacted conversation,
+// recording the compaction in the transcript.
+func (s *Session) Compact(messages []anthropic.MessageParam) {
+	s.Messages = messages
+	s.UpdatedAt = time.Now()
+	s.pending = append(s.pending, Event{Type: EventCompaction, Time: s.UpdatedAt, Messages: messages})
+}
+
 // MessageCount returns the number of messages in the session.
 func (s *Session) MessageCount() int {
 	return len(s.Messages)
@@ -62,11 +149,15 @@ func (s *Session) MessageCount() int {
 
 // Summary contains metadata about a session for listing purposes.
 type Summary struct {
-	ID           string    `json:"id"`
-	Title        string    `json:"title"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	MessageCount int       `json:"message_count"`
+	ID           string      `json:"id"`
+	Title        string      `json:"title"`
+	TitleSource  TitleSource `json:"title_source,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	MessageCount int         `json:"message_count"`
+	ParentID     string      `json:"parent_id,omitempty"`
+	BranchPoint  int         `json:"branch_point,omitempty"`
+	Metadata
 }
 
 // Summary returns a Summary of the session without the full messages.
@@ -74,8 +165,12 @@ func (s *Session) Summary() Summary {
 	return Summary{
 		ID:           s.ID,
 		Title:        s.Title,
+		TitleSource:  s.TitleSource,
 		CreatedAt:    s.CreatedAt,
 		UpdatedAt:    s.UpdatedAt,
 		MessageCount: len(s.Messages),
+		ParentID:     s.ParentID,
+		BranchPoint:  s.BranchPoint,
+		Metadata:     s.Metadata.clone(),
 	}
 }
@@ -53,6 +53,29 @@ func TestSession_SetTitle(t *testing.T) {
 	}
 }
 
+func TestSession_GeneratedTitle(t *testing.T) {
+	t.Parallel()
+
+	sess, _ := NewSession()
+	sess.Title = "can you look at"
+	sess.SetGeneratedTitle("Fix LSP client deadlock")
+	if sess.Title != "Fix LSP client deadlock" || sess.TitleSource != TitleGenerated {
+		t.Errorf("generated title = %q from %q", sess.Title, sess.TitleSource)
+	}
+
+	// A title the user set stays until they ask for generated ones again.
+	sess.SetTitle("LSP work")
+	sess.SetGeneratedTitle("Add session retention")
+	if sess.Title != "LSP work" || sess.TitleSource != TitleUser {
+		t.Errorf("user title replaced: %q from %q", sess.Title, sess.TitleSource)
+	}
+	sess.AutoTitle()
+	sess.SetGeneratedTitle("Add session retention")
+	if sess.Title != "Add session retention" {
+		t.Errorf("title after AutoTitle = %q", sess.Title)
+	}
+}
+
 func TestSession_SetMessages(t *testing.T) {
 	t.Parallel()
 
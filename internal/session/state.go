@@ -0,0 +1,262 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zhubert/milo/internal/todo"
+)
+
+// A session's task list and undo history live in state/<id>.json, and the
+// file contents undo restores in blobs/<sha256>, shared by every session
+// so a file saved many times over is stored once per version. Like the
+// index, both are directories, so their files are never mistaken for
+// sessions.
+const (
+	stateDir = "state"
+	blobDir  = "blobs"
+)
+
+// FileChange is a file edit undo can revert: the file's content before the
+// change, or that it didn't exist.
+type FileChange struct {
+	Path        string
+	Existed     bool
+	Content     []byte
+	Time        time.Time
+	Tool        string
+	Description string
+}
+
+// SetTodos records the agent's task list.
+func (s *Session) SetTodos(todos []todo.Todo) {
+	s.Todos = todos
+}
+
+// SetFileHistory records the file changes undo can revert, oldest first.
+func (s *Session) SetFileHistory(changes []FileChange) {
+	s.FileHistory = changes
+}
+
+// state is the contents of a session's state file.
+type state struct {
+	Todos       []todo.Todo   `json:"todos,omitempty"`
+	FileHistory []changeEntry `json:"file_history,omitempty"`
+}
+
+// changeEntry is a FileChange with its content replaced by the hash of
+// the blob holding it.
+type changeEntry struct {
+	Path        string    `json:"path"`
+	Existed     bool      `json:"existed"`
+	Blob        string    `json:"blob,omitempty"`
+	Time        time.Time `json:"time"`
+	Tool        string    `json:"tool,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// saveState writes a session's task list and undo history, and the blobs
+// they refer to. Task text is redacted like the transcript, but file
+// contents are stored as they were, so undo restores them exactly.
+// Caller must hold the write lock.
+func (s *Store) saveState(session *Session) error {
+	path := s.statePath(session.ID)
+	if len(session.Todos) == 0 && len(session.FileHistory) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing session state: %w", err)
+		}
+		return nil
+	}
+
+	st := state{Todos: make([]todo.Todo, len(session.Todos))}
+	for i, t := range session.Todos {
+		t.Content, _ = s.redactor.Redact(t.Content)
+		t.ActiveForm, _ = s.redactor.Redact(t.ActiveForm)
+		st.Todos[i] = t
+	}
+	for _, change := range session.FileHistory {
+		entry := changeEntry{
+			Path:        change.Path,
+			Existed:     change.Existed,
+			Time:        change.Time,
+			Tool:        change.Tool,
+			Description: change.Description,
+		}
+		entry.Description, _ = s.redactor.Redact(entry.Description)
+		if change.Existed {
+			hash, err := s.writeBlob(change.Content)
+			if err != nil {
+				return err
+			}
+			entry.Blob = hash
+		}
+		st.FileHistory = append(st.FileHistory, entry)
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("marshaling session state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating session state directory: %w", err)
+	}
+	if err := writeAtomic(path, data); err != nil {
+		return fmt.Errorf("writing session state: %w", err)
+	}
+	return nil
+}
+
+// loadState reads a session's task list and undo history, if it has any.
+// A change whose blob has gone missing can't be undone, so it is dropped.
+// Caller must hold at least a read lock.
+func (s *Store) loadState(session *Session) error {
+	st, err := s.readState(session.ID)
+	if err != nil {
+		return err
+	}
+	session.Todos = st.Todos
+	session.FileHistory = nil
+	for _, entry := range st.FileHistory {
+		change := FileChange{
+			Path:        entry.Path,
+			Existed:     entry.Existed,
+			Time:        entry.Time,
+			Tool:        entry.Tool,
+			Description: entry.Description,
+		}
+		if entry.Existed {
+			if !validBlob(entry.Blob) {
+				continue
+			}
+			content, err := os.ReadFile(s.blobPath(entry.Blob))
+			if err != nil {
+				continue
+			}
+			change.Content = content
+		}
+		session.FileHistory = append(session.FileHistory, change)
+	}
+	return nil
+}
+
+// readState reads a session's state file, which is empty if missing.
+func (s *Store) readState(id string) (state, error) {
+	var st state
+	data, err := os.ReadFile(s.statePath(id))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("reading session state: %w", err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("parsing session state: %w", err)
+	}
+	return st, nil
+}
+
+// writeBlob stores content under its hash, unless it is already stored,
+// and returns the hash.
+func (s *Store) writeBlob(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	path := s.blobPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	if err := writeAtomic(path, content); err != nil {
+		return "", fmt.Errorf("writing file snapshot: %w", err)
+	}
+	return hash, nil
+}
+
+// removeUnusedBlobs deletes blobs no session's state refers to any more.
+// Caller must hold the write lock.
+func (s *Store) removeUnusedBlobs() error {
+	blobs, err := os.ReadDir(filepath.Join(s.dir, blobDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot directory: %w", err)
+	}
+
+	used := make(map[string]bool)
+	states, err := os.ReadDir(filepath.Join(s.dir, stateDir))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading session state directory: %w", err)
+	}
+	for _, entry := range states {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, stateDir, entry.Name()))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading session state: %w", err)
+		}
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			// Keep every blob a damaged state file still names rather
+			// than lose what it refers to.
+			for _, hash := range blobHashes.FindAll(data, -1) {
+				used[string(hash)] = true
+			}
+			continue
+		}
+		for _, change := range st.FileHistory {
+			used[change.Blob] = true
+		}
+	}
+
+	for _, blob := range blobs {
+		if used[blob.Name()] || blob.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, blobDir, blob.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing file snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// statePath returns the path of a session's task list and undo history.
+func (s *Store) statePath(id string) string {
+	return filepath.Join(s.dir, stateDir, id+".json")
+}
+
+// blobHashes finds the blob names in a state file that can't be parsed.
+var blobHashes = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// validBlob reports whether name is a blob's hash. Names come from state
+// files, which may have been tampered with, so only a hash is joined into
+// a path.
+func validBlob(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// blobPath returns the path of the file content with the given hash, which
+// must be one validBlob accepts.
+func (s *Store) blobPath(hash string) string {
+	return filepath.Join(s.dir, blobDir, hash)
+}
@@ -0,0 +1,224 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/todo"
+)
+
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(dir, blobDir))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func savedWithState(t *testing.T, store *Store, changes ...FileChange) *Session {
+	t.Helper()
+	sess, _ := NewSession()
+	sess.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("refactor main.go")),
+	})
+	sess.SetTodos([]todo.Todo{
+		{Content: "Split main", ActiveForm: "Splitting main", Status: todo.StatusCompleted},
+		{Content: "Run tests", ActiveForm: "Running tests", Status: todo.StatusInProgress},
+	})
+	sess.SetFileHistory(changes)
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	return sess
+}
+
+func TestStore_SaveState(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	changes := []FileChange{
+		{Path: "/work/main.go", Existed: true, Content: []byte("package main\n"), Time: at, Tool: "edit", Description: "split main"},
+		{Path: "/work/util.go", Existed: false, Time: at, Tool: "write"},
+		{Path: "/work/main.go", Existed: true, Content: []byte("package main\n"), Time: at, Tool: "edit"},
+	}
+	sess := savedWithState(t, store, changes...)
+
+	// The same content is stored once.
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("%d blobs stored, want 1", n)
+	}
+
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !slices.Equal(loaded.Todos, sess.Todos) {
+		t.Errorf("loaded todos = %+v, want %+v", loaded.Todos, sess.Todos)
+	}
+	if len(loaded.FileHistory) != 3 {
+		t.Fatalf("loaded %d file changes, want 3", len(loaded.FileHistory))
+	}
+	for i, want := range changes {
+		got := loaded.FileHistory[i]
+		if got.Path != want.Path || got.Existed != want.Existed || string(got.Content) != string(want.Content) ||
+			!got.Time.Equal(want.Time) || got.Tool != want.Tool || got.Description != want.Description {
+			t.Errorf("change %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// A change whose snapshot is gone can't be undone, so it isn't restored.
+	if err := os.RemoveAll(filepath.Join(dir, blobDir)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(loaded.FileHistory) != 1 || loaded.FileHistory[0].Path != "/work/util.go" {
+		t.Errorf("file history without snapshots = %+v, want only the created file", loaded.FileHistory)
+	}
+
+	// Clearing the state removes its file.
+	loaded.SetTodos(nil)
+	loaded.SetFileHistory(nil)
+	if err := store.Save(loaded); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, stateDir, sess.ID+".json")); !os.IsNotExist(err) {
+		t.Error("state file still exists after clearing the state")
+	}
+}
+
+func TestStore_DeleteKeepsSharedSnapshots(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	shared := FileChange{Path: "/work/a.go", Existed: true, Content: []byte("shared"), Tool: "edit"}
+	own := FileChange{Path: "/work/b.go", Existed: true, Content: []byte("own"), Tool: "edit"}
+	first := savedWithState(t, store, shared, own)
+	second := savedWithState(t, store, shared)
+	if n := countBlobs(t, dir); n != 2 {
+		t.Fatalf("%d blobs stored, want 2", n)
+	}
+
+	if err := store.Delete(first.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("%d blobs after deleting one session, want the shared one", n)
+	}
+	loaded, err := store.Load(second.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(loaded.FileHistory) != 1 || string(loaded.FileHistory[0].Content) != "shared" {
+		t.Errorf("remaining session's file history = %+v", loaded.FileHistory)
+	}
+
+	// Archiving takes the snapshots along.
+	path, err := store.Archive([]string{second.ID}, time.Now())
+	if err != nil {
+		t.Fatalf("Archive() error: %v", err)
+	}
+	sum := sha256.Sum256([]byte("shared"))
+	names := archiveNames(t, path)
+	for _, want := range []string{stateDir + "/" + second.ID + ".json", blobDir + "/" + hex.EncodeToString(sum[:])} {
+		if !slices.Contains(names, want) {
+			t.Errorf("archive %v missing %s", names, want)
+		}
+	}
+}
+
+func TestStore_IgnoresInvalidBlobNames(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "sessions")
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("token"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sess := savedWithState(t, store, FileChange{Path: "/work/a.go", Existed: true, Content: []byte("a"), Tool: "edit"})
+
+	// A tampered state file points a change outside the blob directory.
+	statePath := filepath.Join(dir, stateDir, sess.ID+".json")
+	tampered := `{"file_history":[{"path":"/work/a.go","existed":true,"blob":"../../secret","tool":"edit"}]}`
+	if err := os.WriteFile(statePath, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(loaded.FileHistory) != 0 {
+		t.Errorf("file history = %+v, want the tampered change dropped", loaded.FileHistory)
+	}
+	path, err := store.Archive([]string{sess.ID}, time.Now())
+	if err != nil {
+		t.Fatalf("Archive() error: %v", err)
+	}
+	for _, name := range archiveNames(t, path) {
+		if strings.Contains(name, "secret") {
+			t.Errorf("archive contains %s", name)
+		}
+	}
+}
+
+func TestStore_DeleteKeepsBlobsOfDamagedState(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	first := savedWithState(t, store, FileChange{Path: "/work/a.go", Existed: true, Content: []byte("own"), Tool: "edit"})
+	second := savedWithState(t, store, FileChange{Path: "/work/b.go", Existed: true, Content: []byte("damaged"), Tool: "edit"})
+
+	// Cut the second session's state file short: it no longer parses,
+	// but still names its blob.
+	statePath := filepath.Join(dir, stateDir, second.ID+".json")
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath, data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(first.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	sum := sha256.Sum256([]byte("damaged"))
+	if _, err := os.Stat(filepath.Join(dir, blobDir, hex.EncodeToString(sum[:]))); err != nil {
+		t.Errorf("blob of the damaged state file: %v", err)
+	}
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("%d blobs after deleting one session, want only the damaged state's", n)
+	}
+}
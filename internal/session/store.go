@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"strings"
 	"sync"
+
+	"github.com/zhubert/milo/internal/redact"
 )
 
 // Store manages session persistence to the filesystem.
 type Store struct {
-	dir string
-	mu  sync.RWMutex
+	dir      string
+	mu       sync.RWMutex
+	redactor *redact.Redactor
 }
 
 // NewStore creates a new session store at the given directory.
@@ -29,22 +32,63 @@ func StoreForWorkDir(workDir string) (*Store, error) {
 	return NewStore(filepath.Join(workDir, ".milo", "sessions"))
 }
 
-// Save persists a session to disk.
+// SetRedactor sets the redactor applied to sessions as they are saved,
+// so secrets typed by the user or passed in tool inputs never hit disk.
+func (s *Store) SetRedactor(r *redact.Redactor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redactor = r
+}
+
+// Save brings a session's transcript up to date. Events since the last save
+// are appended to <id>.jsonl and synced, so a crash loses at most the events
+// being written, and the metadata in <id>.meta.json and the task list and
+// undo history in state/<id>.json are replaced atomically.
+// A session loaded from a legacy <id>.json file moves to the new format.
 func (s *Store) Save(session *Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.MarshalIndent(session, "", "  ")
+	events, digests, err := session.unsaved()
 	if err != nil {
-		return fmt.Errorf("marshaling session: %w", err)
+		return err
 	}
 
-	path := s.sessionPath(session.ID)
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("writing session file: %w", err)
+	lines := make([][]byte, 0, len(events))
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("marshaling session event: %w", err)
+		}
+		if line, _, err = s.redactor.RedactJSON(line); err != nil {
+			return fmt.Errorf("redacting session: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := appendTranscript(s.transcriptPath(session.ID), lines); err != nil {
+		return err
 	}
+	session.saved = digests
+	session.pending = nil
 
-	return nil
+	meta, err := json.MarshalIndent(session.Summary(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling session metadata: %w", err)
+	}
+	if meta, _, err = s.redactor.RedactJSON(meta); err != nil {
+		return fmt.Errorf("redacting session: %w", err)
+	}
+	if err := writeAtomic(s.metaPath(session.ID), meta); err != nil {
+		return fmt.Errorf("writing session metadata: %w", err)
+	}
+	if err := s.saveState(session); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.legacyPath(session.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing legacy session file: %w", err)
+	}
+	return s.updateIndex(session, events)
 }
 
 // Load retrieves a session by ID.
@@ -52,94 +96,220 @@ func (s *Store) Load(id string) (*Session, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	path := s.sessionPath(id)
-	data, err := os.ReadFile(path)
+	session, err := s.loadUnlocked(id)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("session %q not found", id)
 		}
-		return nil, fmt.Errorf("reading session file: %w", err)
+		return nil, err
 	}
+	return session, nil
+}
 
-	var session Session
-	if err := json.Unmarshal(data, &session); err != nil {
-		return nil, fmt.Errorf("unmarshaling session: %w", err)
+// Transcript returns a session's summary and the events it was built from.
+// A session saved before transcripts yields one event per message.
+func (s *Store) Transcript(id string) (Summary, []Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, err := s.loadUnlocked(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Summary{}, nil, fmt.Errorf("session %q not found", id)
+		}
+		return Summary{}, nil, err
 	}
 
-	return &session, nil
+	events, _, err := readEvents(s.transcriptPath(id))
+	if os.IsNotExist(err) {
+		for _, msg := range session.Messages {
+			events = append(events, messageEvent(msg, session.UpdatedAt))
+		}
+		if session.Model != "" {
+			events = append([]Event{{Type: EventModel, Time: session.CreatedAt, Model: session.Model}}, events...)
+		}
+		return session.Summary(), events, nil
+	}
+	if err != nil {
+		return Summary{}, nil, fmt.Errorf("loading session %q: %w", id, err)
+	}
+	return session.Summary(), events, nil
 }
 
-// Delete removes a session from disk.
+// Delete removes a session from disk, with the file snapshots only it
+// referred to.
 func (s *Store) Delete(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	path := s.sessionPath(id)
-	if err := os.Remove(path); err != nil {
-		if os.IsNotExist(err) {
-			return nil // Already gone, that's fine
-		}
-		return fmt.Errorf("deleting session file: %w", err)
+	if err := s.deleteUnlocked(id); err != nil {
+		return err
 	}
+	return s.removeUnusedBlobs()
+}
 
-	return nil
+// deleteUnlocked removes a session's files, leaving its snapshots.
+// Caller must hold the write lock.
+func (s *Store) deleteUnlocked(id string) error {
+	for _, path := range []string{s.transcriptPath(id), s.metaPath(id), s.legacyPath(id), s.statePath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("deleting session file: %w", err)
+		}
+	}
+	return s.removeFromIndex(id)
 }
 
 // List returns summaries of all sessions, sorted by update time (newest first).
+// Summaries come from the index, so only sessions it doesn't know about yet
+// are read.
 func (s *Store) List() ([]Summary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	entries, err := os.ReadDir(s.dir)
+	summaries, stale, err := s.summaries()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+		return nil, err
+	}
+	if stale {
+		if err := s.writeSummaries(summaries); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("reading session directory: %w", err)
 	}
+	return sortedSummaries(summaries), nil
+}
 
-	var summaries []Summary
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
-			continue
+// Resolve returns the ID of the session ref names: its ID, or the start of
+// its title, ignoring case, if no other session's title starts the same way.
+func (s *Store) Resolve(ref string) (string, error) {
+	summaries, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	for _, summary := range summaries {
+		if summary.ID == ref {
+			return ref, nil
 		}
+	}
 
-		id := entry.Name()[:len(entry.Name())-5] // Strip .json
-		session, err := s.loadUnlocked(id)
-		if err != nil {
-			continue // Skip corrupted sessions
+	prefix := strings.ToLower(strings.TrimSpace(ref))
+	var matches []Summary
+	if prefix != "" {
+		for _, summary := range summaries {
+			if strings.HasPrefix(strings.ToLower(summary.Title), prefix) {
+				matches = append(matches, summary)
+			}
 		}
-
-		summaries = append(summaries, session.Summary())
 	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("session %q not found", ref)
+	case 1:
+		return matches[0].ID, nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = fmt.Sprintf("%s (%s)", m.ID, m.Title)
+	}
+	return "", fmt.Errorf("%q matches %d session titles: %s", ref, len(matches), strings.Join(names, ", "))
+}
 
-	// Sort by UpdatedAt descending (most recent first)
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
-	})
+// sessionID returns the session ID a file in the store belongs to.
+func sessionID(name string) (string, bool) {
+	for _, ext := range []string{".meta.json", ".jsonl", ".json"} {
+		if id, ok := strings.CutSuffix(name, ext); ok {
+			return id, id != ""
+		}
+	}
+	return "", false
+}
 
-	return summaries, nil
+// summaryUnlocked returns a session's summary, from its metadata file when
+// there is one, without reading the transcript.
+// Caller must hold at least a read lock.
+func (s *Store) summaryUnlocked(id string) (Summary, error) {
+	if data, err := os.ReadFile(s.metaPath(id)); err == nil {
+		var summary Summary
+		if err := json.Unmarshal(data, &summary); err == nil && summary.ID == id {
+			return summary, nil
+		}
+	}
+	session, err := s.loadUnlocked(id)
+	if err != nil {
+		return Summary{}, err
+	}
+	return session.Summary(), nil
 }
 
-// loadUnlocked loads a session without acquiring the lock.
+// loadUnlocked loads a session without acquiring the lock, from its
+// transcript or else its legacy JSON file.
 // Caller must hold at least a read lock.
 func (s *Store) loadUnlocked(id string) (*Session, error) {
-	path := s.sessionPath(id)
-	data, err := os.ReadFile(path)
+	path := s.transcriptPath(id)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return s.loadLegacy(id)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("reading session transcript: %w", err)
+	}
+
+	// Metadata may be missing if the process died before writing it.
+	session := &Session{ID: id, CreatedAt: info.ModTime()}
+	if data, err := os.ReadFile(s.metaPath(id)); err == nil {
+		var summary Summary
+		if err := json.Unmarshal(data, &summary); err == nil {
+			session.Title = summary.Title
+			session.TitleSource = summary.TitleSource
+			session.CreatedAt = summary.CreatedAt
+			session.UpdatedAt = summary.UpdatedAt
+			session.ParentID = summary.ParentID
+			session.BranchPoint = summary.BranchPoint
+			// Models and usage are rebuilt from the transcript.
+			session.GitStart = summary.GitStart
+			session.GitEnd = summary.GitEnd
+			session.FilesTouched = summary.FilesTouched
+			session.LastStatus = summary.LastStatus
+		}
+	}
+	if err := readTranscript(path, session); err != nil {
+		return nil, fmt.Errorf("loading session %q: %w", id, err)
+	}
+	if err := s.loadState(session); err != nil {
+		return nil, fmt.Errorf("loading session %q: %w", id, err)
+	}
+	return session, nil
+}
+
+// loadLegacy loads a session saved as a single JSON document.
+func (s *Store) loadLegacy(id string) (*Session, error) {
+	data, err := os.ReadFile(s.legacyPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("reading session file: %w", err)
 	}
 
 	var session Session
 	if err := json.Unmarshal(data, &session); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unmarshaling session: %w", err)
 	}
 
 	return &session, nil
 }
 
-// sessionPath returns the file path for a session ID.
-func (s *Store) sessionPath(id string) string {
+// transcriptPath returns the path of a session's event log.
+func (s *Store) transcriptPath(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+// metaPath returns the path of a session's metadata.
+func (s *Store) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".meta.json")
+}
+
+// legacyPath returns the path of a session saved before transcripts.
+func (s *Store) legacyPath(id string) string {
 	return filepath.Join(s.dir, id+".json")
 }
 
@@ -0,0 +1,289 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// EventType identifies the kind of transcript event.
+type EventType string
+
+const (
+	// EventMessage appends a user or assistant message.
+	EventMessage EventType = "message"
+	// EventToolResult appends a user message carrying tool results.
+	EventToolResult EventType = "tool_result"
+	// EventCompaction replaces the conversation with its compacted form.
+	EventCompaction EventType = "compaction"
+	// EventReplace replaces the conversation after any other change that
+	// isn't an append, such as the conversation being cleared.
+	EventReplace EventType = "replace"
+	// EventModel records a switch to another model.
+	EventModel EventType = "model"
+	// EventUsage records the tokens a turn used.
+	EventUsage EventType = "usage"
+)
+
+// Usage is the token consumption and list price of one turn.
+type Usage struct {
+	Model        string  `json:"model"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost_usd"`
+}
+
+// Event is one line of a session transcript. A session is rebuilt by
+// replaying its events in order.
+type Event struct {
+	Type     EventType                `json:"type"`
+	Time     time.Time                `json:"time"`
+	Message  *anthropic.MessageParam  `json:"message,omitempty"`
+	Messages []anthropic.MessageParam `json:"messages,omitempty"`
+	Model    string                   `json:"model,omitempty"`
+	Usage    *Usage                   `json:"usage,omitempty"`
+}
+
+// apply replays the event onto the session.
+func (e Event) apply(s *Session) {
+	switch e.Type {
+	case EventMessage, EventToolResult:
+		if e.Message != nil {
+			s.Messages = append(s.Messages, *e.Message)
+		}
+	case EventCompaction, EventReplace:
+		s.Messages = append([]anthropic.MessageParam(nil), e.Messages...)
+	case EventModel:
+		s.Model = e.Model
+		s.addModel(e.Model)
+	case EventUsage:
+		if e.Usage != nil {
+			s.addUsage(*e.Usage)
+		}
+	}
+	if e.Time.After(s.UpdatedAt) {
+		s.UpdatedAt = e.Time
+	}
+}
+
+// messageEvent returns the event that appends msg.
+func messageEvent(msg anthropic.MessageParam, at time.Time) Event {
+	typ := EventMessage
+	for _, block := range msg.Content {
+		if block.OfToolResult != nil {
+			typ = EventToolResult
+			break
+		}
+	}
+	return Event{Type: typ, Time: at, Message: &msg}
+}
+
+// digest identifies a message's content, to tell whether the conversation
+// has only grown since the last save.
+func digest(msg anthropic.MessageParam) (string, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("marshaling message: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// unsaved returns the events that bring the transcript up to date with the
+// session, and the digests of its messages once they are written.
+func (s *Session) unsaved() ([]Event, []string, error) {
+	events := append([]Event(nil), s.pending...)
+
+	saved := s.saved
+	for _, e := range s.pending {
+		if e.Type == EventCompaction || e.Type == EventReplace {
+			// The compaction is written as is, so the messages after it
+			// are compared against the compacted conversation.
+			saved = nil
+			for _, msg := range e.Messages {
+				d, err := digest(msg)
+				if err != nil {
+					return nil, nil, err
+				}
+				saved = append(saved, d)
+			}
+		}
+	}
+
+	digests := make([]string, len(s.Messages))
+	for i, msg := range s.Messages {
+		d, err := digest(msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		digests[i] = d
+	}
+
+	appended := len(saved) <= len(digests)
+	for i := 0; appended && i < len(saved); i++ {
+		appended = saved[i] == digests[i]
+	}
+	if !appended {
+		return append(events, Event{Type: EventReplace, Time: s.UpdatedAt, Messages: s.Messages}), digests, nil
+	}
+	for _, msg := range s.Messages[len(saved):] {
+		events = append(events, messageEvent(msg, s.UpdatedAt))
+	}
+	return events, digests, nil
+}
+
+// readTranscript replays the events in a transcript file onto s.
+func readTranscript(path string, s *Session) error {
+	events, skipped, err := readEvents(path)
+	if err != nil {
+		return err
+	}
+	s.Skipped = skipped
+	for _, e := range events {
+		e.apply(s)
+	}
+
+	s.saved = make([]string, len(s.Messages))
+	for i, msg := range s.Messages {
+		if s.saved[i], err = digest(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEvents reads the events in a transcript file, and how many malformed
+// lines it skipped. Only a malformed first line, which means the file is not
+// a transcript at all, is an error. A final line without a
+// newline is a write cut short by a crash and is ignored.
+func readEvents(path string) ([]Event, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	var lines, skipped int
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Torn or empty final line.
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading transcript: %w", err)
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			if lines == 1 {
+				return nil, 0, fmt.Errorf("reading transcript header: %w", err)
+			}
+			// A line torn by an earlier crash; the rest is still usable.
+			skipped++
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, skipped, nil
+}
+
+// appendTranscript appends lines to a transcript file and syncs it. A torn
+// final line left by an earlier crash is cut off first, so the new events
+// start on a line of their own.
+func appendTranscript(path string, lines [][]byte) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("opening transcript: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	end, err := completeLength(f)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(end); err != nil {
+		return fmt.Errorf("truncating torn transcript line: %w", err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking transcript: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("appending to transcript: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing transcript: %w", err)
+	}
+	return nil
+}
+
+// completeLength returns the length of f up to and including its last
+// newline.
+func completeLength(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("reading transcript: %w", err)
+	}
+	size := info.Size()
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, fmt.Errorf("reading transcript: %w", err)
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it
+// into place, so readers see either the old or the new content.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func mustReadEvents(t *testing.T, path string) []Event {
+	t.Helper()
+	events, _, err := readEvents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestStore_SaveAppends(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	sess, _ := NewSession()
+	sess.SetModel("claude-sonnet-4-5")
+	sess.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("list the files")),
+	})
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	path := filepath.Join(dir, sess.ID+".jsonl")
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A tool round adds the assistant's call and its result.
+	sess.SetMessages(append(sess.Messages,
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t1", json.RawMessage(`{}`), "glob")),
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("t1", "a.go", false)),
+	))
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	// Saving again with nothing new writes nothing.
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	second, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(second, first) {
+		t.Fatal("second save rewrote earlier events")
+	}
+	var types []EventType
+	for _, e := range mustReadEvents(t, path) {
+		types = append(types, e.Type)
+	}
+	want := []EventType{EventModel, EventMessage, EventMessage, EventToolResult}
+	if len(types) != len(want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("events = %v, want %v", types, want)
+			break
+		}
+	}
+
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.MessageCount() != 3 || loaded.Model != "claude-sonnet-4-5" {
+		t.Errorf("loaded %d messages with model %q, want 3 with claude-sonnet-4-5", loaded.MessageCount(), loaded.Model)
+	}
+}
+
+func TestStore_SaveCompactionAndReplace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	sess, _ := NewSession()
+	sess.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("one")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("two")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("three")),
+	})
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// Compaction, then the turn goes on.
+	summary := anthropic.NewUserMessage(anthropic.NewTextBlock("summary of one and two"))
+	sess.Compact([]anthropic.MessageParam{summary, sess.Messages[2]})
+	sess.SetMessages(append(sess.Messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock("four"))))
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	events := mustReadEvents(t, filepath.Join(dir, sess.ID+".jsonl"))
+	if got := events[len(events)-2].Type; got != EventCompaction {
+		t.Errorf("event before the new message = %s, want compaction", got)
+	}
+	if got := events[len(events)-1].Type; got != EventMessage {
+		t.Errorf("last event = %s, want message", got)
+	}
+
+	// Dropping messages without a compaction is recorded as a replace.
+	sess.SetMessages(sess.Messages[:1])
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	events = mustReadEvents(t, filepath.Join(dir, sess.ID+".jsonl"))
+	if got := events[len(events)-1].Type; got != EventReplace {
+		t.Errorf("last event = %s, want replace", got)
+	}
+
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.MessageCount() != 1 || loaded.Messages[0].Content[0].OfText.Text != "summary of one and two" {
+		t.Errorf("loaded messages = %+v, want only the summary", loaded.Messages)
+	}
+}
+
+func TestStore_LoadTornTranscript(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	sess, _ := NewSession()
+	sess.SetMessages([]anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hello")),
+	})
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// A crash cut the next event short.
+	path := filepath.Join(dir, sess.ID+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"type":"message","message":{"role":"assis`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	loaded, err := store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.MessageCount() != 1 {
+		t.Fatalf("loaded %d messages, want 1", loaded.MessageCount())
+	}
+
+	// The next save replaces the torn line rather than appending to it.
+	loaded.SetMessages(append(loaded.Messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock("hi"))))
+	if err := store.Save(loaded); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if events := mustReadEvents(t, path); len(events) != 2 {
+		t.Errorf("transcript has %d events, want 2", len(events))
+	}
+
+	// A malformed line in the middle is skipped and counted.
+	data, _ := os.ReadFile(path)
+	header, rest, _ := bytes.Cut(data, []byte("\n"))
+	torn := append(append(append([]byte(nil), header...), "\n{\"type\":\"mess\n"...), rest...)
+	if err := os.WriteFile(path, torn, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.Load(sess.ID)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.MessageCount() != 2 || loaded.Skipped != 1 {
+		t.Errorf("loaded %d messages skipping %d lines, want 2 skipping 1", loaded.MessageCount(), loaded.Skipped)
+	}
+
+	// A malformed first line means this isn't a transcript.
+	if err := os.WriteFile(path, append([]byte("not json\n"), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(sess.ID); err == nil || !strings.Contains(err.Error(), "header") {
+		t.Errorf("Load() error = %v, want one about the header", err)
+	}
+}
+
+func TestStore_LoadLegacy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error: %v", err)
+	}
+	legacy := `{
+  "id": "0badc0de",
+  "title": "Old session",
+  "created_at": "2025-01-02T03:04:05Z",
+  "updated_at": "2025-01-02T03:04:05Z",
+  "messages": [{"role": "user", "content": [{"type": "text", "text": "hello"}]}]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "0badc0de.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Title != "Old session" {
+		t.Fatalf("List() = %+v, want the legacy session", summaries)
+	}
+
+	sess, err := store.Load("0badc0de")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if sess.MessageCount() != 1 {
+		t.Fatalf("loaded %d messages, want 1", sess.MessageCount())
+	}
+
+	// Saving moves it to a transcript.
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0badc0de.json")); !os.IsNotExist(err) {
+		t.Error("legacy file still exists after save")
+	}
+	again, err := store.Load("0badc0de")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if again.MessageCount() != 1 || again.Title != "Old session" {
+		t.Errorf("migrated session = %d messages, title %q", again.MessageCount(), again.Title)
+	}
+}
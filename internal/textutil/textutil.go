@@ -0,0 +1,13 @@
+// Package textutil holds small helpers for text shown to the user.
+package textutil
+
+import "unicode/utf8"
+
+// Truncate shortens s to at most n characters, ending in "..." if cut. It
+// counts runes, so a multi-byte character is never split.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
@@ -0,0 +1,24 @@
+package textutil
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"a longer sentence", 10, "a longe..."},
+		{"héllo wörld ünicode", 10, "héllo w..."},
+		{"日本語のテキストです", 8, "日本語のテ..."},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.n); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package tool
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,10 +9,16 @@ import (
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/sandbox"
 )
 
 const defaultBashTimeout = 2 * time.Minute
 
+// bashWaitDelay bounds how long a finished command may keep its output
+// pipes open through processes it left running in the background.
+const bashWaitDelay = time.Second
+
 // stripCDToWorkDir removes a "cd <workdir> &&" or "cd <workdir>;" prefix from a command
 // if the path matches the working directory. Commands already run in the working directory,
 // so this prefix is redundant.
@@ -63,17 +68,31 @@ func stripCDToWorkDir(command, workDir string) string {
 // BashTool executes shell commands.
 type BashTool struct {
 	WorkDir string
+	Jobs    *JobManager      // Runs background commands; nil disables background mode
+	Shell   *Shell           // Persistent shell; nil runs each command in a fresh bash
+	Sandbox *sandbox.Sandbox // Confines commands; nil runs them unrestricted
+	Limits  BashLimits       // Resource limits applied to every command
+	Env     []string         // Environment for commands; nil inherits milo's
 }
 
 type bashInput struct {
-	Command string `json:"command"`
-	Timeout int    `json:"timeout"` // milliseconds
+	Command    string `json:"command"`
+	Timeout    int    `json:"timeout"` // milliseconds
+	Background bool   `json:"background,omitempty"`
 }
 
 func (t *BashTool) Name() string { return "bash" }
 
 func (t *BashTool) Description() string {
-	return `Execute a bash command and return its output.
+	desc := bashDescription
+	if t.Sandbox != nil {
+		desc += "\n\nCommands run in a sandbox (" + t.Sandbox.Describe() + "). " +
+			"Writes elsewhere and network access fail with permission errors."
+	}
+	return desc
+}
+
+const bashDescription = `Execute a bash command and return its output.
 
 IMPORTANT: This tool is for terminal operations like git, npm, docker, etc.
 DO NOT use it for file operations - use specialized tools instead:
@@ -84,8 +103,11 @@ DO NOT use it for file operations - use specialized tools instead:
 - Write files: Use write (NOT echo/cat)
 
 The command runs in a shell with a configurable timeout (default 2 minutes).
-Both stdout and stderr are captured.`
-}
+Both stdout and stderr are captured.
+
+For long-running processes such as dev servers or watchers, set background
+to true. The command is started detached and a job ID is returned; use the
+job tool to read its output or kill it.`
 
 func (t *BashTool) InputSchema() anthropic.ToolInputSchemaParam {
 	return anthropic.ToolInputSchemaParam{
@@ -98,11 +120,24 @@ func (t *BashTool) InputSchema() anthropic.ToolInputSchemaParam {
 				"type":        "integer",
 				"description": "Timeout in milliseconds (default 120000)",
 			},
+			"background": map[string]any{
+				"type":        "boolean",
+				"description": "Run the command as a background job and return its ID immediately",
+			},
 		},
 		Required: []string{"command"},
 	}
 }
 
+// CurrentDir returns the directory the next command will run in. With a
+// persistent shell this follows any cd from earlier commands.
+func (t *BashTool) CurrentDir() string {
+	if t.Shell != nil {
+		return t.Shell.Dir()
+	}
+	return t.WorkDir
+}
+
 // NormalizeInput strips redundant "cd <workdir> &&" prefixes from bash commands.
 // This ensures permission checks and execution see the actual command being run.
 func (t *BashTool) NormalizeInput(input json.RawMessage) json.RawMessage {
@@ -111,7 +146,7 @@ func (t *BashTool) NormalizeInput(input json.RawMessage) json.RawMessage {
 		return input
 	}
 
-	normalized := stripCDToWorkDir(in.Command, t.WorkDir)
+	normalized := stripCDToWorkDir(in.Command, t.CurrentDir())
 	if normalized == in.Command {
 		return input // No change needed
 	}
@@ -131,7 +166,11 @@ func (t *BashTool) Execute(ctx context.Context, input json.RawMessage) (Result,
 	}
 
 	// Strip unnecessary "cd <workdir> &&" prefix - commands already run in the working directory
-	in.Command = stripCDToWorkDir(in.Command, t.WorkDir)
+	in.Command = stripCDToWorkDir(in.Command, t.CurrentDir())
+
+	if in.Background {
+		return t.startBackground(in.Command)
+	}
 
 	timeout := defaultBashTimeout
 	if in.Timeout > 0 {
@@ -141,37 +180,75 @@ func (t *BashTool) Execute(ctx context.Context, input json.RawMessage) (Result,
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", in.Command)
+	if t.Shell != nil {
+		return t.executeInShell(ctx, in.Command, timeout)
+	}
+
+	// The command gets its own process group so a timeout or cancel can
+	// kill everything it started, not just bash.
+	cmd := exec.Command("bash", "-c", t.Limits.ulimitPrefix()+in.Command)
 	if t.WorkDir != "" {
 		cmd.Dir = t.WorkDir
 	}
-
-	var stdout, stderr bytes.Buffer
+	cmd.Env = t.Env
+	setProcessGroup(cmd)
+	// Don't wait on pipes held open by backgrounded grandchildren.
+	cmd.WaitDelay = bashWaitDelay
+
+	maxOutput := t.Limits.maxOutput()
+	stdout := &cappedBuffer{limit: maxOutput}
+	stderr := &cappedBuffer{limit: maxOutput}
 	cmd.Stdin = nil // Explicitly close stdin to prevent commands from blocking on input
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := startCommand(cmd, t.Sandbox); err != nil {
+		return Result{Output: err.Error(), IsError: true}, nil
+	}
 
-	err := cmd.Run()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	var killed string
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		pgid := cmd.Process.Pid
+		members, _ := killProcessGroup(pgid)
+		killed = describeKilled(pgid, members)
+		err = <-done
+	}
 
 	var output string
-	if stdout.Len() > 0 {
-		output = stdout.String()
+	if stdout.buf.Len() > 0 {
+		output = stdout.buf.String()
 	}
-	if stderr.Len() > 0 {
+	if stderr.buf.Len() > 0 {
 		if output != "" {
 			output += "\n"
 		}
-		output += stderr.String()
+		output += stderr.buf.String()
 	}
+	output = truncateOutput(output, maxOutput, stdout.dropped+stderr.dropped)
 
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return Result{Output: fmt.Sprintf("command timed out after %s", timeout), IsError: true}, nil
+	if killed != "" {
+		reason := fmt.Sprintf("command timed out after %s", timeout)
+		if ctx.Err() == context.Canceled {
+			reason = "command cancelled"
+		}
+		msg := fmt.Sprintf("%s; %s", reason, killed)
+		if output != "" {
+			msg += "\n\nOutput before it was killed:\n" + output
 		}
+		return Result{Output: msg, IsError: true}, nil
+	}
+
+	if err != nil {
 		if output == "" {
 			output = err.Error()
 		}
-		return Result{Output: output, IsError: true}, nil
+		return Result{Output: t.annotateSandboxError(output), IsError: true}, nil
 	}
 
 	if output == "" {
@@ -180,3 +257,79 @@ func (t *BashTool) Execute(ctx context.Context, input json.RawMessage) (Result,
 
 	return Result{Output: output}, nil
 }
+
+// annotateSandboxError explains failed output that looks like it was caused
+// by the sandbox, so the model doesn't keep retrying the same command.
+func (t *BashTool) annotateSandboxError(output string) string {
+	if t.Sandbox == nil || !sandbox.LooksLikeViolation(output) {
+		return output
+	}
+	return output + "\n[sandbox] This command may have been blocked by the sandbox (" + t.Sandbox.Describe() +
+		"). Writes outside the writable paths and disabled network access will fail; ask the user if this access is needed."
+}
+
+// startCommand starts cmd, inside sb when it is non-nil.
+func startCommand(cmd *exec.Cmd, sb *sandbox.Sandbox) error {
+	if sb == nil {
+		return cmd.Start()
+	}
+	return sb.Start(cmd)
+}
+
+// startBackground launches the command as a background job.
+func (t *BashTool) startBackground(command string) (Result, error) {
+	if t.Jobs == nil {
+		return Result{Output: "background jobs are not available", IsError: true}, nil
+	}
+
+	info, err := t.Jobs.Start(command, t.CurrentDir())
+	if err != nil {
+		return Result{Output: err.Error(), IsError: true}, nil
+	}
+	return Result{Output: fmt.Sprintf("Started background job %s (pid %d). Use the job tool to read its output or kill it.", info.ID, info.PID)}, nil
+}
+
+// executeInShell runs the command in the persistent shell.
+func (t *BashTool) executeInShell(ctx context.Context, command string, timeout time.Duration) (Result, error) {
+	res, err := t.Shell.Run(ctx, command)
+	if err != nil {
+		reason := err.Error()
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			reason = fmt.Sprintf("command timed out after %s", timeout)
+		case context.Canceled:
+			reason = "command cancelled"
+		}
+		msg := reason
+		if res.Killed != "" {
+			msg += "; " + res.Killed
+		}
+		if res.Restarted {
+			msg += "; the shell was restarted and environment changes were lost"
+		}
+		if res.Output != "" {
+			msg += "\n\nOutput before it was killed:\n" + res.Output
+		}
+		return Result{Output: msg, IsError: true}, nil
+	}
+
+	output := res.Output
+	if res.Restarted {
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		output += fmt.Sprintf("(shell exited with status %d; a fresh shell will be started in %s)", res.ExitCode, t.Shell.Dir())
+	}
+
+	if res.ExitCode != 0 {
+		if output == "" {
+			output = fmt.Sprintf("exit status %d", res.ExitCode)
+		}
+		return Result{Output: t.annotateSandboxError(output), IsError: true}, nil
+	}
+
+	if output == "" {
+		output = "(no output)"
+	}
+	return Result{Output: output}, nil
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"github.com/zhubert/milo/internal/sandbox"
 )
 
 func TestBashToolExecute(t *testing.T) {
@@ -217,3 +219,24 @@ func TestStripCDToWorkDir(t *testing.T) {
 		})
 	}
 }
+
+func TestBashToolAnnotateSandboxError(t *testing.T) {
+	t.Parallel()
+
+	sb, err := sandbox.New(t.TempDir(), sandbox.Config{Network: true})
+	if err != nil {
+		t.Skip(err)
+	}
+
+	bashTool := &BashTool{Sandbox: sb}
+	got := bashTool.annotateSandboxError("touch: /etc/x: Permission denied")
+	if !strings.Contains(got, "[sandbox]") {
+		t.Errorf("expected sandbox note, got %q", got)
+	}
+	if got := bashTool.annotateSandboxError("exit status 1"); strings.Contains(got, "[sandbox]") {
+		t.Errorf("unexpected sandbox note for unrelated failure: %q", got)
+	}
+	if got := (&BashTool{}).annotateSandboxError("Permission denied"); strings.Contains(got, "[sandbox]") {
+		t.Errorf("unexpected sandbox note without a sandbox: %q", got)
+	}
+}
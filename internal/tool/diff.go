@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // DiffTool compares two files or a file against provided content.
@@ -27,6 +29,18 @@ type diffInput struct {
 
 func (t *DiffTool) Name() string { return "diff" }
 
+// PermissionSubjects reports the files compared.
+func (t *DiffTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in diffInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil
+	}
+	return []permission.Subject{
+		{Kind: permission.SubjectPath, Value: in.FilePath1},
+		{Kind: permission.SubjectPath, Value: in.FilePath2},
+	}
+}
+
 func (t *DiffTool) Description() string {
 	return "Compare two files or compare a file against provided content. " +
 		"Returns a unified diff showing the differences. " +
@@ -0,0 +1,124 @@
+package tool
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// secretEnvPatterns match the names of variables that commonly hold
+// credentials. Matching is case-insensitive.
+var secretEnvPatterns = []string{
+	"*TOKEN*",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*CREDENTIAL*",
+	"*API_KEY*",
+	"*APIKEY*",
+	"*PRIVATE_KEY*",
+	"*ACCESS_KEY*",
+	"*_KEY",
+	"*_PAT",
+	"*_AUTH",
+	"*_DSN",
+	"DATABASE_URL",
+}
+
+// EnvPolicy controls which of milo's environment variables are passed to
+// bash commands. By default everything is passed except variables that
+// look like secrets.
+type EnvPolicy struct {
+	// Allow switches to allowlist mode when non-empty: only variables whose
+	// names match one of these globs are passed. Variables matched here are
+	// passed even if they look like secrets.
+	Allow []string `yaml:"allow,omitempty"`
+	// Deny lists extra name globs to strip. Deny wins over Allow.
+	Deny []string `yaml:"deny,omitempty"`
+	// KeepSecrets turns off stripping of secret-looking variables.
+	KeepSecrets bool `yaml:"keep_secrets,omitempty"`
+	// Set adds or overrides variables. Values may reference milo's own
+	// environment with $VAR.
+	Set map[string]string `yaml:"set,omitempty"`
+}
+
+// ScrubsSecrets reports whether secret-looking variables are stripped.
+func (p EnvPolicy) ScrubsSecrets() bool {
+	return !p.KeepSecrets
+}
+
+// Apply filters environ (in os.Environ form) through the policy and returns
+// the resulting environment along with the names of stripped variables.
+func (p EnvPolicy) Apply(environ []string) (env []string, stripped []string) {
+	lookup := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		lookup[name] = value
+		if p.passes(name) {
+			env = append(env, kv)
+		} else {
+			stripped = append(stripped, name)
+		}
+	}
+
+	names := make([]string, 0, len(p.Set))
+	for name := range p.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := os.Expand(p.Set[name], func(key string) string { return lookup[key] })
+		env = setEnv(env, name, value)
+	}
+	return env, stripped
+}
+
+// LeaksStripped reports whether value refers with $VAR to a variable the
+// policy strips, which setting it would pass on under another name.
+func (p EnvPolicy) LeaksStripped(value string) bool {
+	leaks := false
+	os.Expand(value, func(key string) string {
+		if !p.passes(key) {
+			leaks = true
+		}
+		return ""
+	})
+	return leaks
+}
+
+// passes reports whether the variable called name is kept.
+func (p EnvPolicy) passes(name string) bool {
+	if matchEnvName(p.Deny, name) {
+		return false
+	}
+	if matchEnvName(p.Allow, name) {
+		return true
+	}
+	if len(p.Allow) > 0 {
+		return false
+	}
+	return p.KeepSecrets || !matchEnvName(secretEnvPatterns, name)
+}
+
+// matchEnvName reports whether name matches any of the globs, ignoring case.
+func matchEnvName(patterns []string, name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setEnv replaces or appends name=value in env.
+func setEnv(env []string, name, value string) []string {
+	for i, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			env[i] = name + "=" + value
+			return env
+		}
+	}
+	return append(env, name+"="+value)
+}
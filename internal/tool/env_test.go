@@ -0,0 +1,88 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvPolicyApply(t *testing.T) {
+	t.Parallel()
+
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/me",
+		"ANTHROPIC_API_KEY=sk-ant-123",
+		"GITHUB_TOKEN=ghp_abc",
+		"aws_secret_access_key=xyz",
+		"SSH_AUTH_SOCK=/tmp/agent",
+		"DEPLOY_KEY=abc",
+	}
+
+	tests := []struct {
+		name     string
+		policy   EnvPolicy
+		want     []string
+		stripped []string
+	}{
+		{
+			name:     "default strips secrets",
+			want:     []string{"PATH=/usr/bin", "HOME=/home/me", "SSH_AUTH_SOCK=/tmp/agent"},
+			stripped: []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN", "aws_secret_access_key", "DEPLOY_KEY"},
+		},
+		{
+			name:   "deny adds patterns",
+			policy: EnvPolicy{Deny: []string{"SSH_*"}},
+			want:   []string{"PATH=/usr/bin", "HOME=/home/me"},
+		},
+		{
+			name:   "allowlist passes listed secrets",
+			policy: EnvPolicy{Allow: []string{"PATH", "GITHUB_*"}},
+			want:   []string{"PATH=/usr/bin", "GITHUB_TOKEN=ghp_abc"},
+		},
+		{
+			name:   "keep secrets",
+			policy: EnvPolicy{KeepSecrets: true, Deny: []string{"ANTHROPIC_*"}},
+			want: []string{
+				"PATH=/usr/bin", "HOME=/home/me", "GITHUB_TOKEN=ghp_abc",
+				"aws_secret_access_key=xyz", "SSH_AUTH_SOCK=/tmp/agent", "DEPLOY_KEY=abc",
+			},
+		},
+		{
+			name:   "set expands and overrides",
+			policy: EnvPolicy{Allow: []string{"PATH"}, Set: map[string]string{"PATH": "/opt/bin:$PATH", "GOFLAGS": "-mod=mod"}},
+			want:   []string{"PATH=/opt/bin:/usr/bin", "GOFLAGS=-mod=mod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env, stripped := tt.policy.Apply(environ)
+			if !slices.Equal(env, tt.want) {
+				t.Errorf("env = %v, want %v", env, tt.want)
+			}
+			if tt.stripped != nil && !slices.Equal(stripped, tt.stripped) {
+				t.Errorf("stripped = %v, want %v", stripped, tt.stripped)
+			}
+		})
+	}
+}
+
+func TestBashToolEnv(t *testing.T) {
+	t.Parallel()
+
+	env, _ := EnvPolicy{}.Apply([]string{"PATH=/usr/bin:/bin", "ANTHROPIC_API_KEY=sk-ant-123"})
+	bashTool := &BashTool{Env: env}
+
+	input, _ := json.Marshal(bashInput{Command: "echo key=${ANTHROPIC_API_KEY:-unset}"})
+	result, err := bashTool.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(result.Output) != "key=unset" {
+		t.Errorf("expected key to be scrubbed, got %q", result.Output)
+	}
+}
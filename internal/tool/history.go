@@ -129,6 +129,18 @@ func (h *FileHistory) PopMostRecent() *FileChange {
 	return &change
 }
 
+// SetChanges replaces the history with changes, oldest first, such as
+// those saved with a session being resumed.
+func (h *FileHistory) SetChanges(changes []FileChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.changes = append(make([]FileChange, 0, len(changes)), changes...)
+	if len(h.changes) > h.maxSize {
+		h.changes = h.changes[len(h.changes)-h.maxSize:]
+	}
+}
+
 // Clear removes all recorded changes.
 func (h *FileHistory) Clear() {
 	h.mu.Lock()
@@ -353,6 +353,27 @@ func TestClear(t *testing.T) {
 	}
 }
 
+func TestSetChanges(t *testing.T) {
+	t.Parallel()
+
+	h := NewFileHistory(2)
+	h.SetChanges([]FileChange{
+		{FilePath: "/a", Description: "oldest"},
+		{FilePath: "/b", Description: "middle"},
+		{FilePath: "/c", Description: "newest"},
+	})
+
+	if h.Len() != 2 {
+		t.Fatalf("expected 2 changes after trimming, got %d", h.Len())
+	}
+	if c := h.PopMostRecent(); c == nil || c.Description != "newest" {
+		t.Errorf("expected newest change on top, got %+v", c)
+	}
+	if c := h.PopMostRecent(); c == nil || c.Description != "middle" {
+		t.Errorf("expected middle change next, got %+v", c)
+	}
+}
+
 func TestLen(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,126 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// JobTool inspects and controls background jobs started by the bash tool.
+type JobTool struct {
+	Jobs *JobManager
+}
+
+type jobInput struct {
+	Operation string `json:"operation"`
+	ID        string `json:"id"`
+}
+
+// IsParallelSafe returns false since kill changes job state.
+func (t *JobTool) IsParallelSafe() bool { return false }
+
+func (t *JobTool) Name() string { return "job" }
+
+func (t *JobTool) Description() string {
+	return `Inspect and control background jobs started with bash (background: true).
+
+Operations:
+- output: Return output the job produced since the last poll, plus its status
+- list: Show all jobs with their status
+- kill: Stop a running job and every process it started
+
+Use this to check on dev servers, watchers or long builds without blocking.`
+}
+
+func (t *JobTool) InputSchema() anthropic.ToolInputSchemaParam {
+	return anthropic.ToolInputSchemaParam{
+		Properties: map[string]any{
+			"operation": map[string]any{
+				"type":        "string",
+				"enum":        []string{"output", "list", "kill"},
+				"description": "The job operation to perform",
+			},
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Job ID returned when the job was started (required for output and kill)",
+			},
+		},
+		Required: []string{"operation"},
+	}
+}
+
+func (t *JobTool) Execute(_ context.Context, input json.RawMessage) (Result, error) {
+	var in jobInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return Result{}, fmt.Errorf("parsing job input: %w", err)
+	}
+
+	if t.Jobs == nil {
+		return Result{Output: "background jobs are not available", IsError: true}, nil
+	}
+
+	switch in.Operation {
+	case "list":
+		return Result{Output: FormatJobList(t.Jobs.List())}, nil
+	case "output":
+		if in.ID == "" {
+			return Result{Output: "id is required for output", IsError: true}, nil
+		}
+		out, info, err := t.Jobs.ReadNew(in.ID)
+		if err != nil {
+			return jobErrorResult(err), nil
+		}
+		if out == "" {
+			out = "(no new output)"
+		}
+		return Result{Output: fmt.Sprintf("[%s] %s\n%s", info.ID, describeJobStatus(info), out)}, nil
+	case "kill":
+		if in.ID == "" {
+			return Result{Output: "id is required for kill", IsError: true}, nil
+		}
+		if err := t.Jobs.Kill(in.ID); err != nil {
+			return jobErrorResult(err), nil
+		}
+		return Result{Output: fmt.Sprintf("killed %s", in.ID)}, nil
+	default:
+		return Result{Output: fmt.Sprintf("unsupported job operation: %s", in.Operation), IsError: true}, nil
+	}
+}
+
+func jobErrorResult(err error) Result {
+	if errors.Is(err, ErrJobNotFound) {
+		return Result{Output: err.Error() + " (use operation 'list' to see jobs)", IsError: true}
+	}
+	return Result{Output: err.Error(), IsError: true}
+}
+
+// FormatJobList renders jobs as a plain-text table.
+func FormatJobList(jobs []JobInfo) string {
+	if len(jobs) == 0 {
+		return "No background jobs."
+	}
+
+	var b strings.Builder
+	for _, info := range jobs {
+		fmt.Fprintf(&b, "%-8s %-18s pid %-7d %s\n", info.ID, describeJobStatus(info), info.PID, info.Command)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// describeJobStatus returns a short human-readable status such as
+// "running 12s" or "exited (1)".
+func describeJobStatus(info JobInfo) string {
+	switch info.Status {
+	case JobRunning:
+		return fmt.Sprintf("running %s", time.Since(info.StartedAt).Round(time.Second))
+	case JobExited:
+		return fmt.Sprintf("exited (%d)", info.ExitCode)
+	default:
+		return string(info.Status)
+	}
+}
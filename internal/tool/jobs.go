@@ -0,0 +1,271 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhubert/milo/internal/sandbox"
+)
+
+// maxJobOutput is the maximum number of bytes of output retained per job.
+// When a job produces more, the oldest output is discarded.
+const maxJobOutput = 1 << 20
+
+// jobKillGrace is how long a job gets to exit after SIGTERM before SIGKILL.
+const jobKillGrace = 2 * time.Second
+
+// JobStatus describes the lifecycle state of a background job.
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running"
+	JobExited  JobStatus = "exited"
+	JobKilled  JobStatus = "killed"
+)
+
+// ErrJobNotFound is returned when a job ID does not match any known job.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobInfo is a snapshot of a background job's state.
+type JobInfo struct {
+	ID        string
+	Command   string
+	PID       int
+	Status    JobStatus
+	ExitCode  int
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// job is a single background command and its captured output.
+type job struct {
+	mu        sync.Mutex
+	id        string
+	command   string
+	cmd       *exec.Cmd
+	output    []byte
+	dropped   int // bytes discarded from the front of output
+	readPos   int // absolute offset of the next unread byte
+	status    JobStatus
+	exitCode  int
+	startedAt time.Time
+	endedAt   time.Time
+	done      chan struct{}
+}
+
+// Write appends process output, discarding the oldest bytes past maxJobOutput.
+func (j *job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.output = append(j.output, p...)
+	if over := len(j.output) - maxJobOutput; over > 0 {
+		j.output = j.output[over:]
+		j.dropped += over
+	}
+	return len(p), nil
+}
+
+func (j *job) info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := JobInfo{
+		ID:        j.id,
+		Command:   j.command,
+		Status:    j.status,
+		ExitCode:  j.exitCode,
+		StartedAt: j.startedAt,
+		EndedAt:   j.endedAt,
+	}
+	if j.cmd.Process != nil {
+		info.PID = j.cmd.Process.Pid
+	}
+	return info
+}
+
+// JobManager runs shell commands in the background and tracks their output
+// so it can be polled incrementally.
+type JobManager struct {
+	// Sandbox, if set, confines every job started afterwards.
+	Sandbox *sandbox.Sandbox
+	// Limits applies rlimits to every job started afterwards.
+	Limits BashLimits
+	// Env is the environment for jobs; nil inherits milo's.
+	Env []string
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	nextID int
+}
+
+// NewJobManager creates an empty job manager.
+func NewJobManager() *JobManager {
+	return &JobManager{
+		jobs: make(map[string]*job),
+	}
+}
+
+// Start launches command with bash in workDir and returns immediately.
+// The command runs in its own process group so Kill can stop everything it spawns.
+func (m *JobManager) Start(command, workDir string) (JobInfo, error) {
+	cmd := exec.Command("bash", "-c", m.Limits.ulimitPrefix()+command)
+	if workDir != "" {
+		cmd.Dir = workDir
+	}
+	cmd.Env = m.Env
+	setProcessGroup(cmd)
+
+	m.mu.Lock()
+	m.nextID++
+	j := &job{
+		id:      fmt.Sprintf("job-%d", m.nextID),
+		command: command,
+		cmd:     cmd,
+		status:  JobRunning,
+		done:    make(chan struct{}),
+	}
+	m.mu.Unlock()
+
+	cmd.Stdin = nil
+	cmd.Stdout = j
+	cmd.Stderr = j
+
+	if err := startCommand(cmd, m.Sandbox); err != nil {
+		return JobInfo{}, fmt.Errorf("starting job: %w", err)
+	}
+	j.startedAt = time.Now()
+
+	m.mu.Lock()
+	m.jobs[j.id] = j
+	m.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+
+		j.mu.Lock()
+		j.endedAt = time.Now()
+		if j.status == JobRunning {
+			j.status = JobExited
+		}
+		j.exitCode = cmd.ProcessState.ExitCode()
+		if err != nil && j.exitCode == 0 {
+			j.exitCode = -1
+		}
+		j.mu.Unlock()
+		close(j.done)
+	}()
+
+	return j.info(), nil
+}
+
+// ReadNew returns the output produced by a job since the previous call,
+// together with the job's current state.
+func (m *JobManager) ReadNew(id string) (string, JobInfo, error) {
+	j := m.lookup(id)
+	if j == nil {
+		return "", JobInfo{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	j.mu.Lock()
+	start := j.readPos - j.dropped
+	var skipped int
+	if start < 0 {
+		skipped = -start
+		start = 0
+	}
+	out := string(j.output[start:])
+	j.readPos = j.dropped + len(j.output)
+	j.mu.Unlock()
+
+	if skipped > 0 {
+		out = fmt.Sprintf("[%d bytes of earlier output discarded]\n", skipped) + out
+	}
+	return out, j.info(), nil
+}
+
+// List returns a snapshot of all jobs ordered by start time.
+func (m *JobManager) List() []JobInfo {
+	m.mu.Lock()
+	jobs := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+
+	infos := make([]JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		infos = append(infos, j.info())
+	}
+	sort.Slice(infos, func(a, b int) bool {
+		return infos[a].StartedAt.Before(infos[b].StartedAt)
+	})
+	return infos
+}
+
+// Running returns the number of jobs that have not yet exited.
+func (m *JobManager) Running() int {
+	count := 0
+	for _, info := range m.List() {
+		if info.Status == JobRunning {
+			count++
+		}
+	}
+	return count
+}
+
+// Kill stops a running job and its whole process group. It sends SIGTERM,
+// then SIGKILL if the job has not exited after a short grace period.
+// Killing a job that has already exited is not an error.
+func (m *JobManager) Kill(id string) error {
+	j := m.lookup(id)
+	if j == nil {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	j.mu.Lock()
+	if j.status != JobRunning {
+		j.mu.Unlock()
+		return nil
+	}
+	j.status = JobKilled
+	pid := j.cmd.Process.Pid
+	j.mu.Unlock()
+
+	terminateProcessGroup(pid)
+	select {
+	case <-j.done:
+		return nil
+	case <-time.After(jobKillGrace):
+	}
+
+	if _, err := killProcessGroup(pid); err != nil {
+		return fmt.Errorf("killing job %s: %w", id, err)
+	}
+	<-j.done
+	return nil
+}
+
+// Close kills all running jobs. It is called when milo exits.
+func (m *JobManager) Close() error {
+	var errs []error
+	for _, info := range m.List() {
+		if info.Status != JobRunning {
+			continue
+		}
+		if err := m.Kill(info.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *JobManager) lookup(id string) *job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
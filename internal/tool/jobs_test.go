@@ -0,0 +1,213 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForJob polls until the job leaves the running state or the deadline passes.
+func waitForJob(t *testing.T, m *JobManager, id string) JobInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, info := range m.List() {
+			if info.ID == id && info.Status != JobRunning {
+				return info
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return JobInfo{}
+}
+
+func TestJobManager_StartAndReadNew(t *testing.T) {
+	t.Parallel()
+
+	m := NewJobManager()
+	info, err := m.Start("echo first; echo second >&2", t.TempDir())
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if info.ID == "" || info.PID == 0 {
+		t.Fatalf("expected ID and PID, got %+v", info)
+	}
+
+	done := waitForJob(t, m, info.ID)
+	if done.Status != JobExited || done.ExitCode != 0 {
+		t.Errorf("expected exited (0), got %s (%d)", done.Status, done.ExitCode)
+	}
+
+	out, _, err := m.ReadNew(info.ID)
+	if err != nil {
+		t.Fatalf("ReadNew: %v", err)
+	}
+	if !strings.Contains(out, "first") || !strings.Contains(out, "second") {
+		t.Errorf("expected stdout and stderr, got %q", out)
+	}
+
+	// A second read returns only new output, of which there is none.
+	out, _, err = m.ReadNew(info.ID)
+	if err != nil {
+		t.Fatalf("ReadNew: %v", err)
+	}
+	if out != "" {
+		t.Errorf("expected no new output, got %q", out)
+	}
+}
+
+func TestJobManager_ExitCode(t *testing.T) {
+	t.Parallel()
+
+	m := NewJobManager()
+	info, err := m.Start("exit 3", "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	done := waitForJob(t, m, info.ID)
+	if done.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", done.ExitCode)
+	}
+}
+
+func TestJobManager_Kill(t *testing.T) {
+	t.Parallel()
+
+	m := NewJobManager()
+	info, err := m.Start("sleep 30 & wait", "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if m.Running() != 1 {
+		t.Fatalf("expected 1 running job, got %d", m.Running())
+	}
+
+	if err := m.Kill(info.ID); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+
+	done := waitForJob(t, m, info.ID)
+	if done.Status != JobKilled {
+		t.Errorf("expected killed, got %s", done.Status)
+	}
+
+	// Killing an exited job is a no-op.
+	if err := m.Kill(info.ID); err != nil {
+		t.Errorf("second Kill: %v", err)
+	}
+}
+
+func TestJobManager_UnknownJob(t *testing.T) {
+	t.Parallel()
+
+	m := NewJobManager()
+	if _, _, err := m.ReadNew("job-99"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("ReadNew: expected ErrJobNotFound, got %v", err)
+	}
+	if err := m.Kill("job-99"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Kill: expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobManager_Close(t *testing.T) {
+	t.Parallel()
+
+	m := NewJobManager()
+	for range 2 {
+		if _, err := m.Start("sleep 30", ""); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if m.Running() != 0 {
+		t.Errorf("expected no running jobs after Close, got %d", m.Running())
+	}
+}
+
+func TestJob_OutputCap(t *testing.T) {
+	t.Parallel()
+
+	j := &job{}
+	chunk := strings.Repeat("x", maxJobOutput/2)
+	for range 3 {
+		if _, err := j.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(j.output) != maxJobOutput {
+		t.Errorf("expected output capped at %d, got %d", maxJobOutput, len(j.output))
+	}
+	if j.dropped != maxJobOutput/2 {
+		t.Errorf("expected %d dropped bytes, got %d", maxJobOutput/2, j.dropped)
+	}
+}
+
+func TestBashTool_Background(t *testing.T) {
+	t.Parallel()
+
+	jobs := NewJobManager()
+	t.Cleanup(func() { _ = jobs.Close() })
+
+	bashTool := &BashTool{Jobs: jobs}
+	jobTool := &JobTool{Jobs: jobs}
+
+	input, _ := json.Marshal(bashInput{Command: "echo started", Background: true})
+	result, err := bashTool.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Output)
+	}
+	if !strings.Contains(result.Output, "job-1") {
+		t.Fatalf("expected job ID in output, got %q", result.Output)
+	}
+
+	waitForJob(t, jobs, "job-1")
+
+	result, err = jobTool.Execute(context.Background(), json.RawMessage(`{"operation":"output","id":"job-1"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError || !strings.Contains(result.Output, "started") {
+		t.Errorf("expected job output, got %+v", result)
+	}
+
+	result, err = jobTool.Execute(context.Background(), json.RawMessage(`{"operation":"list"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result.Output, "echo started") {
+		t.Errorf("expected job in list, got %q", result.Output)
+	}
+
+	result, err = jobTool.Execute(context.Background(), json.RawMessage(`{"operation":"kill","id":"job-7"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("expected error for unknown job, got %q", result.Output)
+	}
+}
+
+func TestBashTool_BackgroundUnavailable(t *testing.T) {
+	t.Parallel()
+
+	bashTool := &BashTool{}
+	input, _ := json.Marshal(bashInput{Command: "echo hi", Background: true})
+	result, err := bashTool.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.IsError {
+		t.Errorf("expected error without a job manager, got %q", result.Output)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package tool
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing where process groups are unavailable; only
+// the command itself can be stopped.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the process pgid. Without signals there is no
+// graceful stop, and processes it started are not reached.
+func signalProcessGroup(pgid int, kill bool) error {
+	p, err := os.FindProcess(pgid)
+	if err != nil {
+		return nil
+	}
+	if err := p.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
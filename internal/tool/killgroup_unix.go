@@ -0,0 +1,29 @@
+//go:build unix
+
+package tool
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in its own process group, so everything it
+// spawns can be stopped together.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends SIGKILL, or SIGTERM unless kill is set, to the
+// process group led by pgid. A group that has already exited is not an
+// error.
+func signalProcessGroup(pgid int, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	if err := syscall.Kill(-pgid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
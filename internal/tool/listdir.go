@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 const maxListDirEntries = 1000
@@ -29,6 +31,22 @@ type listDirInput struct {
 
 func (t *ListDirTool) Name() string { return "list_dir" }
 
+// PermissionSubjects reports the directory listed.
+func (t *ListDirTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in listDirInput
+	if len(input) > 0 && json.Unmarshal(input, &in) != nil {
+		return nil
+	}
+	dir := t.WorkDir
+	if in.Path != "" {
+		dir = in.Path
+		if !filepath.IsAbs(dir) && t.WorkDir != "" {
+			dir = filepath.Join(t.WorkDir, dir)
+		}
+	}
+	return []permission.Subject{{Kind: permission.SubjectPath, Value: dir}}
+}
+
 func (t *ListDirTool) Description() string {
 	return "List directory contents. Returns files and subdirectories with type indicators " +
 		"(/ suffix for directories). Results are sorted alphabetically. " +
@@ -12,6 +12,7 @@ import (
 	"github.com/anthropics/anthropic-sdk-go"
 
 	"github.com/zhubert/milo/internal/lsp"
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // LSPTool provides code navigation using language servers.
@@ -31,6 +32,15 @@ type lspInput struct {
 // Name returns the tool name.
 func (t *LSPTool) Name() string { return "lsp" }
 
+// PermissionSubjects reports the file queried, if any.
+func (t *LSPTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in lspInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil
+	}
+	return []permission.Subject{{Kind: permission.SubjectPath, Value: in.FilePath}}
+}
+
 // Description returns a description of the tool.
 func (t *LSPTool) Description() string {
 	return "Code navigation using language servers (gopls, typescript-language-server, rust-analyzer, etc.). " +
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // MoveTool moves or renames files and directories.
@@ -20,6 +22,18 @@ type moveInput struct {
 
 func (t *MoveTool) Name() string { return "move" }
 
+// PermissionSubjects reports both paths a move changes.
+func (t *MoveTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in moveInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil
+	}
+	return []permission.Subject{
+		{Kind: permission.SubjectPath, Value: in.Source, Write: true},
+		{Kind: permission.SubjectPath, Value: in.Destination, Write: true},
+	}
+}
+
 func (t *MoveTool) Description() string {
 	return "Move or rename files and directories. Creates parent directories for the destination if they don't exist. " +
 		"Can be used to rename files/directories (same parent directory) or move them to a different location."
@@ -10,6 +10,8 @@ import (
 	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // MultiReadTool reads multiple files in a single call.
@@ -31,6 +33,19 @@ type multiReadInput struct {
 
 func (t *MultiReadTool) Name() string { return "multi_read" }
 
+// PermissionSubjects reports every file read.
+func (t *MultiReadTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in multiReadInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil
+	}
+	subjects := make([]permission.Subject, 0, len(in.Files))
+	for _, f := range in.Files {
+		subjects = append(subjects, permission.Subject{Kind: permission.SubjectPath, Value: f.FilePath})
+	}
+	return subjects
+}
+
 func (t *MultiReadTool) Description() string {
 	return "Read multiple files in a single call. ALWAYS use this instead of multiple read calls when you need to read 2+ files. " +
 		"Each file can have optional offset (1-based line number) and limit (number of lines)."
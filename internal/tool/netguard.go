@@ -0,0 +1,188 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultMaxRedirects caps the redirects web_fetch follows when no limit
+// is configured.
+const defaultMaxRedirects = 5
+
+// WebFetchConfig controls which addresses web_fetch may connect to and how
+// many redirects it follows.
+type WebFetchConfig struct {
+	// AllowPrivate lists hosts, IPs and CIDR ranges web_fetch may reach even
+	// though they are private, loopback or link-local, such as
+	// "localhost" or "10.0.0.0/8". Only the global config can add to it.
+	AllowPrivate []string `yaml:"allow_private"`
+	// MaxRedirects caps the redirects followed; 0 means the default of 5.
+	MaxRedirects int `yaml:"max_redirects"`
+}
+
+// maxRedirects returns the redirect cap.
+func (c WebFetchConfig) maxRedirects() int {
+	if c.MaxRedirects > 0 {
+		return c.MaxRedirects
+	}
+	return defaultMaxRedirects
+}
+
+// blockedNets are ranges outside the checks net.IP provides that still
+// don't belong to the public internet.
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// internalIP reports whether ip is loopback, private, link-local (which
+// includes cloud metadata endpoints like 169.254.169.254) or otherwise not
+// a public internet address.
+func internalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressGuard decides which addresses web_fetch may connect to.
+type addressGuard struct {
+	hosts map[string]bool
+	nets  []*net.IPNet
+}
+
+// newAddressGuard builds a guard from an allow_private list.
+func newAddressGuard(allow []string) (*addressGuard, error) {
+	g := &addressGuard{hosts: make(map[string]bool)}
+	for _, entry := range allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case strings.Contains(entry, "/"):
+			_, n, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("web_fetch allow_private: %w", err)
+			}
+			g.nets = append(g.nets, n)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			g.nets = append(g.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		case entry != "":
+			g.hosts[entry] = true
+		}
+	}
+	return g, nil
+}
+
+// allowed reports whether host, resolved to ip, may be reached.
+func (g *addressGuard) allowed(host string, ip net.IP) bool {
+	if !internalIP(ip) || g.hosts[strings.ToLower(host)] {
+		return true
+	}
+	for _, n := range g.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialContext resolves the host in addr, refuses it if any address it
+// resolves to is internal and not allowed, and connects to the checked
+// address, so a second DNS answer can't swap in another one. Every
+// connection goes through it, including those for redirects.
+func (g *addressGuard) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if !g.allowed(host, ip) {
+				return nil, fmt.Errorf("%s resolves to %s, a private, loopback or link-local address; "+
+					"add it to web_fetch.allow_private in ~/.milo/config.yaml to allow it", host, ip)
+			}
+		}
+		dialErr := fmt.Errorf("no addresses found for %s", host)
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+}
+
+// proxyNote explains a failed fetch when the environment sets a proxy for
+// it, which web_fetch doesn't use, and is empty otherwise.
+func proxyNote(req *http.Request) string {
+	if proxy, err := http.ProxyFromEnvironment(req); err != nil || proxy == nil {
+		return ""
+	}
+	return " (web_fetch connects directly and ignores HTTP_PROXY and HTTPS_PROXY, " +
+		"since through a proxy it can't tell which addresses it reaches)"
+}
+
+// newGuardedClient returns an HTTP client for web_fetch that only reaches
+// allowed addresses and follows at most cfg's redirect cap. A redirect to
+// another host is only followed if checkRedirect, when set, accepts it.
+func newGuardedClient(cfg WebFetchConfig, timeout time.Duration, checkRedirect func(url string) error) (*http.Client, error) {
+	guard, err := newAddressGuard(cfg.AllowPrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connect directly: through a proxy the guard would only see the
+	// proxy's address, not where the request goes.
+	transport.Proxy = nil
+	transport.DialContext = guard.dialContext(&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second})
+
+	limit := cfg.maxRedirects()
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > limit {
+				return fmt.Errorf("stopped after %d redirects", limit)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to a non-HTTP URL")
+			}
+			if checkRedirect != nil && !strings.EqualFold(req.URL.Hostname(), via[len(via)-1].URL.Hostname()) {
+				return checkRedirect(req.URL.String())
+			}
+			return nil
+		},
+	}, nil
+}
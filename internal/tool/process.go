@@ -0,0 +1,103 @@
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// defaultMaxOutputBytes caps captured bash output when no limit is configured.
+const defaultMaxOutputBytes = 1 << 20
+
+// BashLimits caps the resources a bash command may use. Zero values mean
+// no limit, except MaxOutputBytes which falls back to a 1 MiB default.
+type BashLimits struct {
+	CPUSeconds     int `yaml:"cpu_seconds"`      // RLIMIT_CPU per process
+	MemoryMB       int `yaml:"memory_mb"`        // Virtual memory per process
+	OpenFiles      int `yaml:"open_files"`       // RLIMIT_NOFILE
+	MaxOutputBytes int `yaml:"max_output_bytes"` // Captured stdout+stderr
+}
+
+// ulimitPrefix returns bash ulimit commands that apply the limits to the
+// shell and everything it starts, or "" when no limits are set.
+func (l BashLimits) ulimitPrefix() string {
+	var parts []string
+	if l.CPUSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("ulimit -t %d", l.CPUSeconds))
+	}
+	if l.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("ulimit -v %d", l.MemoryMB*1024))
+	}
+	if l.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("ulimit -n %d", l.OpenFiles))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, " && ") + " || exit 125\n"
+}
+
+// maxOutput returns the output cap in bytes.
+func (l BashLimits) maxOutput() int {
+	if l.MaxOutputBytes > 0 {
+		return l.MaxOutputBytes
+	}
+	return defaultMaxOutputBytes
+}
+
+// cappedBuffer keeps the first limit bytes written to it and counts the rest.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.buf.Len()
+	switch {
+	case room <= 0:
+		b.dropped += len(p)
+	case len(p) > room:
+		b.buf.Write(p[:room])
+		b.dropped += len(p) - room
+	default:
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// truncateOutput shortens s to limit bytes, noting how much was dropped
+// in addition to the already dropped bytes.
+func truncateOutput(s string, limit, dropped int) string {
+	if len(s) > limit {
+		dropped += len(s) - limit
+		s = s[:limit]
+	}
+	if dropped == 0 {
+		return s
+	}
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s + fmt.Sprintf("[output truncated: %d bytes omitted]", dropped)
+}
+
+// terminateProcessGroup asks the process group led by pgid to exit.
+func terminateProcessGroup(pgid int) {
+	_ = signalProcessGroup(pgid, false)
+}
+
+// killProcessGroup kills the process group led by pgid and returns a
+// description of each process that was in it.
+func killProcessGroup(pgid int) ([]string, error) {
+	members := processGroupMembers(pgid)
+	return members, signalProcessGroup(pgid, true)
+}
+
+// describeKilled formats the result of killProcessGroup for a tool error.
+func describeKilled(pgid int, members []string) string {
+	if len(members) == 0 {
+		return fmt.Sprintf("killed process group %d", pgid)
+	}
+	return fmt.Sprintf("killed process group %d: %s", pgid, strings.Join(members, ", "))
+}
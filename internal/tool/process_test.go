@@ -0,0 +1,163 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBashLimitsUlimitPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		limits BashLimits
+		want   string
+	}{
+		{name: "no limits", limits: BashLimits{MaxOutputBytes: 10}, want: ""},
+		{name: "cpu only", limits: BashLimits{CPUSeconds: 5}, want: "ulimit -t 5 || exit 125\n"},
+		{
+			name:   "all limits",
+			limits: BashLimits{CPUSeconds: 5, MemoryMB: 2, OpenFiles: 64},
+			want:   "ulimit -t 5 && ulimit -v 2048 && ulimit -n 64 || exit 125\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.limits.ulimitPrefix(); got != tt.want {
+				t.Errorf("ulimitPrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := &cappedBuffer{limit: 5}
+	for _, s := range []string{"abc", "defg", "hi"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if b.buf.String() != "abcde" || b.dropped != 4 {
+		t.Errorf("got %q with %d dropped, want %q with 4", b.buf.String(), b.dropped, "abcde")
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		limit   int
+		dropped int
+		want    string
+	}{
+		{name: "under limit", s: "hello\n", limit: 10, want: "hello\n"},
+		{name: "over limit", s: "hello world", limit: 5, want: "hello\n[output truncated: 6 bytes omitted]"},
+		{name: "already dropped", s: "abc\n", limit: 10, dropped: 3, want: "abc\n[output truncated: 3 bytes omitted]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := truncateOutput(tt.s, tt.limit, tt.dropped); got != tt.want {
+				t.Errorf("truncateOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBashToolLimits(t *testing.T) {
+	t.Parallel()
+
+	run := func(t *testing.T, bashTool *BashTool, in bashInput) Result {
+		t.Helper()
+		input, _ := json.Marshal(in)
+		result, err := bashTool.Execute(context.Background(), input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	t.Run("timeout kills process group", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+		// The backgrounded sleep keeps the output pipe open; only killing the
+		// whole group lets Execute return promptly.
+		result := run(t, &BashTool{}, bashInput{Command: "sleep 30 & echo started; sleep 30", Timeout: 200})
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Execute took %s, expected the group to be killed", elapsed)
+		}
+		if !result.IsError {
+			t.Fatal("expected IsError for timed-out command")
+		}
+		for _, want := range []string{"timed out", "killed process group", "started"} {
+			if !strings.Contains(result.Output, want) {
+				t.Errorf("output should contain %q, got: %s", want, result.Output)
+			}
+		}
+	})
+
+	t.Run("output cap", func(t *testing.T) {
+		t.Parallel()
+
+		result := run(t, &BashTool{Limits: BashLimits{MaxOutputBytes: 100}}, bashInput{Command: "head -c 1000 /dev/zero | tr '\\0' x"})
+		if !strings.Contains(result.Output, "[output truncated: 900 bytes omitted]") {
+			t.Errorf("expected truncation note, got: %s", result.Output)
+		}
+	})
+
+	t.Run("open files limit", func(t *testing.T) {
+		t.Parallel()
+
+		result := run(t, &BashTool{Limits: BashLimits{OpenFiles: 64}}, bashInput{Command: "ulimit -n"})
+		if strings.TrimSpace(result.Output) != "64" {
+			t.Errorf("ulimit -n = %q, want 64", result.Output)
+		}
+	})
+}
+
+func TestKillProcessGroup(t *testing.T) {
+	t.Parallel()
+
+	cmd := exec.Command("bash", "-c", "sleep 30 & wait")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting command: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	pgid := cmd.Process.Pid
+	if _, err := killProcessGroup(pgid); err != nil {
+		t.Fatalf("killProcessGroup() error: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process group still running after killProcessGroup()")
+	}
+	// The backgrounded sleep went with it, once its new parent reaps it.
+	deadline := time.Now().Add(5 * time.Second)
+	for members := processGroupMembers(pgid); len(members) != 0; members = processGroupMembers(pgid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("process group still has %v", members)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A group that has already gone is not an error.
+	if _, err := killProcessGroup(pgid); err != nil {
+		t.Errorf("killProcessGroup() of an exited group error: %v", err)
+	}
+}
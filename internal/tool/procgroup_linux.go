@@ -0,0 +1,56 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// processGroupMembers lists the processes in group pgid as "name (pid)",
+// read from /proc.
+func processGroupMembers(pgid int) []string {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil
+	}
+
+	type member struct {
+		pid  int
+		name string
+	}
+	var members []member
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // Process exited while we were scanning
+		}
+		// Format: pid (comm) state ppid pgrp ... where comm may contain spaces.
+		s := string(data)
+		lp, rp := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+		if lp < 0 || rp < lp {
+			continue
+		}
+		fields := strings.Fields(s[rp+1:])
+		if len(fields) < 3 {
+			continue
+		}
+		if pgrp, err := strconv.Atoi(fields[2]); err != nil || pgrp != pgid {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(s[:lp]))
+		if err != nil {
+			continue
+		}
+		members = append(members, member{pid: pid, name: s[lp+1 : rp]})
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].pid < members[j].pid })
+	result := make([]string, len(members))
+	for i, m := range members {
+		result[i] = fmt.Sprintf("%s (%d)", m.name, m.pid)
+	}
+	return result
+}
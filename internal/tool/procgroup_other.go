@@ -0,0 +1,9 @@
+//go:build !linux
+
+package tool
+
+// processGroupMembers returns nil where /proc is unavailable; callers fall
+// back to reporting the process group ID.
+func processGroupMembers(pgid int) []string {
+	return nil
+}
@@ -1,10 +1,13 @@
 package tool
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // Registry manages the set of tools available to the agent.
@@ -43,6 +46,17 @@ func (r *Registry) Lookup(name string) Tool {
 	return r.tools[name]
 }
 
+// PermissionSubjects returns the permission subjects of a call to the
+// named tool, and false if the tool doesn't report them. It can be passed
+// to permission.Checker.SetSubjects.
+func (r *Registry) PermissionSubjects(name string, input json.RawMessage) ([]permission.Subject, bool) {
+	s, ok := r.Lookup(name).(PermissionSubjecter)
+	if !ok {
+		return nil, false
+	}
+	return s.PermissionSubjects(input), true
+}
+
 // List returns all registered tools in registration order.
 func (r *Registry) List() []Tool {
 	r.mu.RLock()
@@ -3,9 +3,12 @@ package tool
 import (
 	"context"
 	"encoding/json"
+	"slices"
 	"testing"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // fakeTool is a minimal Tool implementation for testing.
@@ -121,3 +124,87 @@ func TestRegistryToolParams(t *testing.T) {
 		t.Errorf("expected second tool param name %q, got %q", "write", params[1].OfTool.Name)
 	}
 }
+
+func TestRegistryPermissionSubjects(t *testing.T) {
+	t.Parallel()
+
+	history := NewFileHistory(10)
+	if err := history.RecordChange("/p/last.go", "edit", "edited"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	for _, tool := range []Tool{
+		&MoveTool{}, &MultiReadTool{}, &DiffTool{}, &UndoTool{History: history},
+		&ListDirTool{WorkDir: "/p"}, &TreeTool{WorkDir: "/p"}, &LSPTool{WorkDir: "/p"},
+		&fakeTool{name: "plain"},
+	} {
+		if err := r.Register(tool); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := func(v string, write bool) permission.Subject {
+		return permission.Subject{Kind: permission.SubjectPath, Value: v, Write: write}
+	}
+	tests := []struct {
+		tool  string
+		input string
+		want  []permission.Subject
+	}{
+		{"move", `{"source":"/p/a","destination":"/q/b"}`, []permission.Subject{path("/p/a", true), path("/q/b", true)}},
+		{"multi_read", `{"files":[{"file_path":"/p/a"},{"file_path":"/etc/passwd"}]}`, []permission.Subject{path("/p/a", false), path("/etc/passwd", false)}},
+		{"diff", `{"file_path_1":"/p/a","file_path_2":"/p/b"}`, []permission.Subject{path("/p/a", false), path("/p/b", false)}},
+		{"undo", `{"file_path":"/p/x.go"}`, []permission.Subject{path("/p/x.go", true)}},
+		{"undo", `{}`, []permission.Subject{path("/p/last.go", true)}},
+		{"list_dir", `{}`, []permission.Subject{path("/p", false)}},
+		{"tree", `{"path":"sub"}`, []permission.Subject{path("/p/sub", false)}},
+		{"lsp", `{"operation":"hover","file_path":"/p/a.go"}`, []permission.Subject{path("/p/a.go", false)}},
+	}
+	for _, tt := range tests {
+		got, ok := r.PermissionSubjects(tt.tool, json.RawMessage(tt.input))
+		if !ok || !slices.Equal(got, tt.want) {
+			t.Errorf("PermissionSubjects(%s, %s) = %v, %v; want %v", tt.tool, tt.input, got, ok, tt.want)
+		}
+	}
+
+	for _, name := range []string{"plain", "missing"} {
+		if _, ok := r.PermissionSubjects(name, json.RawMessage(`{}`)); ok {
+			t.Errorf("PermissionSubjects(%s) reported subjects", name)
+		}
+	}
+}
+
+func TestRegistrySensitiveFilesAsk(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	for _, tool := range []Tool{&MoveTool{}, &MultiReadTool{}, &DiffTool{}} {
+		if err := r.Register(tool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	perms := permission.NewChecker()
+	perms.SetWorkDir(dir)
+	perms.SetSubjects(r.PermissionSubjects)
+	perms.AddRule(permission.Rule{Tool: "move", Pattern: "*", Action: permission.Allow})
+	perms.AddRule(permission.Rule{Tool: "diff", Pattern: "*", Action: permission.Allow})
+
+	tests := []struct {
+		tool  string
+		input string
+		want  permission.Action
+	}{
+		{"multi_read", `{"files":[{"file_path":"a.go"},{"file_path":"b.go"}]}`, permission.Allow},
+		{"multi_read", `{"files":[{"file_path":"a.go"},{"file_path":".env"}]}`, permission.Ask},
+		{"diff", `{"file_path_1":"a.go","file_path_2":"server.pem"}`, permission.Ask},
+		{"move", `{"source":"id_rsa","destination":"keys/id_rsa"}`, permission.Ask},
+		{"move", `{"source":"a.go","destination":"b.go"}`, permission.Allow},
+	}
+	for _, tt := range tests {
+		if d := perms.Decide(tt.tool, json.RawMessage(tt.input)); d.Action != tt.want {
+			t.Errorf("Decide(%s, %s) = %s (%s), want %s", tt.tool, tt.input, d.Action, d.Reason, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zhubert/milo/internal/sandbox"
+)
+
+// Shell is a long-lived bash process that runs commands one at a time,
+// so environment variables, sourced scripts and the working directory
+// carry over between calls. Output and exit status are delimited with a
+// random sentinel line printed after each command.
+type Shell struct {
+	// Sandbox, if set, confines the shell and everything run in it.
+	Sandbox *sandbox.Sandbox
+	// Limits applies rlimits to the shell and caps each command's output.
+	Limits BashLimits
+	// Env is the shell's initial environment; nil inherits milo's.
+	Env []string
+
+	mu       sync.Mutex
+	workDir  string // Directory the shell starts in and returns to on Reset
+	dir      string // Working directory after the most recent command
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	output   *os.File
+	lines    chan string
+	sentinel string
+}
+
+// ShellResult is the outcome of a command run in a persistent shell.
+type ShellResult struct {
+	Output   string
+	ExitCode int
+	// Restarted is true when the shell had to be killed or exited, so
+	// environment and directory changes from earlier commands are gone.
+	Restarted bool
+	// Killed describes the processes killed when the context ended first.
+	Killed string
+}
+
+// NewShell creates a persistent shell rooted at workDir. The bash process
+// is started lazily on the first Run.
+func NewShell(workDir string) *Shell {
+	return &Shell{workDir: workDir, dir: workDir}
+}
+
+// Dir returns the shell's current working directory.
+func (s *Shell) Dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+// Run executes command in the shell and waits for it to finish or for ctx
+// to be done. If ctx ends first the shell is killed and restarted on the
+// next call, and ctx.Err() is returned.
+func (s *Shell) Run(ctx context.Context, command string) (ShellResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return ShellResult{}, err
+		}
+	}
+
+	// The command is sourced from a file so multi-line input and quoting
+	// survive intact, with stdin detached so it can't consume our protocol.
+	script, err := os.CreateTemp("", "milo-cmd-*.sh")
+	if err != nil {
+		return ShellResult{}, fmt.Errorf("creating command file: %w", err)
+	}
+	defer func() { _ = os.Remove(script.Name()) }()
+	if _, err := script.WriteString(command + "\n"); err != nil {
+		_ = script.Close()
+		return ShellResult{}, fmt.Errorf("writing command file: %w", err)
+	}
+	if err := script.Close(); err != nil {
+		return ShellResult{}, fmt.Errorf("writing command file: %w", err)
+	}
+
+	line := fmt.Sprintf(". %s </dev/null\nprintf '\\n%s %%d %%s\\n' \"$?\" \"$PWD\"\n",
+		shellQuote(script.Name()), s.sentinel)
+	if _, err := io.WriteString(s.stdin, line); err != nil {
+		_ = s.kill()
+		return ShellResult{Restarted: true}, fmt.Errorf("writing to shell: %w", err)
+	}
+
+	out := &cappedBuffer{limit: s.Limits.maxOutput()}
+	output := func() string {
+		return truncateOutput(out.buf.String(), out.limit, out.dropped)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			pgid := s.cmd.Process.Pid
+			killed := describeKilled(pgid, s.kill())
+			return ShellResult{Output: output(), ExitCode: -1, Restarted: true, Killed: killed}, ctx.Err()
+
+		case l, ok := <-s.lines:
+			if !ok {
+				// The command ran exit (or killed the shell itself).
+				exitCode := -1
+				_ = s.cmd.Wait()
+				if s.cmd.ProcessState != nil {
+					exitCode = s.cmd.ProcessState.ExitCode()
+				}
+				_ = s.stdin.Close()
+				_ = s.output.Close()
+				s.cmd = nil
+				return ShellResult{Output: output(), ExitCode: exitCode, Restarted: true}, nil
+			}
+
+			if rest, found := strings.CutPrefix(l, s.sentinel+" "); found {
+				code, dir, _ := strings.Cut(strings.TrimSuffix(rest, "\n"), " ")
+				exitCode, _ := strconv.Atoi(code)
+				if dir != "" {
+					s.dir = dir
+				}
+				// Drop the newline printed ahead of the sentinel.
+				out.buf.Truncate(len(strings.TrimSuffix(out.buf.String(), "\n")))
+				return ShellResult{Output: output(), ExitCode: exitCode}, nil
+			}
+			_, _ = out.Write([]byte(l))
+		}
+	}
+}
+
+// Reset kills the shell, discarding its environment, and returns it to
+// the original working directory.
+func (s *Shell) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.kill()
+	s.dir = s.workDir
+}
+
+// Close kills the shell process.
+func (s *Shell) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.kill()
+	return nil
+}
+
+// start launches bash in the last known directory. Must be called with s.mu held.
+func (s *Shell) start() error {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("generating shell sentinel: %w", err)
+	}
+	s.sentinel = "__MILO_DONE_" + hex.EncodeToString(token) + "__"
+
+	cmd := exec.Command("bash", "--noprofile", "--norc")
+	cmd.Dir = s.dir
+	cmd.Env = s.Env
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("creating shell stdin: %w", err)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating shell output pipe: %w", err)
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := startCommand(cmd, s.Sandbox); err != nil {
+		_ = pr.Close()
+		_ = pw.Close()
+		return fmt.Errorf("starting shell: %w", err)
+	}
+	_ = pw.Close() // The child holds its own copy
+
+	if prefix := s.Limits.ulimitPrefix(); prefix != "" {
+		if _, err := io.WriteString(stdin, prefix); err != nil {
+			_, _ = killProcessGroup(cmd.Process.Pid)
+			_ = cmd.Wait()
+			_ = pr.Close()
+			return fmt.Errorf("applying shell limits: %w", err)
+		}
+	}
+
+	lines := make(chan string, 64)
+	go func() {
+		defer close(lines)
+		r := bufio.NewReader(pr)
+		for {
+			l, err := r.ReadString('\n')
+			if l != "" {
+				lines <- l
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.output = pr
+	s.lines = lines
+	return nil
+}
+
+// kill terminates the shell and everything it started, returning what was
+// killed. Must be called with s.mu held.
+func (s *Shell) kill() []string {
+	if s.cmd == nil {
+		return nil
+	}
+	_ = s.stdin.Close()
+	killed, _ := killProcessGroup(s.cmd.Process.Pid)
+	_ = s.cmd.Wait()
+	// Closing our end unblocks the reader even if an escaped grandchild
+	// still holds the pipe open.
+	_ = s.output.Close()
+	for range s.lines {
+	}
+	s.cmd = nil
+	return killed
+}
+
+// shellQuote wraps s in single quotes for safe use in a bash command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,214 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShell_PersistsEnvAndDir(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	sub := filepath.Join(workDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sh := NewShell(workDir)
+	t.Cleanup(func() { _ = sh.Close() })
+
+	ctx := context.Background()
+	if _, err := sh.Run(ctx, "export MILO_TEST_VAR=persisted && cd sub"); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := sh.Dir(); !strings.HasSuffix(got, "/sub") {
+		t.Errorf("Dir() = %q, want suffix /sub", got)
+	}
+
+	res, err := sh.Run(ctx, "echo $MILO_TEST_VAR; pwd")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(res.Output, "persisted") {
+		t.Errorf("expected env var to persist, got %q", res.Output)
+	}
+	if !strings.Contains(res.Output, "/sub") {
+		t.Errorf("expected cwd to persist, got %q", res.Output)
+	}
+}
+
+func TestShell_OutputAndExitCode(t *testing.T) {
+	t.Parallel()
+
+	sh := NewShell(t.TempDir())
+	t.Cleanup(func() { _ = sh.Close() })
+
+	tests := []struct {
+		name     string
+		command  string
+		output   string
+		exitCode int
+	}{
+		{name: "trailing newline", command: "echo hello", output: "hello\n"},
+		{name: "no trailing newline", command: "printf abc", output: "abc"},
+		{name: "stderr", command: "echo oops >&2", output: "oops\n"},
+		{name: "failure", command: "false", output: "", exitCode: 1},
+		{name: "multi-line", command: "echo one\necho 'two'", output: "one\ntwo\n"},
+		{name: "stdin detached", command: "cat", output: ""},
+	}
+
+	// Subtests share one shell, so they run sequentially.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := sh.Run(context.Background(), tt.command)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if res.Output != tt.output {
+				t.Errorf("output = %q, want %q", res.Output, tt.output)
+			}
+			if res.ExitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", res.ExitCode, tt.exitCode)
+			}
+		})
+	}
+}
+
+func TestShell_ExitRestarts(t *testing.T) {
+	t.Parallel()
+
+	sh := NewShell(t.TempDir())
+	t.Cleanup(func() { _ = sh.Close() })
+
+	ctx := context.Background()
+	if _, err := sh.Run(ctx, "export KEEP=1"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := sh.Run(ctx, "exit 4")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !res.Restarted || res.ExitCode != 4 {
+		t.Errorf("expected restart with exit code 4, got %+v", res)
+	}
+
+	res, err = sh.Run(ctx, "echo ${KEEP:-gone}")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.TrimSpace(res.Output) != "gone" {
+		t.Errorf("expected fresh environment, got %q", res.Output)
+	}
+}
+
+func TestShell_TimeoutKillsShell(t *testing.T) {
+	t.Parallel()
+
+	sh := NewShell(t.TempDir())
+	t.Cleanup(func() { _ = sh.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	res, err := sh.Run(ctx, "sleep 10")
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !res.Restarted {
+		t.Error("expected shell to be restarted after timeout")
+	}
+	if !strings.Contains(res.Killed, "sleep") {
+		t.Errorf("expected killed processes to include sleep, got %q", res.Killed)
+	}
+
+	// The shell is usable again afterwards.
+	res, err = sh.Run(context.Background(), "echo back")
+	if err != nil || strings.TrimSpace(res.Output) != "back" {
+		t.Errorf("expected shell to recover, got %q, %v", res.Output, err)
+	}
+}
+
+func TestShell_Reset(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	sh := NewShell(workDir)
+	t.Cleanup(func() { _ = sh.Close() })
+
+	if _, err := sh.Run(context.Background(), "cd /"); err != nil {
+		t.Fatal(err)
+	}
+	if sh.Dir() != "/" {
+		t.Fatalf("Dir() = %q, want /", sh.Dir())
+	}
+
+	sh.Reset()
+	if sh.Dir() != workDir {
+		t.Errorf("Dir() after Reset = %q, want %q", sh.Dir(), workDir)
+	}
+}
+
+func TestBashTool_PersistentShell(t *testing.T) {
+	t.Parallel()
+
+	workDir := t.TempDir()
+	sh := NewShell(workDir)
+	t.Cleanup(func() { _ = sh.Close() })
+	bashTool := &BashTool{WorkDir: workDir, Shell: sh}
+
+	run := func(command string) Result {
+		t.Helper()
+		input, _ := json.Marshal(bashInput{Command: command})
+		result, err := bashTool.Execute(context.Background(), input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	if result := run("cd /"); result.IsError {
+		t.Fatalf("unexpected tool error: %s", result.Output)
+	}
+	if bashTool.CurrentDir() != "/" {
+		t.Errorf("CurrentDir() = %q, want /", bashTool.CurrentDir())
+	}
+
+	// With the shell elsewhere, cd back to workDir is no longer redundant.
+	normalized := bashTool.NormalizeInput(json.RawMessage(`{"command":"cd ` + workDir + ` && pwd"}`))
+	if !strings.Contains(string(normalized), "cd "+workDir) {
+		t.Errorf("expected cd prefix to be kept, got %s", normalized)
+	}
+
+	if result := run("exit 2"); !result.IsError {
+		t.Errorf("expected error for exit 2, got %q", result.Output)
+	}
+}
+
+func TestShell_Limits(t *testing.T) {
+	t.Parallel()
+
+	sh := NewShell(t.TempDir())
+	sh.Limits = BashLimits{OpenFiles: 64, MaxOutputBytes: 10}
+	t.Cleanup(func() { _ = sh.Close() })
+
+	res, err := sh.Run(context.Background(), "ulimit -n")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.TrimSpace(res.Output) != "64" {
+		t.Errorf("ulimit -n = %q, want 64", res.Output)
+	}
+
+	res, err = sh.Run(context.Background(), "echo 0123456789abcdef")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(res.Output, "output truncated") {
+		t.Errorf("expected truncated output, got %q", res.Output)
+	}
+}
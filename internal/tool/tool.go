@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // Tool defines the interface that all agent tools must implement.
@@ -23,6 +25,21 @@ type InputNormalizer interface {
 	NormalizeInput(input json.RawMessage) json.RawMessage
 }
 
+// PermissionSubjecter is an optional interface for tools that report what
+// a call acts on, so permission rules can match it: every path, a command
+// or a URL. Each subject is checked against the tool's rules and the
+// strictest action wins. Tools without it are matched by the permission
+// package's built-in extraction, or only by Tool(*) rules.
+type PermissionSubjecter interface {
+	PermissionSubjects(input json.RawMessage) []permission.Subject
+}
+
+// DirReporter is an optional interface for tools whose working directory
+// can change between calls, such as bash with a persistent shell.
+type DirReporter interface {
+	CurrentDir() string
+}
+
 // Result holds the output from a tool execution.
 type Result struct {
 	Output  string
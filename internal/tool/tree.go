@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 const (
@@ -34,6 +36,22 @@ type treeInput struct {
 
 func (t *TreeTool) Name() string { return "tree" }
 
+// PermissionSubjects reports the directory listed.
+func (t *TreeTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in treeInput
+	if len(input) > 0 && json.Unmarshal(input, &in) != nil {
+		return nil
+	}
+	dir := t.WorkDir
+	if in.Path != "" {
+		dir = in.Path
+		if !filepath.IsAbs(dir) && t.WorkDir != "" {
+			dir = filepath.Join(t.WorkDir, dir)
+		}
+	}
+	return []permission.Subject{{Kind: permission.SubjectPath, Value: dir}}
+}
+
 func (t *TreeTool) Description() string {
 	return "Display directory structure as a tree. Shows files and directories recursively " +
 		"with visual hierarchy. Useful for understanding project layout. " +
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/zhubert/milo/internal/permission"
 )
 
 // UndoTool reverts recent file changes made by write and edit tools.
@@ -23,6 +25,26 @@ type undoInput struct {
 
 func (t *UndoTool) Name() string { return "undo" }
 
+// PermissionSubjects reports the file an undo would change: the one given,
+// or else the one changed most recently.
+func (t *UndoTool) PermissionSubjects(input json.RawMessage) []permission.Subject {
+	var in undoInput
+	if len(input) > 0 && json.Unmarshal(input, &in) != nil {
+		return nil
+	}
+	path := in.FilePath
+	if path == "" {
+		history := t.History
+		if history == nil {
+			history = DefaultFileHistory
+		}
+		if changes := history.GetAllChanges(); len(changes) > 0 {
+			path = changes[0].FilePath
+		}
+	}
+	return []permission.Subject{{Kind: permission.SubjectPath, Value: path, Write: true}}
+}
+
 func (t *UndoTool) Description() string {
 	return "Undo the most recent file change. If file_path is provided, undoes the most recent change to that specific file. " +
 		"Otherwise, undoes the most recent change across all files. " +
@@ -18,9 +18,15 @@ const (
 	maxWebFetchBodySize = 1024 * 1024 // 1MB
 )
 
-// WebFetchTool fetches content from a URL.
+// WebFetchTool fetches content from a URL. It refuses private, loopback
+// and link-local addresses unless Config allows them.
 // It implements ParallelSafeTool since it only reads external data.
-type WebFetchTool struct{}
+type WebFetchTool struct {
+	Config WebFetchConfig
+	// CheckRedirect vets a redirect to another host, which the permission
+	// check for the original URL didn't cover. Nil follows them all.
+	CheckRedirect func(url string) error
+}
 
 // IsParallelSafe returns true since fetch operations don't modify local state.
 func (t *WebFetchTool) IsParallelSafe() bool { return true }
@@ -34,7 +40,8 @@ func (t *WebFetchTool) Name() string { return "web_fetch" }
 func (t *WebFetchTool) Description() string {
 	return "Fetch content from a URL. Returns the page content with HTML tags stripped " +
 		"for readability. Useful for reading documentation, API references, and web pages. " +
-		"Content is limited to 1MB. Timeout is 30 seconds."
+		"Content is limited to 1MB. Timeout is 30 seconds. Private, loopback and link-local " +
+		"addresses (localhost, 10.x, 169.254.x, ...) are refused."
 }
 
 func (t *WebFetchTool) InputSchema() anthropic.ToolInputSchemaParam {
@@ -63,8 +70,9 @@ func (t *WebFetchTool) Execute(ctx context.Context, input json.RawMessage) (Resu
 		return Result{Output: "url must start with http:// or https://", IsError: true}, nil
 	}
 
-	client := &http.Client{
-		Timeout: webFetchTimeout,
+	client, err := newGuardedClient(t.Config, webFetchTimeout, t.CheckRedirect)
+	if err != nil {
+		return Result{Output: err.Error(), IsError: true}, nil
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
@@ -77,7 +85,7 @@ func (t *WebFetchTool) Execute(ctx context.Context, input json.RawMessage) (Resu
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return Result{Output: fmt.Sprintf("error fetching URL: %s", err), IsError: true}, nil
+		return Result{Output: fmt.Sprintf("error fetching URL: %s%s", err, proxyNote(req)), IsError: true}, nil
 	}
 	defer func() { _ = resp.Body.Close() }()
 
@@ -0,0 +1,175 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInternalIP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // cloud metadata
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"::ffff:127.0.0.1", true},
+		{"8.8.8.8", false},
+		{"142.250.72.14", false},
+		{"2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := internalIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("internalIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func fetch(t *testing.T, tool *WebFetchTool, url string) Result {
+	t.Helper()
+	input, _ := json.Marshal(webFetchInput{URL: url})
+	result, err := tool.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	return result
+}
+
+func TestWebFetchRefusesInternalAddresses(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret admin page"))
+	}))
+	defer srv.Close()
+
+	for _, url := range []string{srv.URL, "http://169.254.169.254/latest/meta-data/"} {
+		result := fetch(t, &WebFetchTool{}, url)
+		if !result.IsError || !strings.Contains(result.Output, "private, loopback or link-local") {
+			t.Errorf("fetch %s = %q, want it refused", url, result.Output)
+		}
+		if strings.Contains(result.Output, "secret admin page") {
+			t.Errorf("fetch %s returned the page", url)
+		}
+	}
+
+	allowed := &WebFetchTool{Config: WebFetchConfig{AllowPrivate: []string{"127.0.0.0/8"}}}
+	if result := fetch(t, allowed, srv.URL); result.IsError || !strings.Contains(result.Output, "secret admin page") {
+		t.Errorf("fetch with allow_private = %q, want the page", result.Output)
+	}
+}
+
+func TestWebFetchChecksRedirects(t *testing.T) {
+	t.Parallel()
+
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer internal.Close()
+
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-internal":
+			http.Redirect(w, r, internal.URL, http.StatusFound)
+		default:
+			http.Redirect(w, r, "http://"+r.Host+"/loop", http.StatusFound)
+		}
+	}))
+	defer public.Close()
+
+	publicIP := public.Listener.Addr().(*net.TCPAddr).IP.String()
+
+	// Only the host name localhost is allowed, so the redirect to the
+	// internal server's IP has to be caught when it's followed.
+	tool := &WebFetchTool{Config: WebFetchConfig{AllowPrivate: []string{"localhost"}, MaxRedirects: 2}}
+	localURL := strings.Replace(public.URL, publicIP, "localhost", 1)
+	if result := fetch(t, tool, localURL+"/to-internal"); !result.IsError || !strings.Contains(result.Output, "private, loopback or link-local") {
+		t.Errorf("redirect to an internal address = %q, want it refused", result.Output)
+	}
+	if result := fetch(t, tool, localURL+"/loop"); !result.IsError || !strings.Contains(result.Output, "stopped after 2 redirects") {
+		t.Errorf("redirect loop = %q, want it stopped", result.Output)
+	}
+}
+
+func TestWebFetchVetsRedirectsToOtherHosts(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/other-host":
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "localhost", "127.0.0.1", 1)+"/page", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("page"))
+		}
+	}))
+	defer srv.Close()
+
+	var checked []string
+	tool := &WebFetchTool{
+		Config: WebFetchConfig{AllowPrivate: []string{"127.0.0.0/8"}},
+		CheckRedirect: func(url string) error {
+			checked = append(checked, url)
+			return errors.New("needs permission")
+		},
+	}
+	localURL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	if result := fetch(t, tool, localURL+"/same-host"); result.IsError {
+		t.Errorf("redirect on the same host = %q, want the page", result.Output)
+	}
+	if len(checked) != 0 {
+		t.Errorf("redirect on the same host was checked: %v", checked)
+	}
+	if result := fetch(t, tool, localURL+"/other-host"); !result.IsError || !strings.Contains(result.Output, "needs permission") {
+		t.Errorf("redirect to another host = %q, want it refused", result.Output)
+	}
+	if len(checked) != 1 || !strings.HasPrefix(checked[0], "http://127.0.0.1:") {
+		t.Errorf("checked %v, want the other host's URL", checked)
+	}
+}
+
+func TestAddressGuard(t *testing.T) {
+	t.Parallel()
+
+	guard, err := newAddressGuard([]string{"10.0.0.0/8", "192.168.1.5", "Intranet.Example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		ip   string
+		want bool
+	}{
+		{"example.com", "93.184.216.34", true},
+		{"build.internal", "10.4.0.2", true},
+		{"printer", "192.168.1.5", true},
+		{"router", "192.168.1.1", false},
+		{"intranet.example.com", "172.16.0.9", true},
+		{"metadata", "169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		if got := guard.allowed(tt.host, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("allowed(%s, %s) = %v, want %v", tt.host, tt.ip, got, tt.want)
+		}
+	}
+
+	if _, err := newAddressGuard([]string{"10.0.0.0/99"}); err == nil {
+		t.Error("newAddressGuard() with a bad CIDR succeeded")
+	}
+}